@@ -1,69 +1,492 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"flag"
 	"fmt"
+	"github.com/VannRR/golox/internal/chunk"
+	"github.com/VannRR/golox/internal/compiler"
+	"github.com/VannRR/golox/internal/dap"
+	"github.com/VannRR/golox/internal/debug"
+	"github.com/VannRR/golox/internal/debugger"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/format"
+	"github.com/VannRR/golox/internal/lsp"
+	"github.com/VannRR/golox/internal/repl"
 	"github.com/VannRR/golox/internal/vm"
 	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 )
 
+const usage = `Usage: golox [flags] [path | -] [args...]
+       golox run [flags] <path | -> [args...]
+       golox run [flags] -e <code> [args...]
+       golox repl [flags]
+       golox disasm [-e <code>] <path | ->
+       golox compile <path> [-o <out.loxc>]
+       golox check [--format=text|json] [--timeout=d] [--max-instructions=n] [--max-bytes=n] <path | ->
+       golox lint [--format=text|json] <path | ->
+       golox fmt [--check] <path>...
+       golox lsp
+       golox dap
+       golox debug <path>
+       golox version
+`
+
+// version is set when building with -ldflags "-X main.version=...".
+var version = "devel"
+
 func main() {
-	vm := vm.NewVM()
+	v := vm.NewVM()
+	v.SetFileSystem(vm.OSFileSystem())
 
-	if argc := len(os.Args); argc == 1 {
-		repl(vm)
-	} else if argc == 2 {
-		runFile(vm, os.Args[1])
-	} else {
-		fmt.Fprintf(os.Stderr, "Usage: golox [path]\n")
+	if len(os.Args) == 1 {
+		startREPL(v, nil)
+		return
+	}
+
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "run":
+		runScript(v, args)
+	case "repl":
+		startREPL(v, args)
+	case "disasm":
+		disassembleScript(args)
+	case "compile":
+		compileFile(args)
+	case "check":
+		checkFile(args)
+	case "lint":
+		lintFile(args)
+	case "fmt":
+		formatFiles(args)
+	case "lsp":
+		requireArgs(args, 0)
+		languageServer()
+	case "dap":
+		requireArgs(args, 0)
+		debugAdapter()
+	case "debug":
+		requireArgs(args, 1)
+		debugFile(args[0])
+	case "version":
+		requireArgs(args, 0)
+		fmt.Printf("golox %s %s %s/%s\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	default:
+		runScript(v, os.Args[1:])
+	}
+}
+
+func requireArgs(args []string, n int) {
+	if len(args) != n {
+		fmt.Fprint(os.Stderr, usage)
 		os.Exit(64)
 	}
 }
 
-func repl(v *vm.VM) {
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Printf("> ")
+// debugFlags adds the flags that turn on the compiler's and VM's debug
+// output.
+func debugFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&debug.PrintCode, "print-code", false, "print the bytecode of each function as it is compiled")
+	flags.BoolVar(&debug.TraceExecution, "trace", false, "print each instruction and the stack as it runs")
+}
 
-		if line, _ := reader.ReadBytes('\n'); line[0] != '\n' {
-			v.Interpret(&line)
+// seedFlag adds the --seed flag, the returned function seeds v if it was
+// given once the flags are parsed.
+func seedFlag(flags *flag.FlagSet, v *vm.VM) func() {
+	seed := flags.Uint64("seed", 0, "seed the random natives with `n` so runs repeat")
+	return func() {
+		if isSet(flags, "seed") {
+			v.SetSeed(*seed)
 		}
 	}
 }
 
-func runFile(v *vm.VM, path string) {
-	source := readFile(path)
-	result := v.Interpret(source)
+// isSet reports whether the flag called name was given.
+func isSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// startREPL runs the interactive prompt, keeping its history in the file
+// named by GOLOX_HISTORY or ~/.golox_history, an empty GOLOX_HISTORY keeps
+// none.
+func startREPL(v *vm.VM, args []string) {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	debugFlags(flags)
+	seed := seedFlag(flags, v)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	if flags.Parse(args); flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(64)
+	}
+	seed()
+
+	r := repl.New(v, os.Stdin, os.Stdout, os.Stderr)
+
+	path, ok := os.LookupEnv("GOLOX_HISTORY")
+	if home, err := os.UserHomeDir(); !ok && err == nil {
+		path = filepath.Join(home, ".golox_history")
+	}
+	if path != "" {
+		if err := r.SetHistoryFile(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read history \"%s\": %v\n", path, err)
+		}
+	}
+
+	if err := r.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "golox: %v\n", err)
+		os.Exit(74)
+	}
+}
+
+// runScript runs a file, stdin when the path is -, or the code given with
+// -e. Flags end at the path so the arguments after it, which the script reads
+// from args, can look like flags too.
+func runScript(v *vm.VM, args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	code := flags.String("e", "", "use `code` instead of reading a file")
+	debugFlags(flags)
+	seed := seedFlag(flags, v)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	args = flags.Args()
+	seed()
+
+	var file string
+	var source []byte
+	if isSet(flags, "e") {
+		file, source = "-e", []byte(*code)
+	} else if len(args) > 0 {
+		file, source = readSource(args[0])
+		args = args[1:]
+	} else {
+		flags.Usage()
+		os.Exit(64)
+	}
+	v.SetArgs(args)
+
+	var result vm.InterpretResult
+	if bytes.HasPrefix(source, []byte(chunk.Magic)) {
+		program, err := vm.LoadProgram(source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not load \"%s\": %v\n", file, err)
+			os.Exit(65)
+		}
+		result = v.Run(program)
+	} else {
+		program, ok := vm.CompileFile(file, &source)
+		if !ok {
+			os.Exit(65)
+		}
+		result = v.Run(program)
+	}
 
 	if result == vm.InterpretCompileError {
 		os.Exit(65)
 	}
-	if result == vm.InterpretRuntimeError {
+	if result != vm.InterpretOk {
 		os.Exit(70)
 	}
 }
 
-func readFile(path string) *[]byte {
-	file, err := os.Open(path)
+// disassembleScript prints the bytecode of a script and of the functions it
+// declares without running it.
+func disassembleScript(args []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	code := flags.String("e", "", "use `code` instead of reading a file")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	paths := parseInterspersed(flags, args)
+	var file string
+	var source []byte
+	if isSet(flags, "e") && len(paths) == 0 {
+		file, source = "-e", []byte(*code)
+	} else if !isSet(flags, "e") && len(paths) == 1 {
+		file, source = readSource(paths[0])
+	} else {
+		flags.Usage()
+		os.Exit(64)
+	}
+
+	var program *vm.Program
+	if bytes.HasPrefix(source, []byte(chunk.Magic)) {
+		var err error
+		if program, err = vm.LoadProgram(source); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not load \"%s\": %v\n", file, err)
+			os.Exit(65)
+		}
+	} else {
+		var ok bool
+		if program, ok = vm.CompileFile(file, &source); !ok {
+			os.Exit(65)
+		}
+	}
+	debug.DisassembleAllTo(os.Stdout, program.Chunk(), "code")
+}
+
+func compileFile(args []string) {
+	flags := flag.NewFlagSet("compile", flag.ExitOnError)
+	output := flags.String("o", "", "path of the compiled `file`, defaults to <path>c")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	paths := parseInterspersed(flags, args)
+	if len(paths) != 1 {
+		flags.Usage()
+		os.Exit(64)
+	}
+
+	path := paths[0]
+	if *output == "" {
+		*output = strings.TrimSuffix(path, ".lox") + ".loxc"
+	}
+
+	source := readFile(path)
+	program, ok := vm.Compile(&source)
+	if !ok {
+		os.Exit(65)
+	}
+
+	data, err := program.MarshalBinary()
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "Could not encode \"%s\": %v\n", path, err)
+		os.Exit(70)
+	}
+
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not write \"%s\": %v\n", *output, err)
+		os.Exit(74)
+	}
+}
+
+// checkFile compiles and runs a script, reporting compile errors or the
+// runtime error as text or as a JSON array. The script's own output goes to
+// stderr so stdout only holds the report. It runs without access to files, so
+// checking it can't change anything, and is stopped once it runs too long or
+// allocates too much.
+func checkFile(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	format := flags.String("format", "text", "report `format`, text or json")
+	timeout := flags.Duration("timeout", 10*time.Second, "stop the script after `d`")
+	maxInstructions := flags.Int("max-instructions", 100_000_000, "stop the script after `n` instructions, 0 for no limit")
+	maxBytes := flags.Int("max-bytes", 256<<20, "stop the script once it allocates `n` bytes, 0 for no limit")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	paths := parseInterspersed(flags, args)
+	if len(paths) != 1 || (*format != "text" && *format != "json") {
+		flags.Usage()
+		os.Exit(64)
+	}
+
+	path, source := readSource(paths[0])
+	v := newCheckVM(*maxInstructions, *maxBytes)
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	diagnostics := v.Check(ctx, &source)
+
+	if *format == "json" {
+		if err := diagnostic.WriteJSON(os.Stdout, path, source, diagnostics); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not write report: %v\n", err)
+			os.Exit(74)
+		}
+	} else {
+		diagnostic.NewRenderer(source, path, diagnostic.IsTerminal(os.Stdout)).RenderAll(os.Stdout, diagnostics)
+	}
+
+	if len(diagnostics) > 0 && v.Err() == nil {
+		os.Exit(65)
+	}
+	if len(diagnostics) > 0 {
+		os.Exit(70)
+	}
+}
+
+// newCheckVM returns the VM golox check runs scripts in, with no file system
+// and with its output on stderr.
+func newCheckVM(maxInstructions int, maxBytes int) *vm.VM {
+	v := vm.NewVM()
+	v.SetMaxInstructions(maxInstructions)
+	v.SetMaxBytes(maxBytes)
+	v.SetOutput(os.Stderr, nil)
+	return v
+}
+
+// lintFile reports compile errors and lint warnings without running the
+// script, exiting with 1 when there are only warnings.
+func lintFile(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := flags.String("format", "text", "report `format`, text or json")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	paths := parseInterspersed(flags, args)
+	if len(paths) != 1 || (*format != "text" && *format != "json") {
+		flags.Usage()
+		os.Exit(64)
 	}
-	defer file.Close()
 
-	buf := make([]byte, 0)
-	reader := bufio.NewReader(file)
+	path, source := readSource(paths[0])
+	diagnostics := compiler.Lint(&source)
 
+	if *format == "json" {
+		if err := diagnostic.WriteJSON(os.Stdout, path, source, diagnostics); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not write report: %v\n", err)
+			os.Exit(74)
+		}
+	} else {
+		diagnostic.NewRenderer(source, path, diagnostic.IsTerminal(os.Stdout)).RenderAll(os.Stdout, diagnostics)
+	}
+
+	for _, d := range diagnostics {
+		if d.Severity == diagnostic.Error {
+			os.Exit(65)
+		}
+	}
+	if len(diagnostics) > 0 {
+		os.Exit(1)
+	}
+}
+
+// formatFiles rewrites each file in the canonical style. With --check the
+// files are left alone and the ones that aren't formatted are listed, exiting
+// with 1 if there are any.
+func formatFiles(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "list unformatted files instead of rewriting them")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	paths := parseInterspersed(flags, args)
+	if len(paths) == 0 {
+		flags.Usage()
+		os.Exit(64)
+	}
+
+	failed, unformatted := false, false
+	for _, path := range paths {
+		source := readFile(path)
+		formatted, diagnostics := format.Source(source)
+		if len(diagnostics) > 0 {
+			diagnostic.NewRenderer(source, path, diagnostic.IsTerminal(os.Stderr)).RenderAll(os.Stderr, diagnostics)
+			failed = true
+			continue
+		}
+		if bytes.Equal(source, formatted) {
+			continue
+		}
+
+		if *check {
+			fmt.Println(path)
+			unformatted = true
+		} else if err := os.WriteFile(path, formatted, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not write \"%s\": %v\n", path, err)
+			os.Exit(74)
+		}
+	}
+
+	if failed {
+		os.Exit(65)
+	}
+	if unformatted {
+		os.Exit(1)
+	}
+}
+
+// languageServer speaks the Language Server Protocol over stdin and stdout,
+// so nothing else may print to stdout while it runs.
+func languageServer() {
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "golox lsp: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func debugAdapter() {
+	if err := dap.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "golox dap: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// debugFile runs a script under the command line debugger, paused before its
+// first instruction.
+func debugFile(path string) {
+	source := readFile(path)
+	program, ok := vm.CompileFile(path, &source)
+	if !ok {
+		os.Exit(65)
+	}
+
+	session := debugger.NewSession(program, os.Stdout, os.Stderr)
+	session.VM().SetFileSystem(vm.OSFileSystem())
+	fmt.Println("Debugging", path, "- type help for the commands.")
+	result := debugger.NewConsole(session, source, os.Stdin, os.Stdout).Run()
+	if result != vm.InterpretOk && result != vm.InterpretCanceled {
+		os.Exit(70)
+	}
+}
+
+// parseInterspersed parses flags that may appear before or after positional
+// arguments and returns the positional arguments.
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	positional := make([]string, 0)
 	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err != io.EOF {
-				fmt.Println(err)
-			}
-			break
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
 		}
-		buf = append(buf, line...)
+		positional = append(positional, args[0])
+		args = args[1:]
 	}
+}
+
+// readSource reads a script from path, or from stdin when path is -, and
+// returns the name to report it under with its source.
+func readSource(path string) (string, []byte) {
+	if path != "-" {
+		return path, readFile(path)
+	}
+	source, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read stdin: %v\n", err)
+		os.Exit(74)
+	}
+	return "<stdin>", source
+}
 
-	return &buf
+func readFile(path string) []byte {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read file \"%s\": %v\n", path, err)
+		os.Exit(74)
+	}
+	return source
 }
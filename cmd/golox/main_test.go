@@ -0,0 +1,16 @@
+package main
+
+import (
+	"context"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"testing"
+)
+
+func Test_newCheckVM_memoryLimit(t *testing.T) {
+	source := []byte("var s = \"x\";\nwhile (true) s = s + s;\n")
+	v := newCheckVM(0, 1<<20)
+	diagnostics := v.Check(context.Background(), &source)
+	if len(diagnostics) != 1 || diagnostics[0].Code != diagnostic.CodeMemoryLimit {
+		t.Errorf("Expected one %s diagnostic, got %v", diagnostic.CodeMemoryLimit, diagnostics)
+	}
+}
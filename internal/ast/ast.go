@@ -0,0 +1,223 @@
+// Package ast declares the syntax tree of a Lox script. Nodes keep the tokens
+// they were parsed from so every node knows its span in the source.
+package ast
+
+import (
+	"github.com/VannRR/golox/internal/token"
+)
+
+type Node interface {
+	Span() token.Span
+	// End is the last token of the node.
+	End() token.Token
+}
+
+type Expr interface {
+	Node
+	exprNode()
+}
+
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// File is a whole script, Eof is kept as the position of the implicit return
+// at its end. Comments aren't part of the tree, they are kept in source order
+// for the tools that need them.
+type File struct {
+	Statements []Stmt
+	Comments   []token.Token
+	Eof        token.Token
+}
+
+// Expressions.
+type (
+	// BadExpr stands in for an expression that failed to parse.
+	BadExpr struct {
+		Token token.Token
+	}
+
+	// Literal is a number, string, true, false or nil.
+	Literal struct {
+		Token token.Token
+	}
+
+	Variable struct {
+		Name token.Token
+	}
+
+	Assign struct {
+		Name  token.Token
+		Value Expr
+	}
+
+	Grouping struct {
+		LeftParen  token.Token
+		Expression Expr
+		RightParen token.Token
+	}
+
+	Unary struct {
+		Operator token.Token
+		Right    Expr
+	}
+
+	Binary struct {
+		Left     Expr
+		Operator token.Token
+		Right    Expr
+	}
+
+	// Logical is an 'and' or an 'or', which only evaluate Right when they
+	// have to.
+	Logical struct {
+		Left     Expr
+		Operator token.Token
+		Right    Expr
+	}
+
+	Call struct {
+		Callee     Expr
+		LeftParen  token.Token
+		Arguments  []Expr
+		RightParen token.Token
+	}
+)
+
+// Statements.
+type (
+	ExpressionStmt struct {
+		Expression Expr
+		Semicolon  token.Token
+	}
+
+	PrintStmt struct {
+		Keyword    token.Token
+		Expression Expr
+		Semicolon  token.Token
+	}
+
+	// VarStmt declares a variable, Initializer is nil when there is none.
+	VarStmt struct {
+		Keyword     token.Token
+		Name        token.Token
+		Initializer Expr
+		Semicolon   token.Token
+	}
+
+	BlockStmt struct {
+		LeftBrace  token.Token
+		Statements []Stmt
+		RightBrace token.Token
+	}
+
+	// IfStmt has a nil Else when there is no else branch.
+	IfStmt struct {
+		Keyword    token.Token
+		Condition  Expr
+		RightParen token.Token
+		Then       Stmt
+		Else       Stmt
+	}
+
+	WhileStmt struct {
+		Keyword    token.Token
+		Condition  Expr
+		RightParen token.Token
+		Body       Stmt
+	}
+
+	// ForStmt may leave out Initializer, Condition and Increment.
+	// ConditionSemicolon is the ';' that ends the condition, even when
+	// there is no condition.
+	ForStmt struct {
+		Keyword            token.Token
+		Initializer        Stmt
+		Condition          Expr
+		ConditionSemicolon token.Token
+		Increment          Expr
+		RightParen         token.Token
+		Body               Stmt
+	}
+
+	FunStmt struct {
+		Keyword token.Token
+		Name    token.Token
+		Params  []token.Token
+		Body    *BlockStmt
+	}
+
+	// ReturnStmt has a nil Value for a bare 'return;'.
+	ReturnStmt struct {
+		Keyword   token.Token
+		Value     Expr
+		Semicolon token.Token
+	}
+)
+
+func (e *BadExpr) Span() token.Span  { return e.Token.Span() }
+func (e *Literal) Span() token.Span  { return e.Token.Span() }
+func (e *Variable) Span() token.Span { return e.Name.Span() }
+func (e *Assign) Span() token.Span   { return e.Name.Span().To(e.Value.Span()) }
+func (e *Grouping) Span() token.Span { return e.LeftParen.Span().To(e.RightParen.Span()) }
+func (e *Unary) Span() token.Span    { return e.Operator.Span().To(e.Right.Span()) }
+func (e *Binary) Span() token.Span   { return e.Left.Span().To(e.Right.Span()) }
+func (e *Logical) Span() token.Span  { return e.Left.Span().To(e.Right.Span()) }
+func (e *Call) Span() token.Span     { return e.Callee.Span().To(e.RightParen.Span()) }
+
+func (e *BadExpr) End() token.Token  { return e.Token }
+func (e *Literal) End() token.Token  { return e.Token }
+func (e *Variable) End() token.Token { return e.Name }
+func (e *Assign) End() token.Token   { return e.Value.End() }
+func (e *Grouping) End() token.Token { return e.RightParen }
+func (e *Unary) End() token.Token    { return e.Right.End() }
+func (e *Binary) End() token.Token   { return e.Right.End() }
+func (e *Logical) End() token.Token  { return e.Right.End() }
+func (e *Call) End() token.Token     { return e.RightParen }
+
+func (s *ExpressionStmt) Span() token.Span { return s.Expression.Span().To(s.Semicolon.Span()) }
+func (s *PrintStmt) Span() token.Span      { return s.Keyword.Span().To(s.Semicolon.Span()) }
+func (s *VarStmt) Span() token.Span        { return s.Keyword.Span().To(s.Semicolon.Span()) }
+func (s *BlockStmt) Span() token.Span      { return s.LeftBrace.Span().To(s.RightBrace.Span()) }
+func (s *IfStmt) Span() token.Span         { return s.Keyword.Span().To(s.End().Span()) }
+func (s *WhileStmt) Span() token.Span      { return s.Keyword.Span().To(s.Body.Span()) }
+func (s *ForStmt) Span() token.Span        { return s.Keyword.Span().To(s.Body.Span()) }
+func (s *FunStmt) Span() token.Span        { return s.Keyword.Span().To(s.Body.Span()) }
+func (s *ReturnStmt) Span() token.Span     { return s.Keyword.Span().To(s.Semicolon.Span()) }
+
+func (s *ExpressionStmt) End() token.Token { return s.Semicolon }
+func (s *PrintStmt) End() token.Token      { return s.Semicolon }
+func (s *VarStmt) End() token.Token        { return s.Semicolon }
+func (s *BlockStmt) End() token.Token      { return s.RightBrace }
+func (s *WhileStmt) End() token.Token      { return s.Body.End() }
+func (s *ForStmt) End() token.Token        { return s.Body.End() }
+func (s *FunStmt) End() token.Token        { return s.Body.RightBrace }
+func (s *ReturnStmt) End() token.Token     { return s.Semicolon }
+
+func (s *IfStmt) End() token.Token {
+	if s.Else != nil {
+		return s.Else.End()
+	}
+	return s.Then.End()
+}
+
+func (*BadExpr) exprNode()  {}
+func (*Literal) exprNode()  {}
+func (*Variable) exprNode() {}
+func (*Assign) exprNode()   {}
+func (*Grouping) exprNode() {}
+func (*Unary) exprNode()    {}
+func (*Binary) exprNode()   {}
+func (*Logical) exprNode()  {}
+func (*Call) exprNode()     {}
+
+func (*ExpressionStmt) stmtNode() {}
+func (*PrintStmt) stmtNode()      {}
+func (*VarStmt) stmtNode()        {}
+func (*BlockStmt) stmtNode()      {}
+func (*IfStmt) stmtNode()         {}
+func (*WhileStmt) stmtNode()      {}
+func (*ForStmt) stmtNode()        {}
+func (*FunStmt) stmtNode()        {}
+func (*ReturnStmt) stmtNode()     {}
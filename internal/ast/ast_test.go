@@ -0,0 +1,94 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/VannRR/golox/internal/token"
+	"testing"
+)
+
+func tok(tt token.TokenType, lexeme string, offset int) token.Token {
+	return token.Token{Type: tt, Lexeme: []byte(lexeme), Line: 1, Column: offset + 1, Offset: offset, Length: len(lexeme)}
+}
+
+// if (a) print -b; else x = f(1);
+func testTree() *IfStmt {
+	return &IfStmt{
+		Keyword:    tok(token.If, "if", 0),
+		Condition:  &Variable{Name: tok(token.Identifier, "a", 4)},
+		RightParen: tok(token.RightParen, ")", 5),
+		Then: &PrintStmt{
+			Keyword:    tok(token.Print, "print", 7),
+			Expression: &Unary{Operator: tok(token.Minus, "-", 13), Right: &Variable{Name: tok(token.Identifier, "b", 14)}},
+			Semicolon:  tok(token.Semicolon, ";", 15),
+		},
+		Else: &ExpressionStmt{
+			Expression: &Assign{
+				Name: tok(token.Identifier, "x", 22),
+				Value: &Call{
+					Callee:     &Variable{Name: tok(token.Identifier, "f", 26)},
+					LeftParen:  tok(token.LeftParen, "(", 27),
+					Arguments:  []Expr{&Literal{Token: tok(token.Number, "1", 28)}},
+					RightParen: tok(token.RightParen, ")", 29),
+				},
+			},
+			Semicolon: tok(token.Semicolon, ";", 30),
+		},
+	}
+}
+
+func Test_Sprint(t *testing.T) {
+	expected := "(if a (print (- b)) (expr (= x (call f 1))))"
+	if got := Sprint(testTree()); got != expected {
+		t.Errorf("Sprint() = %s, expected %s", got, expected)
+	}
+}
+
+func Test_Span(t *testing.T) {
+	tree := testTree()
+	tests := []struct {
+		name     string
+		node     Node
+		expected token.Span
+	}{
+		{name: "if", node: tree, expected: token.Span{Line: 1, Column: 1, Offset: 0, Length: 31}},
+		{name: "unary", node: tree.Then.(*PrintStmt).Expression, expected: token.Span{Line: 1, Column: 14, Offset: 13, Length: 2}},
+		{name: "assign", node: tree.Else.(*ExpressionStmt).Expression, expected: token.Span{Line: 1, Column: 23, Offset: 22, Length: 8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.node.Span(); got != tt.expected {
+				t.Errorf("Span() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_End(t *testing.T) {
+	tree := testTree()
+	if end := tree.End(); end.Offset != 30 {
+		t.Errorf("End() = %v, expected the ';' of the else branch", end)
+	}
+
+	tree.Else = nil
+	if end := tree.End(); end.Offset != 15 {
+		t.Errorf("End() = %v, expected the ';' of the then branch", end)
+	}
+	if end := tree.Condition.End(); end.Offset != 4 {
+		t.Errorf("Condition.End() = %v, expected 'a'", end)
+	}
+}
+
+func Test_Inspect(t *testing.T) {
+	visited := make([]string, 0)
+	Inspect(testTree(), func(n Node) bool {
+		visited = append(visited, fmt.Sprintf("%T", n))
+		_, isPrint := n.(*PrintStmt)
+		return !isPrint
+	})
+
+	expected := "[*ast.IfStmt *ast.Variable *ast.PrintStmt *ast.ExpressionStmt *ast.Assign *ast.Call *ast.Variable *ast.Literal]"
+	if fmt.Sprint(visited) != expected {
+		t.Errorf("Inspect() visited %v, expected %s", visited, expected)
+	}
+}
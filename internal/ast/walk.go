@@ -0,0 +1,174 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Inspect visits node and then its children in source order, skipping the
+// children of a node when visit returns false.
+func Inspect(node Node, visit func(Node) bool) {
+	if node == nil || !visit(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Assign:
+		Inspect(n.Value, visit)
+	case *Grouping:
+		Inspect(n.Expression, visit)
+	case *Unary:
+		Inspect(n.Right, visit)
+	case *Binary:
+		Inspect(n.Left, visit)
+		Inspect(n.Right, visit)
+	case *Logical:
+		Inspect(n.Left, visit)
+		Inspect(n.Right, visit)
+	case *Call:
+		Inspect(n.Callee, visit)
+		for _, argument := range n.Arguments {
+			Inspect(argument, visit)
+		}
+	case *ExpressionStmt:
+		Inspect(n.Expression, visit)
+	case *PrintStmt:
+		Inspect(n.Expression, visit)
+	case *VarStmt:
+		inspectExpr(n.Initializer, visit)
+	case *BlockStmt:
+		for _, statement := range n.Statements {
+			Inspect(statement, visit)
+		}
+	case *IfStmt:
+		Inspect(n.Condition, visit)
+		Inspect(n.Then, visit)
+		inspectStmt(n.Else, visit)
+	case *WhileStmt:
+		Inspect(n.Condition, visit)
+		Inspect(n.Body, visit)
+	case *ForStmt:
+		inspectStmt(n.Initializer, visit)
+		inspectExpr(n.Condition, visit)
+		inspectExpr(n.Increment, visit)
+		Inspect(n.Body, visit)
+	case *FunStmt:
+		Inspect(n.Body, visit)
+	case *ReturnStmt:
+		inspectExpr(n.Value, visit)
+	}
+}
+
+// inspectExpr and inspectStmt skip optional children, a nil Expr stored in
+// a Node would not compare equal to nil.
+func inspectExpr(e Expr, visit func(Node) bool) {
+	if e != nil {
+		Inspect(e, visit)
+	}
+}
+
+func inspectStmt(s Stmt, visit func(Node) bool) {
+	if s != nil {
+		Inspect(s, visit)
+	}
+}
+
+// Sprint returns node as a parenthesized prefix expression, for debugging and
+// tests.
+func Sprint(node Node) string {
+	var b strings.Builder
+	sprint(&b, node)
+	return b.String()
+}
+
+func sprint(b *strings.Builder, node Node) {
+	group := func(name string, children ...Node) {
+		b.WriteString("(" + name)
+		for _, child := range children {
+			b.WriteByte(' ')
+			sprint(b, child)
+		}
+		b.WriteByte(')')
+	}
+
+	switch n := node.(type) {
+	case nil:
+		b.WriteString("nil")
+	case *BadExpr:
+		b.WriteString("<bad>")
+	case *Literal:
+		b.Write(n.Token.Lexeme)
+	case *Variable:
+		b.Write(n.Name.Lexeme)
+	case *Assign:
+		group("= "+string(n.Name.Lexeme), n.Value)
+	case *Grouping:
+		group("group", n.Expression)
+	case *Unary:
+		group(string(n.Operator.Lexeme), n.Right)
+	case *Binary:
+		group(string(n.Operator.Lexeme), n.Left, n.Right)
+	case *Logical:
+		group(string(n.Operator.Lexeme), n.Left, n.Right)
+	case *Call:
+		children := []Node{n.Callee}
+		for _, argument := range n.Arguments {
+			children = append(children, argument)
+		}
+		group("call", children...)
+	case *ExpressionStmt:
+		group("expr", n.Expression)
+	case *PrintStmt:
+		group("print", n.Expression)
+	case *VarStmt:
+		if n.Initializer == nil {
+			group("var " + string(n.Name.Lexeme))
+		} else {
+			group("var "+string(n.Name.Lexeme), n.Initializer)
+		}
+	case *BlockStmt:
+		children := make([]Node, 0, len(n.Statements))
+		for _, statement := range n.Statements {
+			children = append(children, statement)
+		}
+		group("block", children...)
+	case *IfStmt:
+		if n.Else == nil {
+			group("if", n.Condition, n.Then)
+		} else {
+			group("if", n.Condition, n.Then, n.Else)
+		}
+	case *WhileStmt:
+		group("while", n.Condition, n.Body)
+	case *ForStmt:
+		group("for", optionalStmt(n.Initializer), optionalExpr(n.Condition), optionalExpr(n.Increment), n.Body)
+	case *FunStmt:
+		params := make([]string, 0, len(n.Params))
+		for _, param := range n.Params {
+			params = append(params, string(param.Lexeme))
+		}
+		group(fmt.Sprintf("fun %s(%s)", n.Name.Lexeme, strings.Join(params, " ")), n.Body)
+	case *ReturnStmt:
+		if n.Value == nil {
+			group("return")
+		} else {
+			group("return", n.Value)
+		}
+	default:
+		panic(fmt.Sprintf("ast.Sprint: unknown node %T", node))
+	}
+}
+
+func optionalExpr(e Expr) Node {
+	if e == nil {
+		return nil
+	}
+	return e
+}
+
+func optionalStmt(s Stmt) Node {
+	if s == nil {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,231 @@
+package chunk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/VannRR/golox/internal/token"
+	"github.com/VannRR/golox/internal/value"
+	"math"
+)
+
+const Magic = "LOXC"
+
+// FormatVersion 1 stored only line numbers in the line table, version 2 adds
+// the column, offset and length of each span. Both can be read.
+const FormatVersion uint16 = 2
+
+const (
+	ConstantNil byte = iota
+	ConstantBool
+	ConstantNumber
+	ConstantString
+	ConstantFunction
+)
+
+// ConstantMarshaler is implemented by constant types that live outside this
+// package, their decoders are added with RegisterConstant.
+type ConstantMarshaler interface {
+	ConstantTag() byte
+	MarshalBinary() ([]byte, error)
+}
+
+type ConstantDecoder = func(data []byte) (value.Value, error)
+
+var constantDecoders = map[byte]ConstantDecoder{}
+
+func RegisterConstant(tag byte, decode ConstantDecoder) {
+	constantDecoders[tag] = decode
+}
+
+var ErrInvalidFormat = errors.New("invalid chunk format")
+
+func (c *Chunk) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, len(Magic)+2+len(c.Code)+len(c.lineInfo)*2)
+	buf = append(buf, Magic...)
+	buf = binary.BigEndian.AppendUint16(buf, FormatVersion)
+
+	buf = binary.AppendUvarint(buf, uint64(len(c.Code)))
+	buf = append(buf, c.Code...)
+
+	buf = binary.AppendUvarint(buf, uint64(len(c.lineInfo)))
+	for _, l := range c.lineInfo {
+		buf = binary.AppendUvarint(buf, uint64(l.span.Line))
+		buf = binary.AppendUvarint(buf, uint64(l.span.Column))
+		buf = binary.AppendUvarint(buf, uint64(l.span.Offset))
+		buf = binary.AppendUvarint(buf, uint64(l.span.Length))
+		buf = binary.AppendUvarint(buf, uint64(l.count))
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(c.Constants)))
+	for i, constant := range c.Constants {
+		tag, payload, err := marshalConstant(constant)
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+		buf = append(buf, tag)
+		buf = binary.AppendUvarint(buf, uint64(len(payload)))
+		buf = append(buf, payload...)
+	}
+
+	return buf, nil
+}
+
+func marshalConstant(constant value.Value) (byte, []byte, error) {
+	switch v := constant.(type) {
+	case value.NilVal:
+		return ConstantNil, nil, nil
+	case value.BoolVal:
+		if v {
+			return ConstantBool, []byte{1}, nil
+		}
+		return ConstantBool, []byte{0}, nil
+	case value.NumberVal:
+		return ConstantNumber, binary.BigEndian.AppendUint64(nil, math.Float64bits(float64(v))), nil
+	case ConstantMarshaler:
+		payload, err := v.MarshalBinary()
+		return v.ConstantTag(), payload, err
+	default:
+		return 0, nil, fmt.Errorf("can't marshal constant '%v' of type %T", constant, constant)
+	}
+}
+
+func (c *Chunk) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(Magic)) {
+		return fmt.Errorf("%w: missing %q header", ErrInvalidFormat, Magic)
+	}
+	data = data[len(Magic):]
+
+	if len(data) < 2 {
+		return fmt.Errorf("%w: missing version", ErrInvalidFormat)
+	}
+	version := binary.BigEndian.Uint16(data)
+	if version < 1 || version > FormatVersion {
+		return fmt.Errorf("%w: unsupported version %d, expected at most %d", ErrInvalidFormat, version, FormatVersion)
+	}
+	r := reader{data: data[2:]}
+
+	code := r.bytes(r.uvarint())
+
+	lineInfo := make([]LineInfo, 0)
+	for n := r.uvarint(); n > 0 && r.err == nil; n-- {
+		var span token.Span
+		span.Line = r.int()
+		if version >= 2 {
+			span.Column = r.int()
+			span.Offset = r.int()
+			span.Length = r.int()
+		}
+		lineInfo = append(lineInfo, LineInfo{span: span, count: r.int()})
+	}
+
+	constants := value.NewValueArray()
+	for n := r.uvarint(); n > 0 && r.err == nil; n-- {
+		tag := r.byte()
+		payload := r.bytes(r.uvarint())
+		if r.err != nil {
+			break
+		}
+		constant, err := unmarshalConstant(tag, payload)
+		if err != nil {
+			return fmt.Errorf("%w: constant %d: %v", ErrInvalidFormat, len(constants), err)
+		}
+		constants.Write(constant)
+	}
+
+	if r.err == nil && len(r.data) != 0 {
+		r.fail(fmt.Sprintf("%d trailing bytes", len(r.data)))
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	c.Code = append(make([]byte, 0, len(code)), code...)
+	c.lineInfo = lineInfo
+	c.Constants = constants
+	return nil
+}
+
+func unmarshalConstant(tag byte, payload []byte) (value.Value, error) {
+	switch tag {
+	case ConstantNil:
+		return value.NilVal{}, nil
+	case ConstantBool:
+		if len(payload) != 1 {
+			return nil, errors.New("bool must be 1 byte")
+		}
+		return value.BoolVal(payload[0] != 0), nil
+	case ConstantNumber:
+		if len(payload) != 8 {
+			return nil, errors.New("number must be 8 bytes")
+		}
+		return value.NumberVal(math.Float64frombits(binary.BigEndian.Uint64(payload))), nil
+	}
+
+	decode, exists := constantDecoders[tag]
+	if !exists {
+		return nil, fmt.Errorf("unknown constant tag %d", tag)
+	}
+	return decode(payload)
+}
+
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) fail(msg string) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s", ErrInvalidFormat, msg)
+	}
+	r.data = nil
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail("truncated or overlong varint")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *reader) int() int {
+	v := r.uvarint()
+	if v > math.MaxInt32 {
+		r.fail("number out of range")
+		return 0
+	}
+	return int(v)
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) < 1 {
+		r.fail("unexpected end of data")
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *reader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.data)) {
+		r.fail("unexpected end of data")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
@@ -0,0 +1,96 @@
+package chunk
+
+import (
+	"errors"
+	"github.com/VannRR/golox/internal/opcode"
+	"github.com/VannRR/golox/internal/token"
+	"github.com/VannRR/golox/internal/value"
+	"testing"
+)
+
+func Test_MarshalBinary_roundTrip(t *testing.T) {
+	ch := NewChunk()
+	for i, v := range []value.Value{value.NumberVal(1.5), value.BoolVal(true), value.NilVal{}} {
+		index := ch.AddConstant(v)
+		ch.WriteIndexWithCheck(index, opcode.Constant, i+1)
+	}
+	ch.WriteWithSpan(opcode.Return, token.Span{Line: 70_000, Column: 3, Offset: 900_000, Length: 6})
+
+	data, err := ch.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Expected no error marshaling chunk, got '%v'.", err)
+	}
+
+	decoded := NewChunk()
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Expected no error unmarshaling chunk, got '%v'.", err)
+	}
+
+	expectCodeCount(t, decoded, ch.Count())
+	for i := range ch.Code {
+		expectOpCodeAtIndex(t, decoded, ch.Code[i], i)
+		if decoded.GetSpan(i) != ch.GetSpan(i) {
+			t.Errorf("Expected span '%v' at index %v, got '%v'.", ch.GetSpan(i), i, decoded.GetSpan(i))
+		}
+	}
+
+	expectConstantCount(t, decoded, ch.Constants.Count())
+	for i, constant := range ch.Constants {
+		expectConstantAtIndex(t, decoded, constant, i)
+	}
+}
+
+func Test_UnmarshalBinary_version1(t *testing.T) {
+	data := append([]byte(Magic), 0, 1, 2, opcode.Nil, opcode.Return, 1, 7, 2, 0)
+
+	ch := NewChunk()
+	if err := ch.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Expected no error unmarshaling version 1 chunk, got '%v'.", err)
+	}
+
+	expectCodeCount(t, ch, 2)
+	if span := ch.GetSpan(1); span != (token.Span{Line: 7}) {
+		t.Errorf("Expected span with only line 7, got '%v'.", span)
+	}
+}
+
+func Test_UnmarshalBinary_errors(t *testing.T) {
+	valid, err := NewChunk().MarshalBinary()
+	if err != nil {
+		t.Fatalf("Expected no error marshaling chunk, got '%v'.", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"bad magic", []byte("LOXX\x00\x01\x00\x00\x00")},
+		{"missing version", []byte(Magic)},
+		{"bad version", append([]byte(Magic), 0xff, 0xff, 0, 0, 0)},
+		{"truncated code", append([]byte(Magic), 0, 1, 5, opcode.Nil)},
+		{"unknown constant tag", append([]byte(Magic), 0, 1, 0, 0, 1, 0xee, 0)},
+		{"bad number constant", append([]byte(Magic), 0, 1, 0, 0, 1, ConstantNumber, 1, 0)},
+		{"trailing bytes", append(append([]byte{}, valid...), 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewChunk().UnmarshalBinary(tt.data)
+			if !errors.Is(err, ErrInvalidFormat) {
+				t.Errorf("Expected ErrInvalidFormat, got '%v'.", err)
+			}
+		})
+	}
+}
+
+type unknownConstant struct{ value.NilVal }
+
+func Test_MarshalBinary_unknownConstant(t *testing.T) {
+	ch := NewChunk()
+	ch.AddConstant(unknownConstant{})
+
+	if _, err := ch.MarshalBinary(); err == nil {
+		t.Errorf("Expected an error marshaling an unknown constant type.")
+	}
+}
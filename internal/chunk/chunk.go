@@ -3,18 +3,20 @@ package chunk
 import (
 	"fmt"
 	"github.com/VannRR/golox/internal/common"
+	"github.com/VannRR/golox/internal/token"
 	"github.com/VannRR/golox/internal/value"
 )
 
 type LineInfo struct {
-	line  uint16
-	count uint16
+	span  token.Span
+	count int
 }
 
 type Chunk struct {
 	Code      []byte
 	lineInfo  []LineInfo
 	Constants value.ValueArray
+	locals    []LocalInfo
 }
 
 func NewChunk() *Chunk {
@@ -29,37 +31,67 @@ func (c *Chunk) Count() int {
 	return len(c.Code)
 }
 
-func (c *Chunk) GetLine(codeIndex int) uint16 {
+func (c *Chunk) GetLine(codeIndex int) int {
+	return c.GetSpan(codeIndex).Line
+}
+
+// GetSpan returns the source span of the token that emitted the byte at
+// codeIndex, or the zero span if the index is out of range.
+func (c *Chunk) GetSpan(codeIndex int) token.Span {
 	if codeIndex < 0 || codeIndex >= len(c.Code) {
-		return 0
+		return token.Span{}
 	}
 
-	var cumulativeIndex uint16 = 0
+	cumulativeIndex := 0
 	for _, l := range c.lineInfo {
 		cumulativeIndex += l.count
-		if cumulativeIndex > uint16(codeIndex) {
-			return l.line
+		if cumulativeIndex > codeIndex {
+			return l.span
 		}
 	}
 
-	return 0
+	return token.Span{}
 }
 
 func (c *Chunk) Free() {
 	c.Code = c.Code[:0]
 	c.lineInfo = c.lineInfo[:0]
+	c.locals = c.locals[:0]
 	c.Constants.Free()
 }
 
-func (c *Chunk) WriteIndexWithCheck(index int, opcode byte, line uint16) {
+func (c *Chunk) Truncate(count int) {
+	if count < 0 || count >= len(c.Code) {
+		return
+	}
+
+	remaining := len(c.Code) - count
+	for remaining > 0 {
+		last := len(c.lineInfo) - 1
+		if c.lineInfo[last].count > remaining {
+			c.lineInfo[last].count -= remaining
+			break
+		}
+		remaining -= c.lineInfo[last].count
+		c.lineInfo = c.lineInfo[:last]
+	}
+
+	c.Code = c.Code[:count]
+}
+
+func (c *Chunk) WriteIndexWithCheck(index int, opcode byte, line int) {
+	c.WriteIndexWithSpan(index, opcode, token.Span{Line: line})
+}
+
+func (c *Chunk) WriteIndexWithSpan(index int, opcode byte, span token.Span) {
 	if index <= common.Uint8Max {
-		c.Write(opcode, line)
-		c.Write(byte(index), line)
+		c.WriteWithSpan(opcode, span)
+		c.WriteWithSpan(byte(index), span)
 	} else if index <= common.Uint24Max {
-		c.Write(opcode+1, line)
-		c.Write(byte(index>>16), line)
-		c.Write(byte(index>>8), line)
-		c.Write(byte(index), line)
+		c.WriteWithSpan(opcode+1, span)
+		c.WriteWithSpan(byte(index>>16), span)
+		c.WriteWithSpan(byte(index>>8), span)
+		c.WriteWithSpan(byte(index), span)
 	} else {
 		msg := fmt.Sprintf("Too many constants (%d), must be less than (%d)", index, common.Uint24Max+1)
 		panic(msg)
@@ -71,10 +103,14 @@ func (c *Chunk) AddConstant(value value.Value) int {
 	return c.Constants.Count() - 1
 }
 
-func (c *Chunk) Write(byte byte, line uint16) {
+func (c *Chunk) Write(byte byte, line int) {
+	c.WriteWithSpan(byte, token.Span{Line: line})
+}
+
+func (c *Chunk) WriteWithSpan(byte byte, span token.Span) {
 	c.Code = append(c.Code, byte)
-	if last := len(c.lineInfo) - 1; len(c.lineInfo) == 0 || c.lineInfo[last].line != line {
-		c.lineInfo = append(c.lineInfo, LineInfo{line: line, count: 1})
+	if last := len(c.lineInfo) - 1; len(c.lineInfo) == 0 || c.lineInfo[last].span != span {
+		c.lineInfo = append(c.lineInfo, LineInfo{span: span, count: 1})
 	} else {
 		c.lineInfo[last].count++
 	}
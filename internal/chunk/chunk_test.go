@@ -2,6 +2,7 @@ package chunk
 
 import (
 	"github.com/VannRR/golox/internal/opcode"
+	"github.com/VannRR/golox/internal/token"
 	"github.com/VannRR/golox/internal/value"
 	"testing"
 )
@@ -31,6 +32,31 @@ func Test_GetLine(t *testing.T) {
 	}
 }
 
+func Test_GetSpan(t *testing.T) {
+	ch := NewChunk()
+	span := token.Span{Line: 70_000, Column: 12, Offset: 1_000_000, Length: 3}
+
+	ch.Write(opcode.Nil, 1)
+	ch.WriteWithSpan(opcode.Pop, span)
+	ch.WriteWithSpan(opcode.Return, span)
+
+	if actual := ch.GetSpan(2); actual != span {
+		t.Errorf("Expected span '%v', got '%v'.", span, actual)
+	}
+
+	if line := ch.GetLine(1); line != 70_000 {
+		t.Errorf("Expected line number '70000', got '%v'.", line)
+	}
+
+	if len(ch.lineInfo) != 2 {
+		t.Errorf("Expected equal spans to share LineInfo, got '%v' entries.", len(ch.lineInfo))
+	}
+
+	if actual := ch.GetSpan(3); actual != (token.Span{}) {
+		t.Errorf("Expected zero span out of range, got '%v'.", actual)
+	}
+}
+
 func Test_Free(t *testing.T) {
 	ch := NewChunk()
 
@@ -48,10 +74,32 @@ func Test_Free(t *testing.T) {
 	}
 }
 
+func Test_Truncate(t *testing.T) {
+	ch := NewChunk()
+	ch.Write(opcode.Nil, 1)
+	ch.Write(opcode.Nil, 2)
+	ch.Write(opcode.Pop, 2)
+	ch.Write(opcode.Pop, 3)
+
+	ch.Truncate(2)
+
+	expectCodeCount(t, ch, 2)
+
+	if len(ch.lineInfo) != 2 {
+		t.Fatalf("Expected LineInfo slice length of '2', got '%v'.", len(ch.lineInfo))
+	}
+
+	ch.Write(opcode.Return, 2)
+
+	if line := ch.GetLine(2); line != 2 {
+		t.Errorf("Expected line number '2', got '%v'.", line)
+	}
+}
+
 func Test_WriteIndexWithCheck(t *testing.T) {
 	ch := NewChunk()
 	globalVar := value.NumberVal(420)
-	var line uint16 = 123
+	line := 123
 	index := ch.AddConstant(globalVar)
 	ch.WriteIndexWithCheck(index, opcode.Constant, line)
 
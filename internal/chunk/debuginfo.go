@@ -0,0 +1,55 @@
+package chunk
+
+// LocalInfo names the stack slot of a local variable for debuggers, the
+// local holds its value from code offset Start up to End, or to the end of
+// the chunk when End is -1. It isn't written by MarshalBinary.
+type LocalInfo struct {
+	Name  string
+	Slot  int
+	Start int
+	End   int
+}
+
+// AddLocal records that the local in slot holds a value from the next
+// instruction on.
+func (c *Chunk) AddLocal(name string, slot int) {
+	c.locals = append(c.locals, LocalInfo{Name: name, Slot: slot, Start: len(c.Code), End: -1})
+}
+
+// EndLocal records that the local in slot went out of scope at the current
+// end of the code.
+func (c *Chunk) EndLocal(slot int) {
+	for i := len(c.locals) - 1; i >= 0; i-- {
+		if c.locals[i].Slot == slot && c.locals[i].End == -1 {
+			c.locals[i].End = len(c.Code)
+			return
+		}
+	}
+}
+
+// LocalsAt returns the locals that hold a value when the instruction at
+// offset is about to run, in slot order.
+func (c *Chunk) LocalsAt(offset int) []LocalInfo {
+	locals := make([]LocalInfo, 0)
+	for _, local := range c.locals {
+		if local.Start <= offset && (local.End == -1 || offset < local.End) {
+			locals = append(locals, local)
+		}
+	}
+	return locals
+}
+
+// Instructions returns the offset of every instruction in the chunk, up to
+// the first one that can't be decoded.
+func (c *Chunk) Instructions() []int {
+	offsets := make([]int, 0)
+	for offset := 0; offset < len(c.Code); {
+		in, err := c.decode(offset)
+		if err != nil {
+			break
+		}
+		offsets = append(offsets, offset)
+		offset += in.length
+	}
+	return offsets
+}
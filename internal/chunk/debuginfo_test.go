@@ -0,0 +1,46 @@
+package chunk
+
+import (
+	"fmt"
+	"github.com/VannRR/golox/internal/opcode"
+	"github.com/VannRR/golox/internal/value"
+	"testing"
+)
+
+func Test_LocalsAt(t *testing.T) {
+	ch := &Chunk{Code: []byte{opcode.Nil}}
+	ch.AddLocal("a", 0)
+	ch.Code = append(ch.Code, opcode.Nil)
+	ch.AddLocal("b", 1)
+	ch.Code = append(ch.Code, opcode.Pop)
+	ch.EndLocal(1)
+	ch.Code = append(ch.Code, opcode.Return)
+
+	tests := []struct {
+		offset   int
+		expected string
+	}{
+		{offset: 0, expected: "[]"},
+		{offset: 1, expected: "[{a 0 1 -1}]"},
+		{offset: 2, expected: "[{a 0 1 -1} {b 1 2 3}]"},
+		{offset: 3, expected: "[{a 0 1 -1}]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(ch.LocalsAt(tt.offset)); got != tt.expected {
+			t.Errorf("LocalsAt(%d) = %s, expected %s", tt.offset, got, tt.expected)
+		}
+	}
+}
+
+func Test_Instructions(t *testing.T) {
+	ch := &Chunk{Code: []byte{
+		opcode.Constant, 0,
+		opcode.LessLocalJumpIfFalse, 0, 1, 0, 1,
+		opcode.Pop,
+		opcode.Return,
+		opcode.Call,
+	}, Constants: []value.Value{value.NumberVal(0), value.NumberVal(1)}}
+	if got := fmt.Sprint(ch.Instructions()); got != "[0 2 7 8]" {
+		t.Errorf("Instructions() = %s, expected [0 2 7 8] stopping at the truncated call", got)
+	}
+}
@@ -0,0 +1,245 @@
+package chunk
+
+import (
+	"fmt"
+	"github.com/VannRR/golox/internal/opcode"
+)
+
+type VerifyError struct {
+	Offset  int
+	Opcode  byte
+	Message string
+}
+
+func (e *VerifyError) Error() string {
+	name, exists := opcode.Name[e.Opcode]
+	if !exists {
+		name = fmt.Sprintf("opcode %d", e.Opcode)
+	}
+	return fmt.Sprintf("invalid bytecode at offset %04d (%s): %s", e.Offset, name, e.Message)
+}
+
+// verifiable is implemented by constants that carry their own bytecode, such
+// as functions, so Verify can check them too.
+type verifiable interface {
+	Verify() error
+}
+
+type instruction struct {
+	op       byte
+	length   int
+	index    int
+	slot     int
+	jump     int
+	pops     int
+	pushes   int
+	branches bool
+}
+
+// Verify checks that the chunk can be run without the VM reading outside of
+// its code, constants or stack: every instruction must be known and
+// complete, operands must be in range, jumps must land on an instruction and
+// every path must reach a Return with the same stack depth at each merge.
+func (c *Chunk) Verify() error {
+	return c.verify(0, 0)
+}
+
+// VerifyFunction is like Verify for the body of a function, which starts with
+// the callee and its arguments on the stack and returns a value.
+func (c *Chunk) VerifyFunction(arity int) error {
+	return c.verify(arity+1, 1)
+}
+
+func (c *Chunk) verify(initialDepth int, returnPops int) error {
+	if len(c.Code) == 0 {
+		return &VerifyError{Offset: 0, Message: "chunk has no code"}
+	}
+
+	instructions := make(map[int]instruction)
+	for offset := 0; offset < len(c.Code); {
+		in, err := c.decode(offset)
+		if err != nil {
+			return err
+		}
+		instructions[offset] = in
+		offset += in.length
+	}
+
+	depths := make(map[int]int)
+	worklist := []int{0}
+	depths[0] = initialDepth
+
+	for len(worklist) > 0 {
+		offset := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		in := instructions[offset]
+		depth := depths[offset]
+
+		fail := func(format string, args ...any) error {
+			return &VerifyError{Offset: offset, Opcode: in.op, Message: fmt.Sprintf(format, args...)}
+		}
+
+		if in.op == opcode.Return {
+			in.pops = returnPops
+		}
+		if depth < in.pops {
+			return fail("needs %d values on the stack but only %d are there", in.pops, depth)
+		}
+		if in.slot >= 0 && in.slot >= depth {
+			return fail("local slot %d is out of range for stack depth %d", in.slot, depth)
+		}
+		if in.op == opcode.Return {
+			continue
+		}
+		depth += in.pushes - in.pops
+
+		successors := make([]int, 0, 2)
+		if in.op != opcode.Jump && in.op != opcode.Loop {
+			successors = append(successors, offset+in.length)
+		}
+		if in.branches {
+			successors = append(successors, offset+in.length+in.jump)
+		}
+
+		for _, next := range successors {
+			if next == len(c.Code) {
+				return fail("execution runs past the end of the chunk")
+			}
+			if _, exists := instructions[next]; !exists {
+				return fail("jump target %d is not the start of an instruction", next)
+			}
+			if seen, exists := depths[next]; exists {
+				if seen != depth {
+					return fail("stack depth %d at offset %04d doesn't match %d from an earlier path", depth, next, seen)
+				}
+				continue
+			}
+			depths[next] = depth
+			worklist = append(worklist, next)
+		}
+	}
+
+	for i, constant := range c.Constants {
+		if v, ok := constant.(verifiable); ok {
+			if err := v.Verify(); err != nil {
+				return fmt.Errorf("constant %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Chunk) decode(offset int) (instruction, error) {
+	op := c.Code[offset]
+	in := instruction{op: op, length: 1, index: -1, slot: -1}
+
+	fail := func(format string, args ...any) (instruction, error) {
+		return in, &VerifyError{Offset: offset, Opcode: op, Message: fmt.Sprintf(format, args...)}
+	}
+
+	operands := 0
+	switch op {
+	case opcode.Constant, opcode.GetGlobal, opcode.DefineGlobal, opcode.SetGlobal,
+		opcode.GetLocal, opcode.SetLocal, opcode.Call:
+		operands = 1
+	case opcode.ConstantLong, opcode.GetGlobalLong, opcode.DefineGlobalLong, opcode.SetGlobalLong,
+		opcode.GetLocalLong, opcode.SetLocalLong:
+		operands = 3
+	case opcode.Jump, opcode.JumpIfFalse, opcode.Loop, opcode.IncrementLocal:
+		operands = 2
+	case opcode.LessLocalJumpIfFalse:
+		operands = 4
+	case opcode.Nil, opcode.True, opcode.False, opcode.Pop,
+		opcode.Equal, opcode.NotEqual, opcode.Greater, opcode.GreaterEqual,
+		opcode.Less, opcode.LessEqual, opcode.Add, opcode.Subtract,
+		opcode.Multiply, opcode.Divide, opcode.Not, opcode.Modulo,
+		opcode.Negate, opcode.Print, opcode.Return:
+	default:
+		return fail("unknown opcode")
+	}
+
+	if offset+1+operands > len(c.Code) {
+		return fail("needs %d operand bytes but only %d remain", operands, len(c.Code)-offset-1)
+	}
+	in.length += operands
+	operand := c.Code[offset+1 : offset+1+operands]
+
+	readIndex := func() int {
+		if len(operand) == 1 {
+			return int(operand[0])
+		}
+		return int(operand[0])<<16 | int(operand[1])<<8 | int(operand[2])
+	}
+	readJump := func(bytes []byte) int {
+		return int(bytes[0])<<8 | int(bytes[1])
+	}
+
+	switch op {
+	case opcode.Constant, opcode.ConstantLong:
+		in.index = readIndex()
+		in.pushes = 1
+	case opcode.GetGlobal, opcode.GetGlobalLong:
+		in.index = readIndex()
+		in.pops, in.pushes = 1, 1
+	case opcode.DefineGlobal, opcode.DefineGlobalLong:
+		in.index = readIndex()
+		in.pops = 2
+	case opcode.SetGlobal, opcode.SetGlobalLong:
+		in.index = readIndex()
+		in.pops, in.pushes = 2, 1
+	case opcode.GetLocal, opcode.GetLocalLong:
+		in.slot = readIndex()
+		in.pushes = 1
+	case opcode.SetLocal, opcode.SetLocalLong:
+		in.slot = readIndex()
+		in.pops, in.pushes = 1, 1
+	case opcode.Nil, opcode.True, opcode.False:
+		in.pushes = 1
+	case opcode.Call:
+		in.pops, in.pushes = int(operand[0])+1, 1
+	case opcode.Pop, opcode.Print:
+		in.pops = 1
+	case opcode.Equal, opcode.NotEqual, opcode.Greater, opcode.GreaterEqual,
+		opcode.Less, opcode.LessEqual, opcode.Add, opcode.Subtract,
+		opcode.Multiply, opcode.Divide, opcode.Modulo:
+		in.pops, in.pushes = 2, 1
+	case opcode.Not, opcode.Negate:
+		in.pops, in.pushes = 1, 1
+	case opcode.Jump:
+		in.jump = readJump(operand)
+		in.branches = true
+	case opcode.JumpIfFalse:
+		in.jump = readJump(operand)
+		in.pops, in.pushes = 1, 1
+		in.branches = true
+	case opcode.Loop:
+		in.jump = -readJump(operand)
+		in.branches = true
+	case opcode.IncrementLocal:
+		in.slot = int(operand[0])
+		in.index = int(operand[1])
+	case opcode.LessLocalJumpIfFalse:
+		in.slot = int(operand[0])
+		in.index = int(operand[1])
+		in.jump = readJump(operand[2:])
+		in.pushes = 1
+		in.branches = true
+	}
+
+	if in.index >= len(c.Constants) {
+		return fail("constant index %d is out of range for %d constants", in.index, len(c.Constants))
+	}
+	if in.index >= 0 && op != opcode.Constant && op != opcode.ConstantLong &&
+		op != opcode.IncrementLocal && op != opcode.LessLocalJumpIfFalse &&
+		!c.Constants[in.index].IsString() {
+		return fail("global name constant %d is not a string", in.index)
+	}
+	if in.branches {
+		if target := offset + in.length + in.jump; target < 0 || target > len(c.Code) {
+			return fail("jump target %d is outside the chunk of %d bytes", target, len(c.Code))
+		}
+	}
+
+	return in, nil
+}
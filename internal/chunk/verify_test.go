@@ -0,0 +1,119 @@
+package chunk
+
+import (
+	"errors"
+	"github.com/VannRR/golox/internal/opcode"
+	"github.com/VannRR/golox/internal/value"
+	"strings"
+	"testing"
+)
+
+func Test_Verify(t *testing.T) {
+	ch := &Chunk{
+		Code: []byte{
+			opcode.Constant, 0,
+			opcode.LessLocalJumpIfFalse, 0, 1, 0, 7,
+			opcode.Pop,
+			opcode.IncrementLocal, 0, 2,
+			opcode.Loop, 0, 12,
+			opcode.Pop,
+			opcode.Pop,
+			opcode.Constant, 3,
+			opcode.Constant, 0,
+			opcode.DefineGlobal, 3,
+			opcode.Return,
+		},
+		Constants: []value.Value{
+			value.NumberVal(0), value.NumberVal(10), value.NumberVal(1), stringConstant("a"),
+		},
+	}
+
+	if err := ch.Verify(); err != nil {
+		t.Errorf("Expected valid chunk, got '%v'.", err)
+	}
+}
+
+func Test_VerifyFunction(t *testing.T) {
+	ch := &Chunk{
+		Code: []byte{
+			opcode.GetLocal, 2,
+			opcode.GetLocal, 0,
+			opcode.Call, 1,
+			opcode.Return,
+		},
+	}
+
+	if err := ch.VerifyFunction(2); err != nil {
+		t.Errorf("Expected valid function body, got '%v'.", err)
+	}
+
+	if err := ch.VerifyFunction(1); err == nil || !strings.Contains(err.Error(), "local slot 2") {
+		t.Errorf("Expected an error about local slot 2, got '%v'.", err)
+	}
+
+	if err := ch.Verify(); err == nil {
+		t.Errorf("Expected the function body to be invalid as a script")
+	}
+}
+
+func Test_Verify_errors(t *testing.T) {
+	numbers := []value.Value{value.NumberVal(1)}
+
+	tests := []struct {
+		name      string
+		code      []byte
+		constants []value.Value
+		offset    int
+		message   string
+	}{
+		{"empty", []byte{}, nil, 0, "no code"},
+		{"unknown opcode", []byte{0xfe}, nil, 0, "unknown opcode"},
+		{"truncated long operand", []byte{opcode.ConstantLong, 0, 0}, numbers, 0, "operand bytes"},
+		{"constant out of range", []byte{opcode.Constant, 1, opcode.Return}, numbers, 0, "constant index 1"},
+		{"global name not a string", []byte{opcode.Constant, 0, opcode.GetGlobal, 0, opcode.Return}, numbers, 2, "not a string"},
+		{"local out of range", []byte{opcode.GetLocal, 0, opcode.Return}, nil, 0, "local slot 0"},
+		{"stack underflow", []byte{opcode.Pop, opcode.Return}, nil, 0, "needs 1 values"},
+		{"jump past end", []byte{opcode.Jump, 0, 9, opcode.Return}, nil, 0, "outside the chunk"},
+		{"jump into operand", []byte{opcode.Jump, 0, 1, opcode.Constant, 0, opcode.Return}, numbers, 0, "not the start of an instruction"},
+		{"loop before start", []byte{opcode.Loop, 0, 4, opcode.Return}, nil, 0, "outside the chunk"},
+		{"falls off end", []byte{opcode.Nil}, nil, 0, "past the end"},
+		{"call without callee", []byte{opcode.Nil, opcode.Call, 1, opcode.Return}, nil, 1, "needs 2 values"},
+		{"unbalanced merge", []byte{
+			opcode.True,
+			opcode.JumpIfFalse, 0, 1,
+			opcode.Nil,
+			opcode.Return,
+		}, nil, 4, "doesn't match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &Chunk{Code: tt.code, Constants: tt.constants}
+
+			err := ch.Verify()
+
+			var verifyErr *VerifyError
+			if !errors.As(err, &verifyErr) {
+				t.Fatalf("Expected a VerifyError, got '%v'.", err)
+			}
+			if verifyErr.Offset != tt.offset {
+				t.Errorf("Expected error at offset %d, got %d.", tt.offset, verifyErr.Offset)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("Expected error containing '%s', got '%v'.", tt.message, err)
+			}
+		})
+	}
+}
+
+type stringConstant string
+
+func (s stringConstant) String() string                 { return string(s) }
+func (s stringConstant) IsEqual(other value.Value) bool { return false }
+func (s stringConstant) IsFalsey() bool                 { return false }
+func (s stringConstant) IsType(other value.Value) bool  { return other.IsString() }
+func (s stringConstant) IsBool() bool                   { return false }
+func (s stringConstant) IsNil() bool                    { return false }
+func (s stringConstant) IsNumber() bool                 { return false }
+func (s stringConstant) IsString() bool                 { return true }
+func (s stringConstant) IsFunction() bool               { return false }
@@ -0,0 +1,534 @@
+package compiler
+
+import (
+	"fmt"
+	"github.com/VannRR/golox/internal/ast"
+	"github.com/VannRR/golox/internal/chunk"
+	"github.com/VannRR/golox/internal/common"
+	"github.com/VannRR/golox/internal/debug"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/object"
+	"github.com/VannRR/golox/internal/opcode"
+	"github.com/VannRR/golox/internal/token"
+	"github.com/VannRR/golox/internal/value"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// generator walks a syntax tree and writes its bytecode, collecting the
+// symbols and lint warnings of the tree as it goes. Trees with syntax errors
+// are walked too so tools still get the rest of the file.
+type generator struct {
+	chunk       *chunk.Chunk
+	compiler    *Compiler
+	diagnostics []diagnostic.Diagnostic
+	lint        lintState
+	symbols     SymbolTable
+}
+
+// newGenerator writes into ch, diagnostics are the syntax errors found while
+// parsing.
+func newGenerator(ch *chunk.Chunk, co *Compiler, diagnostics []diagnostic.Diagnostic) *generator {
+	return &generator{
+		chunk:       ch,
+		compiler:    co,
+		diagnostics: append([]diagnostic.Diagnostic{}, diagnostics...),
+	}
+}
+
+func (g *generator) file(file *ast.File) {
+	for _, statement := range file.Statements {
+		g.statement(statement)
+	}
+	g.emitReturn(file.Eof)
+
+	if debug.PrintCode && len(g.diagnostics) == 0 {
+		debug.DisassembleChunk(g.chunk, "code")
+	}
+}
+
+// errors returns the syntax and compile errors in source order.
+func (g *generator) errors() []diagnostic.Diagnostic {
+	sort.SliceStable(g.diagnostics, func(i, j int) bool {
+		return g.diagnostics[i].Span.Offset < g.diagnostics[j].Span.Offset
+	})
+	return g.diagnostics
+}
+
+func (g *generator) statement(statement ast.Stmt) {
+	switch s := statement.(type) {
+	case *ast.ExpressionStmt:
+		start := g.chunk.Count()
+		g.expression(s.Expression)
+		writeExpressionPop(g.chunk, start, s.Semicolon.Span())
+	case *ast.PrintStmt:
+		g.expression(s.Expression)
+		g.emitByte(opcode.Print, s.Semicolon)
+	case *ast.VarStmt:
+		g.varStatement(s)
+	case *ast.BlockStmt:
+		g.beginScope()
+		g.block(s)
+		g.endScope(s.RightBrace)
+	case *ast.IfStmt:
+		g.ifStatement(s)
+	case *ast.WhileStmt:
+		g.whileStatement(s)
+	case *ast.ForStmt:
+		g.forStatement(s)
+	case *ast.FunStmt:
+		global := g.parseVariable(s.Name)
+		// The name is in scope in the body so the function can call itself,
+		// defineVariable records the local once it holds the function.
+		if g.compiler.scopeDepth > 0 {
+			g.compiler.locals[g.compiler.localCount-1].depth = g.compiler.scopeDepth
+		}
+		g.function(s)
+		g.defineVariable(global, s.Body.RightBrace)
+	case *ast.ReturnStmt:
+		if g.compiler.functionType == TypeScript {
+			g.error(s.Keyword, diagnostic.CodeInvalidReturn, "Can't return from top-level code.")
+		}
+		if s.Value == nil {
+			g.emitReturn(s.Semicolon)
+		} else {
+			g.expression(s.Value)
+			g.emitByte(opcode.Return, s.Semicolon)
+		}
+	default:
+		panic(fmt.Sprintf("generator, unknown statement %T", statement))
+	}
+}
+
+func (g *generator) varStatement(s *ast.VarStmt) {
+	global := g.parseVariable(s.Name)
+	if s.Initializer != nil {
+		g.expression(s.Initializer)
+	} else {
+		g.emitByte(opcode.Nil, s.Name)
+	}
+	g.defineVariable(global, s.Semicolon)
+}
+
+func (g *generator) block(s *ast.BlockStmt) {
+	reachable, reported := true, false
+	for _, statement := range s.Statements {
+		if !reachable && !reported {
+			g.warn(statement.Span(), diagnostic.CodeUnreachableCode, "Unreachable code after 'return'.")
+			reported = true
+		}
+		if _, isReturn := statement.(*ast.ReturnStmt); isReturn {
+			reachable = false
+		}
+		g.statement(statement)
+	}
+}
+
+func (g *generator) ifStatement(s *ast.IfStmt) {
+	conditionStart := g.chunk.Count()
+	g.expression(s.Condition)
+
+	g.checkConstantCondition(conditionStart, false)
+	thenJump := writeConditionJump(g.chunk, conditionStart, s.RightParen.Span())
+	g.emitByte(opcode.Pop, s.RightParen)
+	g.statement(s.Then)
+
+	thenEnd := s.Then.End()
+	elseJump := g.emitJump(opcode.Jump, thenEnd)
+
+	g.patchJump(thenJump, thenEnd)
+	g.emitByte(opcode.Pop, thenEnd)
+
+	end := thenEnd
+	if s.Else != nil {
+		g.statement(s.Else)
+		end = s.Else.End()
+	}
+	g.patchJump(elseJump, end)
+}
+
+func (g *generator) whileStatement(s *ast.WhileStmt) {
+	loopStart := g.chunk.Count()
+	g.expression(s.Condition)
+
+	g.checkConstantCondition(loopStart, true)
+	exitJump := writeConditionJump(g.chunk, loopStart, s.RightParen.Span())
+	g.emitByte(opcode.Pop, s.RightParen)
+	g.statement(s.Body)
+
+	end := s.Body.End()
+	g.emitLoop(loopStart, end)
+	g.patchJump(exitJump, end)
+	g.emitByte(opcode.Pop, end)
+}
+
+func (g *generator) forStatement(s *ast.ForStmt) {
+	g.beginScope()
+	if s.Initializer != nil {
+		g.statement(s.Initializer)
+	}
+
+	loopStart := g.chunk.Count()
+	exitJump := -1
+	if s.Condition != nil {
+		g.expression(s.Condition)
+		g.checkConstantCondition(loopStart, true)
+		exitJump = writeConditionJump(g.chunk, loopStart, s.ConditionSemicolon.Span())
+		g.emitByte(opcode.Pop, s.ConditionSemicolon)
+	}
+
+	if s.Increment != nil {
+		bodyJump := g.emitJump(opcode.Jump, s.ConditionSemicolon)
+		incrementStart := g.chunk.Count()
+		g.expression(s.Increment)
+		writeExpressionPop(g.chunk, incrementStart, s.Increment.End().Span())
+
+		g.emitLoop(loopStart, s.RightParen)
+		loopStart = incrementStart
+		g.patchJump(bodyJump, s.RightParen)
+	}
+
+	g.statement(s.Body)
+	end := s.Body.End()
+	g.emitLoop(loopStart, end)
+
+	if exitJump != -1 {
+		g.patchJump(exitJump, end)
+		g.emitByte(opcode.Pop, end)
+	}
+
+	g.endScope(end)
+}
+
+// function generates a function's body into a chunk of its own and emits the
+// finished function as a constant of the enclosing chunk.
+func (g *generator) function(s *ast.FunStmt) {
+	enclosingChunk := g.chunk
+	g.chunk = chunk.NewChunk()
+	g.compiler = newFunctionCompiler(g.compiler, string(s.Name.Lexeme))
+	g.beginScope()
+
+	parameters := make([]string, 0, len(s.Params))
+	for _, param := range s.Params {
+		g.parseVariable(param)
+		if symbol, ok := g.symbols.lookup(param.Offset); ok {
+			symbol.Kind = SymbolParameter
+			symbol.Detail = "(parameter) " + symbol.Name
+			parameters = append(parameters, symbol.Name)
+		}
+		g.markInitialized()
+		// Parameters are part of the function's signature, so an unused
+		// one isn't worth a warning.
+		g.compiler.locals[g.compiler.localCount-1].used = true
+	}
+	if symbol, ok := g.symbols.lookup(s.Name.Offset); ok {
+		symbol.Kind = SymbolFunction
+		symbol.Detail = fmt.Sprintf("fun %s(%s)", s.Name.Lexeme, strings.Join(parameters, ", "))
+	}
+
+	g.block(s.Body)
+	g.emitReturn(s.Body.RightBrace)
+	g.checkUnusedLocals(0)
+	for i := g.compiler.localCount - 1; i > 0; i-- {
+		g.symbols.closeScope(g.compiler.locals[i].name.Offset, s.Body.RightBrace)
+	}
+
+	function := object.NewFunctionWithChunk(string(s.Name.Lexeme), len(s.Params), g.chunk)
+	if debug.PrintCode && len(g.diagnostics) == 0 {
+		debug.DisassembleChunk(g.chunk, function.Name())
+	}
+
+	g.chunk = enclosingChunk
+	g.compiler = g.compiler.enclosing
+	g.emitConstant(function, s.Body.RightBrace)
+}
+
+func (g *generator) expression(expression ast.Expr) {
+	switch e := expression.(type) {
+	case *ast.Literal:
+		g.literal(e.Token)
+	case *ast.Variable:
+		g.namedVariable(e.Name, nil)
+	case *ast.Assign:
+		g.namedVariable(e.Name, e.Value)
+	case *ast.Grouping:
+		g.expression(e.Expression)
+	case *ast.Unary:
+		g.expression(e.Right)
+		switch e.Operator.Type {
+		case token.Bang:
+			g.emitByte(opcode.Not, e.Operator)
+		case token.Minus:
+			g.emitByte(opcode.Negate, e.Operator)
+		default:
+			panic("generator, unknown unary operator")
+		}
+	case *ast.Binary:
+		g.expression(e.Left)
+		g.expression(e.Right)
+		g.emitByte(binaryOpcodes[e.Operator.Type], e.Operator)
+	case *ast.Logical:
+		g.logical(e)
+	case *ast.Call:
+		g.expression(e.Callee)
+		for _, argument := range e.Arguments {
+			g.expression(argument)
+		}
+		span := e.LeftParen.Span().To(e.RightParen.Span())
+		g.chunk.WriteWithSpan(opcode.Call, span)
+		g.chunk.WriteWithSpan(byte(len(e.Arguments)), span)
+	case *ast.BadExpr:
+		// Only found in trees with syntax errors.
+	default:
+		panic(fmt.Sprintf("generator, unknown expression %T", expression))
+	}
+}
+
+var binaryOpcodes = map[token.TokenType]byte{
+	token.BangEqual:    opcode.NotEqual,
+	token.EqualEqual:   opcode.Equal,
+	token.Greater:      opcode.Greater,
+	token.GreaterEqual: opcode.GreaterEqual,
+	token.Less:         opcode.Less,
+	token.LessEqual:    opcode.LessEqual,
+	token.Plus:         opcode.Add,
+	token.Minus:        opcode.Subtract,
+	token.Star:         opcode.Multiply,
+	token.Slash:        opcode.Divide,
+	token.Percent:      opcode.Modulo,
+}
+
+func (g *generator) literal(t token.Token) {
+	switch t.Type {
+	case token.Number:
+		v, err := strconv.ParseFloat(string(t.Lexeme), 64)
+		if err != nil {
+			panic(err)
+		}
+		g.emitConstant(value.NumberVal(v), t)
+	case token.String:
+		g.emitConstant(object.ObjString(string(t.Lexeme)[1:len(t.Lexeme)-1]), t)
+	case token.False:
+		g.emitByte(opcode.False, t)
+	case token.Nil:
+		g.emitByte(opcode.Nil, t)
+	case token.True:
+		g.emitByte(opcode.True, t)
+	default:
+		panic("generator, unknown literal")
+	}
+}
+
+func (g *generator) logical(e *ast.Logical) {
+	g.expression(e.Left)
+
+	if e.Operator.Type == token.And {
+		endJump := g.emitJump(opcode.JumpIfFalse, e.Operator)
+		g.emitByte(opcode.Pop, e.Operator)
+		g.expression(e.Right)
+		g.patchJump(endJump, e.Right.End())
+		return
+	}
+
+	elseJump := g.emitJump(opcode.JumpIfFalse, e.Operator)
+	endJump := g.emitJump(opcode.Jump, e.Operator)
+	g.patchJump(elseJump, e.Operator)
+	g.emitByte(opcode.Pop, e.Operator)
+	g.expression(e.Right)
+	g.patchJump(endJump, e.Right.End())
+}
+
+// namedVariable reads name, or assigns it when assigned isn't nil.
+func (g *generator) namedVariable(name token.Token, assigned ast.Expr) {
+	var getOp, setOp uint8
+	index := g.resolveLocal(name)
+	isLocal := index != -1
+	if isLocal {
+		getOp, setOp = opcode.GetLocal, opcode.SetLocal
+	} else {
+		index = g.identifierConstant(name)
+		getOp, setOp = opcode.GetGlobal, opcode.SetGlobal
+	}
+
+	if assigned != nil {
+		if !isLocal {
+			g.lint.globalAssignments = append(g.lint.globalAssignments, name)
+		}
+		g.referenceVariable(name, isLocal, index)
+		g.expression(assigned)
+		g.chunk.WriteIndexWithSpan(index, setOp, assigned.End().Span())
+	} else {
+		if isLocal {
+			g.compiler.locals[index].used = true
+		} else {
+			g.useGlobal(name)
+		}
+		g.referenceVariable(name, isLocal, index)
+		g.chunk.WriteIndexWithSpan(index, getOp, name.Span())
+	}
+}
+
+// referenceVariable records a use of name for the symbol table, index is the
+// local's slot when isLocal is true.
+func (g *generator) referenceVariable(name token.Token, isLocal bool, index int) {
+	symbol := -1
+	if isLocal {
+		if i, exists := g.symbols.byOffset[g.compiler.locals[index].name.Offset]; exists {
+			symbol = i
+		}
+	}
+	g.symbols.reference(name, symbol)
+}
+
+func (g *generator) resolveLocal(name token.Token) int {
+	for i := g.compiler.localCount - 1; i >= 0; i-- {
+		local := &g.compiler.locals[i]
+		if identifiersEqual(&name, &local.name) {
+			if local.depth == -1 {
+				g.error(name, diagnostic.CodeOwnInitializer, "Can't read local variable in its own initializer.")
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+func (g *generator) parseVariable(name token.Token) int {
+	g.declareVariable(name)
+	if g.compiler.scopeDepth > 0 {
+		return 0
+	}
+
+	g.declareGlobal(name)
+	g.symbols.declare(name, SymbolVariable, "var "+string(name.Lexeme), g.compiler.name, true)
+	return g.identifierConstant(name)
+}
+
+func (g *generator) identifierConstant(name token.Token) int {
+	index := g.chunk.AddConstant(object.ObjString(string(name.Lexeme)))
+	g.chunk.WriteIndexWithSpan(index, opcode.Constant, name.Span())
+	return index
+}
+
+func (g *generator) declareVariable(name token.Token) {
+	if g.compiler.scopeDepth == 0 {
+		return
+	}
+
+	for i := g.compiler.localCount - 1; i >= 0; i-- {
+		local := &g.compiler.locals[i]
+		if local.depth != -1 && local.depth < g.compiler.scopeDepth {
+			break
+		}
+		if identifiersEqual(&name, &local.name) {
+			g.error(name, diagnostic.CodeDuplicateVariable, "Already a variable with this name in this scope.")
+		}
+	}
+
+	g.checkShadowing(name)
+	g.addLocal(name)
+}
+
+func (g *generator) addLocal(name token.Token) {
+	if g.compiler.localCount >= common.Uint24Max {
+		g.error(name, diagnostic.CodeCompilerLimit, "Too many local variables in function.")
+		return
+	}
+
+	if g.compiler.localCount == len(g.compiler.locals) {
+		g.compiler.locals = append(g.compiler.locals, Local{})
+	}
+
+	local := &g.compiler.locals[g.compiler.localCount]
+	g.compiler.localCount++
+	local.name = name
+	local.depth = -1
+	g.symbols.declare(name, SymbolVariable, "var "+string(name.Lexeme), g.compiler.name, false)
+}
+
+func (g *generator) defineVariable(global int, end token.Token) {
+	if g.compiler.scopeDepth > 0 {
+		g.markInitialized()
+		return
+	}
+	g.chunk.WriteIndexWithSpan(global, opcode.DefineGlobal, end.Span())
+}
+
+func (g *generator) markInitialized() {
+	if g.compiler.scopeDepth == 0 {
+		return
+	}
+	local := &g.compiler.locals[g.compiler.localCount-1]
+	local.depth = g.compiler.scopeDepth
+	g.chunk.AddLocal(string(local.name.Lexeme), g.compiler.localCount-1)
+}
+
+func (g *generator) beginScope() {
+	g.compiler.scopeDepth++
+}
+
+// endScope pops the locals of the scope being closed, end is the token that
+// closes it.
+func (g *generator) endScope(end token.Token) {
+	g.compiler.scopeDepth--
+	g.checkUnusedLocals(g.compiler.scopeDepth)
+
+	for g.compiler.localCount > 0 &&
+		g.compiler.locals[g.compiler.localCount-1].depth > g.compiler.scopeDepth {
+		g.emitByte(opcode.Pop, end)
+		g.chunk.EndLocal(g.compiler.localCount - 1)
+		g.symbols.closeScope(g.compiler.locals[g.compiler.localCount-1].name.Offset, end)
+		g.compiler.localCount--
+	}
+}
+
+func (g *generator) error(t token.Token, code string, message string) {
+	g.diagnostics = append(g.diagnostics, diagnostic.AtToken(code, message, t, t))
+}
+
+func (g *generator) emitReturn(t token.Token) {
+	if g.compiler.functionType == TypeFunction {
+		g.emitByte(opcode.Nil, t)
+	}
+	g.emitByte(opcode.Return, t)
+}
+
+func (g *generator) emitConstant(v value.Value, t token.Token) {
+	index := g.chunk.AddConstant(v)
+	g.chunk.WriteIndexWithSpan(index, opcode.Constant, t.Span())
+}
+
+func (g *generator) emitLoop(loopStart int, t token.Token) {
+	g.emitByte(opcode.Loop, t)
+
+	offset := g.chunk.Count() - loopStart + 2
+	if offset > common.Uint16Max {
+		g.error(t, diagnostic.CodeCompilerLimit, "Loop body too large.")
+	}
+
+	g.emitByte(byte(offset>>8), t)
+	g.emitByte(byte(offset), t)
+}
+
+func (g *generator) emitJump(instruction byte, t token.Token) int {
+	g.emitByte(instruction, t)
+	g.emitByte(0xff, t)
+	g.emitByte(0xff, t)
+	return g.chunk.Count() - 2
+}
+
+func (g *generator) patchJump(offset int, t token.Token) {
+	jump := g.chunk.Count() - offset - 2
+
+	if jump > common.Uint16Max {
+		g.error(t, diagnostic.CodeCompilerLimit, "Too much code to jump over.")
+	}
+
+	g.chunk.Code[offset] = byte(jump >> 8)
+	g.chunk.Code[offset+1] = byte(jump)
+}
+
+func (g *generator) emitByte(b byte, t token.Token) {
+	g.chunk.WriteWithSpan(b, t.Span())
+}
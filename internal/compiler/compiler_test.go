@@ -2,41 +2,18 @@ package compiler
 
 import (
 	"fmt"
+	"github.com/VannRR/golox/internal/ast"
 	"github.com/VannRR/golox/internal/chunk"
+	"github.com/VannRR/golox/internal/diagnostic"
 	"github.com/VannRR/golox/internal/lexer"
 	"github.com/VannRR/golox/internal/object"
 	"github.com/VannRR/golox/internal/opcode"
+	"github.com/VannRR/golox/internal/parser"
 	"github.com/VannRR/golox/internal/token"
 	"github.com/VannRR/golox/internal/value"
 	"testing"
 )
 
-func Test_GetRule(t *testing.T) {
-	testCases := []struct {
-		tkn      token.TokenType
-		expected *ParseRule
-	}{
-		{
-			tkn:      token.Plus,
-			expected: &ParseRule{prefix: nil, infix: (*Parser).binary, precedence: PrecTerm},
-		},
-		{
-			tkn:      token.LeftParen,
-			expected: &ParseRule{prefix: (*Parser).grouping, infix: nil, precedence: PrecNone},
-		}, {
-			tkn:      token.Slash,
-			expected: &ParseRule{prefix: nil, infix: (*Parser).binary, precedence: PrecFactor},
-		},
-	}
-
-	for _, tc := range testCases {
-		r := getRule(tc.tkn)
-		if fmt.Sprint(r) != fmt.Sprint(tc.expected) {
-			t.Errorf("Expected ParseRule '%v', got '%v'.", tc.expected, r)
-		}
-	}
-}
-
 func Test_NewCompiler(t *testing.T) {
 	co := NewCompiler()
 
@@ -51,26 +28,17 @@ func Test_NewCompiler(t *testing.T) {
 	}
 }
 
-func Test_NewParser(t *testing.T) {
-	s := []byte("var foo = 1;")
-	l := lexer.NewLexer(&s)
-	co := NewCompiler()
-	ch := chunk.NewChunk()
+func Test_newGenerator(t *testing.T) {
+	ch, co := chunk.NewChunk(), NewCompiler()
+	syntaxErrors := []diagnostic.Diagnostic{{Code: diagnostic.CodeSyntax}}
 
-	p := NewParser(l, ch, co)
+	g := newGenerator(ch, co, syntaxErrors)
 
-	expected := &Parser{
-		lexer:     l,
-		chunk:     ch,
-		compiler:  co,
-		current:   token.Token{},
-		previous:  token.Token{},
-		hadError:  false,
-		panicMode: false,
+	if g.chunk != ch || g.compiler != co {
+		t.Errorf("Expected newGenerator to write into the given chunk and compiler.")
 	}
-
-	if fmt.Sprint(p) != fmt.Sprint(expected) {
-		t.Errorf("Expected NewParser '%v', got '%v'.", expected, p)
+	if fmt.Sprint(g.diagnostics) != fmt.Sprint(syntaxErrors) {
+		t.Errorf("Expected newGenerator diagnostics %v, got %v.", syntaxErrors, g.diagnostics)
 	}
 }
 
@@ -123,10 +91,10 @@ func Test_Compile(t *testing.T) {
 }
 
 func Test_printStatement(t *testing.T) {
-	input := "print"
-	p := setupParserForTest(input)
+	input := "value"
+	g := setupGeneratorForTest()
 
-	p.printStatement()
+	g.statement(&ast.PrintStmt{Expression: expressionForTest(input)})
 
 	expectedOpcodes := []byte{
 		opcode.Constant, 0,
@@ -138,15 +106,20 @@ func Test_printStatement(t *testing.T) {
 		object.ObjString(input),
 	}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_forStatement(t *testing.T) {
-	p := setupParserForTest("")
+	g := setupGeneratorForTest()
 
-	p.forStatement()
+	g.forStatement(&ast.ForStmt{
+		Initializer: &ast.ExpressionStmt{Expression: expressionForTest("")},
+		Condition:   expressionForTest(""),
+		Increment:   expressionForTest(""),
+		Body:        &ast.ExpressionStmt{Expression: expressionForTest("")},
+	})
 
 	expectedOpcodes := []byte{
 		opcode.Pop,
@@ -162,15 +135,18 @@ func Test_forStatement(t *testing.T) {
 
 	expectedConstants := []value.Value{}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_ifStatement(t *testing.T) {
-	p := setupParserForTest("")
+	g := setupGeneratorForTest()
 
-	p.ifStatement()
+	g.ifStatement(&ast.IfStmt{
+		Condition: expressionForTest(""),
+		Then:      &ast.ExpressionStmt{Expression: expressionForTest("")},
+	})
 
 	expectedOpcodes := []byte{
 		opcode.JumpIfFalse, 0, 5,
@@ -182,15 +158,18 @@ func Test_ifStatement(t *testing.T) {
 
 	expectedConstants := []value.Value{}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_whileStatement(t *testing.T) {
-	p := setupParserForTest("while (false) print 1;")
+	g := setupGeneratorForTest()
 
-	p.whileStatement()
+	g.whileStatement(&ast.WhileStmt{
+		Condition: expressionForTest(""),
+		Body:      &ast.ExpressionStmt{Expression: expressionForTest("false")},
+	})
 
 	expectedOpcodes := []byte{
 		opcode.JumpIfFalse, 0, 6,
@@ -203,15 +182,15 @@ func Test_whileStatement(t *testing.T) {
 
 	expectedConstants := []value.Value{}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_varDeclaration(t *testing.T) {
-	p := setupParserForTest("var foo;")
+	g := setupGeneratorForTest()
 
-	p.varDeclaration()
+	g.varStatement(&ast.VarStmt{Name: token.Token{Type: token.Identifier, Lexeme: []byte("")}})
 
 	expectedOpcodes := []byte{
 		opcode.Constant, 0,
@@ -223,15 +202,15 @@ func Test_varDeclaration(t *testing.T) {
 		object.ObjString(""),
 	}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_expression(t *testing.T) {
-	p := setupParserForTest("2 -3")
+	g := setupGeneratorForTest()
 
-	p.expression()
+	g.expression(expressionForTest("2 -3"))
 
 	expectedOpcodes := []byte{
 		opcode.Constant, 0,
@@ -244,15 +223,20 @@ func Test_expression(t *testing.T) {
 		value.NumberVal(3),
 	}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_block(t *testing.T) {
-	p := setupParserForTest("{var foo = 1;}")
+	g := setupGeneratorForTest()
+	s := []byte("{var foo = 1;}")
+	file, _ := parser.Parse(&s)
+	block := file.Statements[0].(*ast.BlockStmt)
+	// Starts with a statement missing its expression, which still pops.
+	block.Statements = append([]ast.Stmt{&ast.ExpressionStmt{Expression: expressionForTest("")}}, block.Statements...)
 
-	p.block()
+	g.block(block)
 
 	expectedOpcodes := []byte{
 		opcode.Pop,
@@ -266,29 +250,19 @@ func Test_block(t *testing.T) {
 		value.NumberVal(1),
 	}
 
-	if p.panicMode {
-		t.Error("Expected no panic from block")
+	if len(g.diagnostics) > 0 {
+		t.Errorf("Expected no errors from block, got %v", g.diagnostics)
 	}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
-}
-
-func Test_block_fail(t *testing.T) {
-	p := setupParserForTest("{var foo = 1;")
-
-	p.block()
-
-	if !p.panicMode {
-		t.Error("Expected panic from block without '}'.")
-	}
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_grouping(t *testing.T) {
-	p := setupParserForTest("(1 + 2)")
+	g := setupGeneratorForTest()
 
-	p.grouping(false)
+	g.expression(expressionForTest("(1 + 2)"))
 
 	expectedOpcodes := []byte{
 		opcode.Constant, 0,
@@ -301,17 +275,16 @@ func Test_grouping(t *testing.T) {
 		value.NumberVal(2),
 	}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_number(t *testing.T) {
 	input := 420
-	p := setupParserForTest("")
-	p.previous.Lexeme = []byte(fmt.Sprint(input))
+	g := setupGeneratorForTest()
 
-	p.number(false)
+	g.literal(token.Token{Type: token.Number, Lexeme: []byte(fmt.Sprint(input))})
 
 	expectedOpcodes := []byte{
 		opcode.Constant, 0,
@@ -321,15 +294,15 @@ func Test_number(t *testing.T) {
 		value.NumberVal(input),
 	}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_or(t *testing.T) {
-	p := setupParserForTest("")
+	g := setupGeneratorForTest()
 
-	p.or(false)
+	g.logical(&ast.Logical{Left: expressionForTest(""), Operator: token.Token{Type: token.Or}, Right: expressionForTest("")})
 
 	expectedOpcodes := []byte{
 		opcode.JumpIfFalse, 0, 3,
@@ -339,9 +312,9 @@ func Test_or(t *testing.T) {
 
 	expectedConstants := []value.Value{}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_variable_get(t *testing.T) {
@@ -403,54 +376,188 @@ func Test_variable_set(t *testing.T) {
 	checkConstants(t, c.Constants, expectedConstants)
 }
 
+func Test_superinstructions(t *testing.T) {
+	s := []byte(`{ for (var i = 0; i < 3; i = i + 1) { var j = i; j = j - 1; } }`)
+	c := chunk.NewChunk()
+	Compile(&s, c)
+
+	expectedOpcodes := []byte{
+		opcode.Constant, 0,
+		opcode.LessLocalJumpIfFalse, 0, 1, 0, 24,
+		opcode.Pop,
+		opcode.Jump, 0, 6,
+		opcode.IncrementLocal, 0, 2,
+		opcode.Loop, 0, 15,
+		opcode.GetLocal, 0,
+		opcode.GetLocal, 1,
+		opcode.Constant, 3,
+		opcode.Subtract,
+		opcode.SetLocal, 1,
+		opcode.Pop,
+		opcode.Pop,
+		opcode.Loop, 0, 20,
+		opcode.Pop,
+		opcode.Pop,
+		opcode.Return,
+	}
+
+	expectedConstants := []value.Value{
+		value.NumberVal(0),
+		value.NumberVal(3),
+		value.NumberVal(1),
+		value.NumberVal(1),
+	}
+
+	checkOpcodes(t, c.Code, expectedOpcodes)
+
+	checkConstants(t, c.Constants, expectedConstants)
+}
+
+func Test_binary_span(t *testing.T) {
+	s := []byte("1 +\n  2 * 3;")
+	c := chunk.NewChunk()
+	Compile(&s, c)
+
+	expected := map[int]token.Span{
+		6: {Line: 2, Column: 5, Offset: 8, Length: 1},
+		7: {Line: 1, Column: 3, Offset: 2, Length: 1},
+	}
+
+	for index, span := range expected {
+		if actual := c.GetSpan(index); actual != span {
+			t.Errorf("Expected %v at code index %v to have span %+v, got %+v.", opcode.Name[c.Code[index]], index, span, actual)
+		}
+	}
+}
+
+func Test_emitExpressionPop_differentLocals(t *testing.T) {
+	s := []byte(`{ var a = 1; var b = 2; b = a + 1; }`)
+	c := chunk.NewChunk()
+	Compile(&s, c)
+
+	expectedOpcodes := []byte{
+		opcode.Constant, 0,
+		opcode.Constant, 1,
+		opcode.GetLocal, 0,
+		opcode.Constant, 2,
+		opcode.Add,
+		opcode.SetLocal, 1,
+		opcode.Pop,
+		opcode.Pop,
+		opcode.Pop,
+		opcode.Return,
+	}
+
+	checkOpcodes(t, c.Code, expectedOpcodes)
+}
+
+func Test_funDeclaration(t *testing.T) {
+	g := setupGeneratorForTest()
+	s := []byte("fun add(a, b) { return a + b; }")
+	file, _ := parser.Parse(&s)
+	g.statement(file.Statements[0])
+
+	checkOpcodes(t, g.chunk.Code, []byte{
+		opcode.Constant, 0,
+		opcode.Constant, 1,
+		opcode.DefineGlobal, 0,
+	})
+
+	function, ok := g.chunk.Constants[1].(*object.ObjFunction)
+	if !ok {
+		t.Fatalf("Expected constant 1 to be a function, got %v", g.chunk.Constants[1])
+	}
+	if function.Name() != "add" || function.Arity() != 2 {
+		t.Errorf("Expected function add with arity 2, got %s with arity %d", function.Name(), function.Arity())
+	}
+
+	checkOpcodes(t, function.Chunk().Code, []byte{
+		opcode.GetLocal, 1,
+		opcode.GetLocal, 2,
+		opcode.Add,
+		opcode.Return,
+		opcode.Nil,
+		opcode.Return,
+	})
+
+	if g.compiler.functionType != TypeScript || g.compiler.localCount != 0 {
+		t.Errorf("Expected the script compiler to be restored after the function")
+	}
+}
+
+func Test_call(t *testing.T) {
+	g := setupGeneratorForTest()
+	g.expression(expressionForTest("f(1, 2)"))
+
+	checkOpcodes(t, g.chunk.Code, []byte{
+		opcode.Constant, 0,
+		opcode.GetGlobal, 0,
+		opcode.Constant, 1,
+		opcode.Constant, 2,
+		opcode.Call, 2,
+	})
+
+	if span := g.chunk.GetSpan(8); span.Column != 2 || span.Length != 6 {
+		t.Errorf("Expected the call to span the argument list, got %+v", span)
+	}
+}
+
+func Test_returnStatement_topLevel(t *testing.T) {
+	source := []byte("return 1;")
+	diagnostics := CompileDiagnostics(&source, chunk.NewChunk())
+
+	if len(diagnostics) != 1 || diagnostics[0].Code != diagnostic.CodeInvalidReturn {
+		t.Errorf("Expected a single %s diagnostic, got %v", diagnostic.CodeInvalidReturn, diagnostics)
+	}
+}
+
 func Test_namedVariable(t *testing.T) {
-	p := setupParserForTest("")
+	g := setupGeneratorForTest()
 
-	p.namedVariable(token.Token{Type: token.Identifier, Lexeme: []byte("myVar")}, true)
+	g.namedVariable(token.Token{Type: token.Identifier, Lexeme: []byte("myVar")}, nil)
 	expectedOne := []byte{
 		opcode.Constant, 0,
 		opcode.GetGlobal, 0,
 	}
-	checkOpcodes(t, p.chunk.Code, expectedOne)
+	checkOpcodes(t, g.chunk.Code, expectedOne)
 
-	p.namedVariable(token.Token{Type: token.Identifier, Lexeme: []byte("anotherVar")}, false)
+	g.namedVariable(token.Token{Type: token.Identifier, Lexeme: []byte("anotherVar")}, nil)
 	expectedTwo := []byte{
 		opcode.Constant, 0,
 		opcode.GetGlobal, 0,
 		opcode.Constant, 1,
 		opcode.GetGlobal, 1,
 	}
-	checkOpcodes(t, p.chunk.Code, expectedTwo)
+	checkOpcodes(t, g.chunk.Code, expectedTwo)
 }
 
 func Test_resolveLocal(t *testing.T) {
-	p := setupParserForTest("")
+	g := setupGeneratorForTest()
 
 	l := []byte("mylocal")
 
-	p.compiler.localCount = 2
+	g.compiler.localCount = 2
 
-	p.compiler.locals = append(
-		p.compiler.locals,
+	g.compiler.locals = append(
+		g.compiler.locals,
 		Local{depth: 0, name: token.Token{Type: token.Identifier, Lexeme: l}},
 	)
 
-	index := p.resolveLocal(&token.Token{Type: token.Identifier, Lexeme: l})
+	index := g.resolveLocal(token.Token{Type: token.Identifier, Lexeme: l})
 	if index != 1 {
 		t.Errorf("Expected index == 1, got %v", index)
 	}
 
-	index = p.resolveLocal(&token.Token{Type: token.Identifier, Lexeme: []byte("nonExistent")})
+	index = g.resolveLocal(token.Token{Type: token.Identifier, Lexeme: []byte("nonExistent")})
 	if index != -1 {
 		t.Errorf("Expected index == -1, got %v", index)
 	}
 }
 
 func Test_string(t *testing.T) {
-	p := setupParserForTest("")
-	p.previous.Lexeme = []byte("\"wow\"")
+	g := setupGeneratorForTest()
 
-	p.string(false)
+	g.literal(token.Token{Type: token.String, Lexeme: []byte("\"wow\"")})
 
 	expectedOpcodes := []byte{
 		opcode.Constant, 0,
@@ -460,9 +567,9 @@ func Test_string(t *testing.T) {
 		object.ObjString("wow"),
 	}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_binary(t *testing.T) {
@@ -485,11 +592,9 @@ func Test_binary(t *testing.T) {
 
 	for _, pair := range table {
 
-		p := setupParserForTest("")
-
-		p.previous.Type = pair.t
+		g := setupGeneratorForTest()
 
-		p.binary(false)
+		g.expression(&ast.Binary{Left: expressionForTest(""), Operator: token.Token{Type: pair.t}, Right: expressionForTest("")})
 
 		expectedOpcodes := []byte{
 			pair.b,
@@ -497,9 +602,9 @@ func Test_binary(t *testing.T) {
 
 		expectedConstants := []value.Value{}
 
-		checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+		checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-		checkConstants(t, p.chunk.Constants, expectedConstants)
+		checkConstants(t, g.chunk.Constants, expectedConstants)
 	}
 }
 
@@ -515,11 +620,9 @@ func Test_literal(t *testing.T) {
 
 	for _, pair := range table {
 
-		p := setupParserForTest("")
+		g := setupGeneratorForTest()
 
-		p.previous.Type = pair.t
-
-		p.literal(false)
+		g.literal(token.Token{Type: pair.t})
 
 		expectedOpcodes := []byte{
 			pair.b,
@@ -527,9 +630,9 @@ func Test_literal(t *testing.T) {
 
 		expectedConstants := []value.Value{}
 
-		checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+		checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-		checkConstants(t, p.chunk.Constants, expectedConstants)
+		checkConstants(t, g.chunk.Constants, expectedConstants)
 	}
 }
 
@@ -544,11 +647,9 @@ func Test_unary(t *testing.T) {
 
 	for _, pair := range table {
 
-		p := setupParserForTest("")
-
-		p.previous.Type = pair.t
+		g := setupGeneratorForTest()
 
-		p.unary(false)
+		g.expression(&ast.Unary{Operator: token.Token{Type: pair.t}, Right: expressionForTest("")})
 
 		expectedOpcodes := []byte{
 			pair.b,
@@ -556,40 +657,17 @@ func Test_unary(t *testing.T) {
 
 		expectedConstants := []value.Value{}
 
-		checkOpcodes(t, p.chunk.Code, expectedOpcodes)
-
-		checkConstants(t, p.chunk.Constants, expectedConstants)
-	}
-}
-
-func Test_parsePrecedence(t *testing.T) {
-	p := setupParserForTest("1 + 2")
+		checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	p.parsePrecedence(PrecTerm)
-
-	expectedOpcodes := []byte{
-		opcode.Constant, 0,
-		opcode.Constant, 1,
-		opcode.Add,
-	}
-
-	expectedConstants := []value.Value{
-		value.NumberVal(1),
-		value.NumberVal(2),
+		checkConstants(t, g.chunk.Constants, expectedConstants)
 	}
-
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
-
-	checkConstants(t, p.chunk.Constants, expectedConstants)
 }
 
 func Test_parseVariable(t *testing.T) {
 	input := "wow"
-	p := setupParserForTest(input)
-
-	p.current = p.lexer.ScanToken()
+	g := setupGeneratorForTest()
 
-	p.parseVariable([]byte("this is a test"))
+	g.parseVariable(tokenForTest(input))
 
 	expectedOpcodes := []byte{
 		opcode.Constant, 0,
@@ -599,50 +677,47 @@ func Test_parseVariable(t *testing.T) {
 		object.ObjString(input),
 	}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_parseVariable_ScopeDepthGreaterThanZero(t *testing.T) {
 	input := "anotherVar"
-	p := setupParserForTest(input)
+	g := setupGeneratorForTest()
 
-	p.current = p.lexer.ScanToken()
-	p.compiler.scopeDepth = 1
+	g.compiler.scopeDepth = 1
 
-	result := p.parseVariable([]byte("Scope depth test"))
+	result := g.parseVariable(tokenForTest(input))
 	if result != 0 {
 		t.Errorf("Expected result from parseVariable to be 0, got %v", result)
 	}
 }
 
 func Test_addLocal(t *testing.T) {
-	p := setupParserForTest("")
+	g := setupGeneratorForTest()
 
 	localVarName := token.Token{Type: token.Identifier, Lexeme: []byte("myVar")}
-	p.compiler.localCount = 0
-	p.addLocal(localVarName)
+	g.compiler.localCount = 0
+	g.addLocal(localVarName)
 
-	if p.compiler.localCount != 1 {
-		t.Errorf("Expected compiler localCount to be 1, got %v", p.compiler.localCount)
+	if g.compiler.localCount != 1 {
+		t.Errorf("Expected compiler localCount to be 1, got %v", g.compiler.localCount)
 	}
 
-	p.compiler.localCount = 999999999
-	p.addLocal(token.Token{Type: token.Identifier, Lexeme: []byte("tooManyVar")})
+	g.compiler.localCount = 999999999
+	g.addLocal(token.Token{Type: token.Identifier, Lexeme: []byte("tooManyVar")})
 
-	if p.hadError != true {
-		t.Error("Expected error from trying to add to many local variables.")
+	if len(g.diagnostics) != 1 || g.diagnostics[0].Code != diagnostic.CodeCompilerLimit {
+		t.Errorf("Expected error from trying to add to many local variables, got %v.", g.diagnostics)
 	}
 }
 
 func Test_defineVariable(t *testing.T) {
 	index := 0
-	p := setupParserForTest("wow")
-
-	p.current = p.lexer.ScanToken()
+	g := setupGeneratorForTest()
 
-	p.defineVariable(index)
+	g.defineVariable(index, tokenForTest("wow"))
 
 	expectedOpcodes := []byte{
 		opcode.DefineGlobal, byte(index),
@@ -650,15 +725,15 @@ func Test_defineVariable(t *testing.T) {
 
 	expectedConstants := []value.Value{}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_and(t *testing.T) {
-	p := setupParserForTest("")
+	g := setupGeneratorForTest()
 
-	p.and(false)
+	g.logical(&ast.Logical{Left: expressionForTest(""), Operator: token.Token{Type: token.And}, Right: expressionForTest("")})
 
 	expectedOpcodes := []byte{
 		opcode.JumpIfFalse, 0, 1,
@@ -667,147 +742,130 @@ func Test_and(t *testing.T) {
 
 	expectedConstants := []value.Value{}
 
-	checkOpcodes(t, p.chunk.Code, expectedOpcodes)
+	checkOpcodes(t, g.chunk.Code, expectedOpcodes)
 
-	checkConstants(t, p.chunk.Constants, expectedConstants)
+	checkConstants(t, g.chunk.Constants, expectedConstants)
 }
 
 func Test_error(t *testing.T) {
-	p := setupParserForTest("wow")
+	g := setupGeneratorForTest()
 
-	p.current = p.lexer.ScanToken()
+	g.error(tokenForTest("wow"), diagnostic.CodeSyntax, "this is a test error msg")
 
-	p.error([]byte("this is a test error msg"))
-
-	if p.panicMode != true {
-		t.Error("Expected Parser panicMode to be true")
-	}
-
-	if p.hadError != true {
-		t.Error("Expected Parser hadError to be true")
+	if len(g.diagnostics) != 1 || g.diagnostics[0].Message != "this is a test error msg" {
+		t.Errorf("Expected the error to be recorded, got %v", g.diagnostics)
 	}
 }
 
-func Test_match(t *testing.T) {
-	p := setupParserForTest("123")
-
-	numberToken := p.lexer.ScanToken()
-
-	p.current = numberToken
-
-	if p.match(token.Number) != true {
-		t.Error("Expected token to match type Number")
-	}
-
-	p.current = numberToken
-
-	if p.match(token.Nil) != false {
-		t.Error("Expected token to not match type Nil")
-	}
-
-}
-
-func Test_advance(t *testing.T) {
-	input := "123"
-	p := setupParserForTest(input)
-
-	p.advance()
-
-	if string(p.previous.Lexeme) != "" {
-		t.Error("Expected previous token Lexeme to be ''/(blank).")
-	}
-
-	if string(p.current.Lexeme) != input {
-		t.Errorf("Expected current token Lexeme to be '%v'.", input)
-	}
+func Test_CompileDiagnostics(t *testing.T) {
+	tests := []struct {
+		source  string
+		code    string
+		message string
+		line    int
+		column  int
+		hints   []string
+	}{
+		{"pritn 1;", diagnostic.CodeSyntax, "Expect ';' after expression.", 1, 7, []string{"did you mean `print` instead of `pritn` on line 1?"}},
+		{"print 1", diagnostic.CodeSyntax, "Expect ';' after value.", 1, 8, nil},
+		{"var 1 = 2;", diagnostic.CodeSyntax, "Expect variable name.", 1, 5, nil},
+		{"print @;", diagnostic.CodeInvalidToken, "Unrecognized character, 64 / \"@\"", 1, 7, nil},
+		{"{ var a = a; }", diagnostic.CodeOwnInitializer, "Can't read local variable in its own initializer.", 1, 11, nil},
+		{"1 + 2 = 3;", diagnostic.CodeInvalidAssignment, "Invalid assignment target.", 1, 7, nil},
+		{"{ var a; var a; }", diagnostic.CodeDuplicateVariable, "Already a variable with this name in this scope.", 1, 14, nil},
+		{"fun f() { print 1;", diagnostic.CodeSyntax, "Expect '}' after block.", 1, 19, nil},
+	}
+
+	for _, tt := range tests {
+		source := []byte(tt.source)
+		diagnostics := CompileDiagnostics(&source, chunk.NewChunk())
+
+		if len(diagnostics) != 1 {
+			t.Fatalf("Expected 1 diagnostic for %q, got %d", tt.source, len(diagnostics))
+		}
 
-	p.advance()
+		d := diagnostics[0]
+		if d.Code != tt.code {
+			t.Errorf("Expected code %s for %q, got %s", tt.code, tt.source, d.Code)
+		}
+		if d.Message != tt.message || d.Span.Line != tt.line || d.Span.Column != tt.column {
+			t.Errorf("Expected %q at %d:%d, got %q at %d:%d", tt.message, tt.line, tt.column, d.Message, d.Span.Line, d.Span.Column)
+		}
 
-	if string(p.previous.Lexeme) != input {
-		t.Errorf("Expected previous token Lexeme to be '%v'.", input)
+		if fmt.Sprint(d.Hints) != fmt.Sprint(tt.hints) {
+			t.Errorf("Expected hints %v for %q, got %v", tt.hints, tt.source, d.Hints)
+		}
 	}
 }
 
-func Test_consume(t *testing.T) {
-	input := "123"
-	msg := []byte("test consume error")
-	p := setupParserForTest(input)
-
-	p.current = p.lexer.ScanToken()
+func Test_CompileDiagnostics_order(t *testing.T) {
+	source := []byte("print ;\n{ var a; var a; }")
+	diagnostics := CompileDiagnostics(&source, chunk.NewChunk())
 
-	p.consume(token.Number, msg)
-
-	if string(p.previous.Lexeme) != input {
-		t.Errorf("Expected current token Lexeme to be '%v'.", input)
+	codes := make([]string, 0)
+	for _, d := range diagnostics {
+		codes = append(codes, d.Code)
 	}
-
-	p = setupParserForTest(input)
-
-	p.current = p.lexer.ScanToken()
-
-	p.consume(token.Nil, msg)
-
-	if p.hadError != true {
-		t.Error("Expected error to trigger for non matching token type.")
+	if fmt.Sprint(codes) != fmt.Sprint([]string{diagnostic.CodeSyntax, diagnostic.CodeDuplicateVariable}) {
+		t.Errorf("Expected the syntax error and then the duplicate variable, got %v", diagnostics)
 	}
-
 }
 
 func Test_beginScope(t *testing.T) {
-	p := setupParserForTest("")
+	g := setupGeneratorForTest()
 
-	p.beginScope()
+	g.beginScope()
 
-	if p.compiler.scopeDepth != 1 {
-		t.Errorf("Expected scopeDepth of 1, got %v.", p.compiler.scopeDepth)
+	if g.compiler.scopeDepth != 1 {
+		t.Errorf("Expected scopeDepth of 1, got %v.", g.compiler.scopeDepth)
 	}
 }
 
 func Test_endScope(t *testing.T) {
-	p := setupParserForTest("")
+	g := setupGeneratorForTest()
 
-	p.compiler.scopeDepth = 1
+	g.compiler.scopeDepth = 1
 
-	p.compiler.locals = append(p.compiler.locals,
+	g.compiler.locals = append(g.compiler.locals,
 		Local{depth: 1, name: token.Token{Type: token.Identifier, Lexeme: []byte("var1")}},
 		Local{depth: 1, name: token.Token{Type: token.Identifier, Lexeme: []byte("var2")}},
 		Local{depth: 1, name: token.Token{Type: token.Identifier, Lexeme: []byte("var3")}},
 	)
 
-	p.compiler.localCount = 3
+	g.compiler.localCount = 3
 
-	p.endScope()
+	g.endScope(token.Token{Type: token.RightBrace})
 
-	if p.compiler.scopeDepth != 0 {
-		t.Errorf("Expected scopeDepth of 0, got %v.", p.compiler.scopeDepth)
+	if g.compiler.scopeDepth != 0 {
+		t.Errorf("Expected scopeDepth of 0, got %v.", g.compiler.scopeDepth)
 	}
 
-	if p.compiler.localCount != 1 {
-		t.Errorf("Expected localCount of 1, got %v.", p.compiler.localCount)
+	if g.compiler.localCount != 1 {
+		t.Errorf("Expected localCount of 1, got %v.", g.compiler.localCount)
 	}
 }
 
 func Test_emitConstant(t *testing.T) {
-	p := setupParserForTest("")
+	g := setupGeneratorForTest()
 
 	con := value.NumberVal(123)
 
-	p.emitConstant(con)
+	g.emitConstant(con, token.Token{})
 
-	checkConstants(t, p.chunk.Constants, []value.Value{con})
+	checkConstants(t, g.chunk.Constants, []value.Value{con})
 }
 
 func Test_emitLoop(t *testing.T) {
-	p := setupParserForTest("")
-	p.chunk.Code = append(p.chunk.Code, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	g := setupGeneratorForTest()
+	g.chunk.Code = append(g.chunk.Code, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
 	loopStart := 5
 
-	expected := p.chunk.Count() - loopStart + 2
+	expected := g.chunk.Count() - loopStart + 2
 
-	p.emitLoop(loopStart)
+	g.emitLoop(loopStart, token.Token{})
 
-	result := int(p.chunk.Code[13]) << 8
-	result |= int(p.chunk.Code[14] - 1)
+	result := int(g.chunk.Code[13]) << 8
+	result |= int(g.chunk.Code[14] - 1)
 
 	if result != expected {
 		t.Errorf("Expected %v, got %v", expected, result)
@@ -815,53 +873,62 @@ func Test_emitLoop(t *testing.T) {
 }
 
 func Test_emitJump(t *testing.T) {
-	p := setupParserForTest("")
+	g := setupGeneratorForTest()
 	instruction := byte(opcode.JumpIfFalse)
 
-	result := p.emitJump(instruction)
+	result := g.emitJump(instruction, token.Token{})
 
-	opResult := p.chunk.Code[0]
+	opResult := g.chunk.Code[0]
 
 	if opResult != instruction {
 		t.Errorf("Expected %v, got %v", opcode.Name[instruction], opcode.Name[opResult])
 	}
 
-	expected := p.chunk.Count() - 2
+	expected := g.chunk.Count() - 2
 	if result != expected {
 		t.Errorf("Expected %d, got %d", expected, result)
 	}
 }
 
 func Test_patchJump(t *testing.T) {
-	p := setupParserForTest("")
-	p.chunk.Code = append(p.chunk.Code, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	g := setupGeneratorForTest()
+	g.chunk.Code = append(g.chunk.Code, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
 	offset := 4
 
-	p.patchJump(offset)
+	g.patchJump(offset, token.Token{})
 
-	expected := p.chunk.Count() - offset - 2
-	result := int(p.chunk.Code[5])
+	expected := g.chunk.Count() - offset - 2
+	result := int(g.chunk.Code[5])
 	if result != expected {
 		t.Errorf("Expected %d, got %d", expected, result)
 	}
 }
 
 func Test_emitByte(t *testing.T) {
-	p := setupParserForTest("")
+	g := setupGeneratorForTest()
 
 	op := opcode.Add
 
-	p.emitByte(op)
+	g.emitByte(op, token.Token{})
 
-	checkOpcodes(t, p.chunk.Code, []byte{op})
+	checkOpcodes(t, g.chunk.Code, []byte{op})
 }
 
-func setupParserForTest(source string) *Parser {
+func setupGeneratorForTest() *generator {
+	return newGenerator(chunk.NewChunk(), NewCompiler(), nil)
+}
+
+// expressionForTest parses source as an expression, a missing expression
+// becomes a BadExpr, which generates no code.
+func expressionForTest(source string) ast.Expr {
 	s := []byte(source)
-	l := lexer.NewLexer(&s)
-	co := NewCompiler()
-	ch := chunk.NewChunk()
-	return NewParser(l, ch, co)
+	expression, _ := parser.ParseExpression(&s)
+	return expression
+}
+
+func tokenForTest(source string) token.Token {
+	s := []byte(source)
+	return lexer.NewLexer(&s).ScanToken()
 }
 
 func checkOpcodes(t *testing.T, actual []byte, expected []byte) {
@@ -895,6 +962,22 @@ func checkOpcodes(t *testing.T, actual []byte, expected []byte) {
 					if actual[i] != expected[i] {
 						t.Errorf("Expected %v with value %v at code index %v, got value %v.", expName, expected[i], i, actual[i])
 					}
+				case opcode.IncrementLocal, opcode.LessLocalJumpIfFalse:
+					for j := 1; j <= 2; j++ {
+						if actual[i+j] != expected[i+j] {
+							t.Errorf("Expected %v with operand %v at code index %v, got value %v.", expName, expected[i+j], i+j, actual[i+j])
+						}
+					}
+					i += 2
+					if expected[i-2] == opcode.IncrementLocal {
+						break
+					}
+					actIndex := int(actual[i+1])<<8 | int(actual[i+2])
+					expIndex := int(expected[i+1])<<8 | int(expected[i+2])
+					i += 2
+					if actIndex != expIndex {
+						t.Errorf("Expected %v with value %v at code index %v, got value %v.", expName, expIndex, i, actIndex)
+					}
 				case opcode.Loop, opcode.Jump, opcode.JumpIfFalse:
 					actIndex := int(actual[i+1]) << 8
 					actIndex |= int(actual[i+2])
@@ -928,3 +1011,204 @@ func checkConstants(t *testing.T, actual []value.Value, expected []value.Value)
 		}
 	}
 }
+
+func Test_Compile_locals(t *testing.T) {
+	source := []byte("{ var a = 1; { var b = 2; } var c = 3; }")
+	ch := chunk.NewChunk()
+	if diagnostics := CompileDiagnostics(&source, ch); len(diagnostics) > 0 {
+		t.Fatalf("CompileDiagnostics() = %v", diagnostics)
+	}
+
+	// Constant 1, Constant 2, Pop b, Constant 3, Pop c, Pop a, Return.
+	tests := []struct {
+		offset   int
+		expected string
+	}{
+		{offset: 0, expected: "[]"},
+		{offset: 2, expected: "[{a 0 2 9}]"},
+		{offset: 4, expected: "[{a 0 2 9} {b 1 4 5}]"},
+		{offset: 5, expected: "[{a 0 2 9}]"},
+		{offset: 7, expected: "[{a 0 2 9} {c 1 7 8}]"},
+		{offset: 8, expected: "[{a 0 2 9}]"},
+		{offset: 9, expected: "[]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(ch.LocalsAt(tt.offset)); got != tt.expected {
+			t.Errorf("LocalsAt(%d) = %s, expected %s", tt.offset, got, tt.expected)
+		}
+	}
+}
+
+func Test_Compile_localFunction(t *testing.T) {
+	source := []byte("{ fun g() { return 1; } var z = 2; print g() + z; }")
+	ch := chunk.NewChunk()
+	if diagnostics := CompileDiagnostics(&source, ch); len(diagnostics) > 0 {
+		t.Fatalf("CompileDiagnostics() = %v", diagnostics)
+	}
+
+	// Constant g, Constant 2, GetLocal g, Call, GetLocal z, Add, Print, Pop z,
+	// Pop g, Return.
+	if got, expected := fmt.Sprint(ch.LocalsAt(4)), "[{g 0 2 14} {z 1 4 13}]"; got != expected {
+		t.Errorf("LocalsAt(4) = %s, expected %s", got, expected)
+	}
+}
+
+func Test_CompileExpression(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		locals   []string
+		expected []byte
+		err      string
+	}{
+		{
+			name:     "local",
+			source:   "b + 1",
+			locals:   []string{"", "a", "b"},
+			expected: []byte{opcode.GetLocal, 2, opcode.Constant, 0, opcode.Add, opcode.Return},
+		},
+		{
+			name:     "assign local",
+			source:   "a = 2",
+			locals:   []string{"a"},
+			expected: []byte{opcode.Constant, 0, opcode.SetLocal, 0, opcode.Return},
+		},
+		{
+			name:     "global",
+			source:   "g",
+			locals:   nil,
+			expected: []byte{opcode.Constant, 0, opcode.GetGlobal, 0, opcode.Return},
+		},
+		{name: "statement", source: "print 1", err: "Expect expression."},
+		{name: "trailing tokens", source: "1 2", err: "Expect end of expression."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := []byte(tt.source)
+			ch := chunk.NewChunk()
+			diagnostics := CompileExpression(&source, ch, tt.locals)
+			if tt.err != "" {
+				if len(diagnostics) == 0 || diagnostics[0].Message != tt.err {
+					t.Errorf("CompileExpression() = %v, expected %s", diagnostics, tt.err)
+				}
+				return
+			}
+			if len(diagnostics) > 0 {
+				t.Fatalf("CompileExpression() = %v", diagnostics)
+			}
+			if fmt.Sprint(ch.Code) != fmt.Sprint(tt.expected) {
+				t.Errorf("Code = %v, expected %v", ch.Code, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_file(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		expected  []byte
+		constants []value.Value
+	}{
+		{
+			name:      "print",
+			source:    "print value;",
+			expected:  []byte{opcode.Constant, 0, opcode.GetGlobal, 0, opcode.Print, opcode.Return},
+			constants: []value.Value{object.ObjString("value")},
+		},
+		{
+			name:   "for",
+			source: "for (var i = 0; i > 2; i = i - 1) print i;",
+			expected: []byte{
+				opcode.Constant, 0,
+				opcode.GetLocal, 0,
+				opcode.Constant, 1,
+				opcode.Greater,
+				opcode.JumpIfFalse, 0, 21,
+				opcode.Pop,
+				opcode.Jump, 0, 11,
+				opcode.GetLocal, 0,
+				opcode.Constant, 2,
+				opcode.Subtract,
+				opcode.SetLocal, 0,
+				opcode.Pop,
+				opcode.Loop, 0, 23,
+				opcode.GetLocal, 0,
+				opcode.Print,
+				opcode.Loop, 0, 17,
+				opcode.Pop,
+				opcode.Pop,
+				opcode.Return,
+			},
+			constants: []value.Value{value.NumberVal(0), value.NumberVal(2), value.NumberVal(1)},
+		},
+		{
+			name:   "if",
+			source: "if (a) print 1; else print 2;",
+			expected: []byte{
+				opcode.Constant, 0,
+				opcode.GetGlobal, 0,
+				opcode.JumpIfFalse, 0, 7,
+				opcode.Pop,
+				opcode.Constant, 1,
+				opcode.Print,
+				opcode.Jump, 0, 4,
+				opcode.Pop,
+				opcode.Constant, 2,
+				opcode.Print,
+				opcode.Return,
+			},
+			constants: []value.Value{object.ObjString("a"), value.NumberVal(1), value.NumberVal(2)},
+		},
+		{
+			name:   "while",
+			source: "while (a) a = a - 1;",
+			expected: []byte{
+				opcode.Constant, 0,
+				opcode.GetGlobal, 0,
+				opcode.JumpIfFalse, 0, 16,
+				opcode.Pop,
+				opcode.Constant, 1,
+				opcode.Constant, 2,
+				opcode.GetGlobal, 2,
+				opcode.Constant, 3,
+				opcode.Subtract,
+				opcode.SetGlobal, 1,
+				opcode.Pop,
+				opcode.Loop, 0, 23,
+				opcode.Pop,
+				opcode.Return,
+			},
+			constants: []value.Value{object.ObjString("a"), object.ObjString("a"), object.ObjString("a"), value.NumberVal(1)},
+		},
+		{
+			name:      "var",
+			source:    "var foo;",
+			expected:  []byte{opcode.Constant, 0, opcode.Nil, opcode.DefineGlobal, 0, opcode.Return},
+			constants: []value.Value{object.ObjString("foo")},
+		},
+		{
+			name:      "block",
+			source:    "{var foo = 1; print foo;}",
+			expected:  []byte{opcode.Constant, 0, opcode.GetLocal, 0, opcode.Print, opcode.Pop, opcode.Return},
+			constants: []value.Value{value.NumberVal(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := []byte(tt.source)
+			file, diagnostics := parser.Parse(&s)
+			g := newGenerator(chunk.NewChunk(), NewCompiler(), diagnostics)
+			g.file(file)
+			if len(g.diagnostics) > 0 {
+				t.Fatalf("Expected %q to compile, got %v", tt.source, g.diagnostics)
+			}
+
+			checkOpcodes(t, g.chunk.Code, tt.expected)
+
+			checkConstants(t, g.chunk.Constants, tt.constants)
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/object"
+	"github.com/VannRR/golox/internal/opcode"
+	"github.com/VannRR/golox/internal/token"
+	"sort"
+	"strings"
+)
+
+// lintState is what the generator remembers about globals while compiling so
+// warnings that depend on the whole file can be reported at the end.
+type lintState struct {
+	warnings          []diagnostic.Diagnostic
+	globals           map[string]token.Token
+	globalOrder       []string
+	usedGlobals       map[string]bool
+	globalAssignments []token.Token
+}
+
+// Lint compiles source and returns its errors together with warnings about
+// code that is probably wrong. A warning is left out when a comment after the
+// code on its line, or alone on the line before, says `lint:ignore` followed
+// by its code, or by no code to ignore every warning there, and
+// `lint:file-ignore` does the same for the whole file.
+func Lint(source *[]byte) []diagnostic.Diagnostic {
+	return Analyze(source).Diagnostics
+}
+
+// lintDiagnostics finishes the lint pass once the whole file is compiled and
+// merges the warnings that aren't suppressed with the compile errors.
+func (g *generator) lintDiagnostics(source []byte, comments []token.Token) []diagnostic.Diagnostic {
+	g.checkGlobals()
+
+	suppressed := parseSuppressions(source, comments)
+	diagnostics := append([]diagnostic.Diagnostic{}, g.errors()...)
+	for _, w := range g.lint.warnings {
+		if !suppressed.ignores(w) {
+			diagnostics = append(diagnostics, w)
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Span.Offset < diagnostics[j].Span.Offset
+	})
+	return diagnostics
+}
+
+func (g *generator) warn(span token.Span, code string, message string) {
+	g.lint.warnings = append(g.lint.warnings, diagnostic.Diagnostic{
+		Severity: diagnostic.Warning,
+		Code:     code,
+		Message:  message,
+		Span:     span,
+	})
+}
+
+func (g *generator) declareGlobal(name token.Token) {
+	if g.lint.globals == nil {
+		g.lint.globals = make(map[string]token.Token)
+	}
+	if _, exists := g.lint.globals[string(name.Lexeme)]; exists {
+		return
+	}
+	g.lint.globals[string(name.Lexeme)] = name
+	g.lint.globalOrder = append(g.lint.globalOrder, string(name.Lexeme))
+}
+
+func (g *generator) useGlobal(name token.Token) {
+	if g.lint.usedGlobals == nil {
+		g.lint.usedGlobals = make(map[string]bool)
+	}
+	g.lint.usedGlobals[string(name.Lexeme)] = true
+}
+
+// checkGlobals reports globals that are never read and assignments to
+// globals that are never declared, which both need the whole file.
+func (g *generator) checkGlobals() {
+	for _, name := range g.lint.globalOrder {
+		if !g.lint.usedGlobals[name] && !strings.HasPrefix(name, "_") {
+			g.warn(g.lint.globals[name].Span(), diagnostic.CodeUnusedGlobal,
+				fmt.Sprintf("Global variable '%s' is never used.", name))
+		}
+	}
+
+	for _, name := range g.lint.globalAssignments {
+		if _, exists := g.lint.globals[string(name.Lexeme)]; !exists {
+			g.warn(name.Span(), diagnostic.CodeUndeclaredAssignment,
+				fmt.Sprintf("Assignment to undeclared global '%s'.", name.Lexeme))
+		}
+	}
+}
+
+// checkUnusedLocals reports the locals deeper than depth that were never
+// read, just before they go out of scope.
+func (g *generator) checkUnusedLocals(depth int) {
+	for i := g.compiler.localCount - 1; i >= 0; i-- {
+		local := &g.compiler.locals[i]
+		if local.depth <= depth {
+			break
+		}
+		if !local.used && len(local.name.Lexeme) > 0 && local.name.Lexeme[0] != '_' {
+			g.warn(local.name.Span(), diagnostic.CodeUnusedLocal,
+				fmt.Sprintf("Local variable '%s' is never used.", local.name.Lexeme))
+		}
+	}
+}
+
+// checkShadowing reports a new local whose name hides a local of an outer
+// scope, of an enclosing function, or a global declared earlier.
+func (g *generator) checkShadowing(name token.Token) {
+	for c := g.compiler; c != nil; c = c.enclosing {
+		for i := c.localCount - 1; i >= 0; i-- {
+			local := &c.locals[i]
+			if c == g.compiler && local.depth == g.compiler.scopeDepth {
+				continue
+			}
+			if bytes.Equal(local.name.Lexeme, name.Lexeme) {
+				g.warn(name.Span(), diagnostic.CodeShadowedVariable,
+					fmt.Sprintf("Variable '%s' shadows a variable declared on line %d.", name.Lexeme, local.name.Line))
+				return
+			}
+		}
+	}
+
+	if global, exists := g.lint.globals[string(name.Lexeme)]; exists {
+		g.warn(name.Span(), diagnostic.CodeShadowedVariable,
+			fmt.Sprintf("Variable '%s' shadows a global declared on line %d.", name.Lexeme, global.Line))
+	}
+}
+
+// checkConstantCondition reports a condition compiled from conditionStart
+// that is a literal. 'while (true)' is the usual way to write an endless
+// loop so loops may use a literal true.
+func (g *generator) checkConstantCondition(conditionStart int, loop bool) {
+	code := g.chunk.Code[conditionStart:]
+
+	var truthy bool
+	switch {
+	case len(code) == 1 && code[0] == opcode.True:
+		if loop {
+			return
+		}
+		truthy = true
+	case len(code) == 1 && (code[0] == opcode.False || code[0] == opcode.Nil):
+		truthy = false
+	case len(code) == 2 && code[0] == opcode.Constant:
+		constant := g.chunk.Constants[code[1]]
+		if _, isFunction := constant.(*object.ObjFunction); isFunction {
+			return
+		}
+		truthy = !constant.IsFalsey()
+	default:
+		return
+	}
+
+	g.warn(g.chunk.GetSpan(conditionStart), diagnostic.CodeConstantCondition,
+		fmt.Sprintf("Condition is always %t.", truthy))
+}
+
+type suppressions struct {
+	file  map[string]bool
+	lines map[int]map[string]bool
+}
+
+// parseSuppressions reads `lint:ignore` and `lint:file-ignore` comments, an
+// empty set of codes stands for every code. A `lint:ignore` after code covers
+// its own line, one alone on its line covers the line after it.
+func parseSuppressions(source []byte, comments []token.Token) suppressions {
+	s := suppressions{file: make(map[string]bool), lines: make(map[int]map[string]bool)}
+
+	for _, comment := range comments {
+		text := strings.TrimPrefix(string(comment.Lexeme), "//")
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		fields := strings.FieldsFunc(text, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ',' || r == '\n' || r == '\r'
+		})
+		if len(fields) == 0 {
+			continue
+		}
+
+		codes := fields[1:]
+		if len(codes) == 0 {
+			codes = []string{""}
+		}
+
+		switch fields[0] {
+		case "lint:file-ignore":
+			s.add(s.file, codes)
+		case "lint:ignore":
+			line := comment.Line
+			if startsLine(source, comment.Offset) {
+				line += strings.Count(string(comment.Lexeme), "\n") + 1
+			}
+			if s.lines[line] == nil {
+				s.lines[line] = make(map[string]bool)
+			}
+			s.add(s.lines[line], codes)
+		}
+	}
+
+	return s
+}
+
+// startsLine reports whether only spaces come before offset on its line.
+func startsLine(source []byte, offset int) bool {
+	for i := offset - 1; i >= 0 && source[i] != '\n'; i-- {
+		if source[i] != ' ' && source[i] != '\t' && source[i] != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+func (s suppressions) add(set map[string]bool, codes []string) {
+	for _, code := range codes {
+		set[code] = true
+	}
+}
+
+func (s suppressions) ignores(d diagnostic.Diagnostic) bool {
+	if s.file[""] || s.file[d.Code] {
+		return true
+	}
+	codes := s.lines[d.Span.Line]
+	return codes[""] || codes[d.Code]
+}
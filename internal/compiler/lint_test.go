@@ -0,0 +1,169 @@
+package compiler
+
+import (
+	"fmt"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/parser"
+	"testing"
+)
+
+func Test_Lint(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected []string
+	}{
+		{
+			name:     "clean",
+			source:   "var a = 1; { var b = a; print b; } fun f(x) { return x; } print f(a);",
+			expected: []string{},
+		},
+		{
+			name:     "unused local",
+			source:   "{ var a = 1; var _b = 2; }",
+			expected: []string{"1:7 W0001 Local variable 'a' is never used."},
+		},
+		{
+			name:     "unused function local",
+			source:   "fun f(unused) { var a = 1; } f(1);",
+			expected: []string{"1:21 W0001 Local variable 'a' is never used."},
+		},
+		{
+			name:     "unused global",
+			source:   "var a = 1; var _b = 2; fun f() {}",
+			expected: []string{"1:5 W0002 Global variable 'a' is never used.", "1:28 W0002 Global variable 'f' is never used."},
+		},
+		{
+			name:     "global used before declaration",
+			source:   "fun f() { return a; } var a = 1; print f();",
+			expected: []string{},
+		},
+		{
+			name:     "shadowed local",
+			source:   "{ var a = 1; { var a = 2; print a; } print a; }",
+			expected: []string{"1:20 W0003 Variable 'a' shadows a variable declared on line 1."},
+		},
+		{
+			name:     "shadowed global",
+			source:   "var a = 1; fun f(a) { return a; } print f(a);",
+			expected: []string{"1:18 W0003 Variable 'a' shadows a global declared on line 1."},
+		},
+		{
+			name:     "unreachable code",
+			source:   "fun f() { return 1; print 2; print 3; } print f();",
+			expected: []string{"1:21 W0004 Unreachable code after 'return'."},
+		},
+		{
+			name:     "return inside if",
+			source:   "fun f(x) { if (x) return 1; return 2; } print f(true);",
+			expected: []string{},
+		},
+		{
+			name:   "constant conditions",
+			source: "if (true) print 1; if (\"a\") print 2; while (nil) print 3; for (;false;) print 4; while (true) {}",
+			expected: []string{
+				"1:5 W0005 Condition is always true.",
+				"1:24 W0005 Condition is always true.",
+				"1:45 W0005 Condition is always false.",
+				"1:65 W0005 Condition is always false.",
+			},
+		},
+		{
+			name:     "undeclared assignment",
+			source:   "fun f() { b = 1; } f(); var c; c = 2; print c;",
+			expected: []string{"1:11 W0006 Assignment to undeclared global 'b'."},
+		},
+		{
+			name:     "errors come first at their position",
+			source:   "{ var a = 1; } print ;",
+			expected: []string{"1:7 W0001 Local variable 'a' is never used.", "1:22 E0001 Expect expression."},
+		},
+		{
+			name:     "ignore on the same line",
+			source:   "{ var a = 1; // lint:ignore W0001\n}",
+			expected: []string{},
+		},
+		{
+			name:     "ignore on the line before",
+			source:   "{\n/* lint:ignore W0002, W0001 */\nvar a = 1;\nvar b = 2;\n}",
+			expected: []string{"4:5 W0001 Local variable 'b' is never used."},
+		},
+		{
+			name:     "ignore on the same line only",
+			source:   "{ var y = 3; // lint:ignore W0001\nvar z = 4; }",
+			expected: []string{"2:5 W0001 Local variable 'z' is never used."},
+		},
+		{
+			name:     "ignore after a multi-line comment",
+			source:   "{\n/* lint:ignore W0001\n   because */\nvar a = 1;\nvar b = 2;\n}",
+			expected: []string{"5:5 W0001 Local variable 'b' is never used."},
+		},
+		{
+			name:     "ignore a different code",
+			source:   "{ var a = 1; // lint:ignore W0003\n}",
+			expected: []string{"1:7 W0001 Local variable 'a' is never used."},
+		},
+		{
+			name:     "ignore every code",
+			source:   "// lint:ignore\nif (true) { var a = 1; }",
+			expected: []string{},
+		},
+		{
+			name:     "ignore in the whole file",
+			source:   "var a = 1;\n// lint:file-ignore W0002\nvar b = 2;",
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := []byte(tt.source)
+
+			actual := make([]string, 0)
+			for _, d := range Lint(&source) {
+				actual = append(actual, fmt.Sprintf("%d:%d %s %s", d.Span.Line, d.Span.Column, d.Code, d.Message))
+			}
+
+			if fmt.Sprint(actual) != fmt.Sprint(tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_Lint_severity(t *testing.T) {
+	source := []byte("{ var a = 1; }")
+	diagnostics := Lint(&source)
+
+	if len(diagnostics) != 1 || diagnostics[0].Severity != diagnostic.Warning {
+		t.Errorf("Expected a single warning, got %v", diagnostics)
+	}
+}
+
+func Test_parseSuppressions(t *testing.T) {
+	source := []byte("// lint:ignore W0001 W0002\n/* lint:file-ignore W0004 */\n// unrelated lint:ignore\n")
+	file, _ := parser.Parse(&source)
+
+	s := parseSuppressions(source, file.Comments)
+
+	tests := []struct {
+		line     int
+		code     string
+		expected bool
+	}{
+		{1, "W0001", false},
+		{2, "W0001", true},
+		{2, "W0002", true},
+		{3, "W0001", false},
+		{2, "W0003", false},
+		{9, "W0004", true},
+	}
+
+	for _, tt := range tests {
+		d := diagnostic.Diagnostic{Code: tt.code}
+		d.Span.Line = tt.line
+		if actual := s.ignores(d); actual != tt.expected {
+			t.Errorf("Expected ignores(%d, %s) to be %v, got %v", tt.line, tt.code, tt.expected, actual)
+		}
+	}
+}
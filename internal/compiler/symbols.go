@@ -0,0 +1,184 @@
+package compiler
+
+import (
+	"github.com/VannRR/golox/internal/chunk"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/parser"
+	"github.com/VannRR/golox/internal/token"
+	"sort"
+)
+
+type SymbolKind uint8
+
+const (
+	SymbolVariable SymbolKind = iota
+	SymbolFunction
+	SymbolParameter
+)
+
+// Symbol is a declared variable, function or parameter. Locals are visible
+// from their declaration up to ScopeEnd, globals have a ScopeEnd of -1.
+type Symbol struct {
+	Name      string
+	Kind      SymbolKind
+	Span      token.Span
+	Detail    string
+	Container string
+	ScopeEnd  int
+}
+
+func (s Symbol) IsGlobal() bool {
+	return s.ScopeEnd == -1
+}
+
+// Reference is a use of a name, Symbol is the index of the declaration it
+// resolves to or -1 for a global that is never declared.
+type Reference struct {
+	Name   string
+	Span   token.Span
+	Symbol int
+}
+
+type SymbolTable struct {
+	Symbols    []Symbol
+	References []Reference
+	byOffset   map[int]int
+}
+
+// Analysis is everything the tooling needs to know about a source file.
+type Analysis struct {
+	Diagnostics []diagnostic.Diagnostic
+	Symbols     *SymbolTable
+}
+
+// Analyze compiles source for editor tooling, collecting its declarations
+// and references along with the diagnostics Lint would report.
+func Analyze(source *[]byte) *Analysis {
+	file, diagnostics := parser.Parse(source)
+	g := newGenerator(chunk.NewChunk(), NewCompiler(), diagnostics)
+	g.file(file)
+	g.symbols.resolveGlobals()
+
+	return &Analysis{
+		Diagnostics: g.lintDiagnostics(*source, file.Comments),
+		Symbols:     &g.symbols,
+	}
+}
+
+func (t *SymbolTable) declare(name token.Token, kind SymbolKind, detail string, container string, global bool) {
+	if t.byOffset == nil {
+		t.byOffset = make(map[int]int)
+	}
+
+	scopeEnd := 0
+	if global {
+		scopeEnd = -1
+	}
+	t.byOffset[name.Offset] = len(t.Symbols)
+	t.Symbols = append(t.Symbols, Symbol{
+		Name:      string(name.Lexeme),
+		Kind:      kind,
+		Span:      name.Span(),
+		Detail:    detail,
+		Container: container,
+		ScopeEnd:  scopeEnd,
+	})
+}
+
+// lookup finds the symbol declared by the name token at offset.
+func (t *SymbolTable) lookup(offset int) (*Symbol, bool) {
+	index, exists := t.byOffset[offset]
+	if !exists {
+		return nil, false
+	}
+	return &t.Symbols[index], true
+}
+
+func (t *SymbolTable) last() *Symbol {
+	return &t.Symbols[len(t.Symbols)-1]
+}
+
+func (t *SymbolTable) reference(name token.Token, symbol int) {
+	t.References = append(t.References, Reference{Name: string(name.Lexeme), Span: name.Span(), Symbol: symbol})
+}
+
+// closeScope ends the visibility of the local declared at offset after the
+// token that closes its scope.
+func (t *SymbolTable) closeScope(offset int, end token.Token) {
+	if symbol, ok := t.lookup(offset); ok {
+		symbol.ScopeEnd = end.Offset + end.Length
+	}
+}
+
+// resolveGlobals points references to globals at the first declaration of
+// that name, wherever it is in the file.
+func (t *SymbolTable) resolveGlobals() {
+	globals := make(map[string]int)
+	for i, symbol := range t.Symbols {
+		if _, exists := globals[symbol.Name]; symbol.IsGlobal() && !exists {
+			globals[symbol.Name] = i
+		}
+	}
+
+	for i := range t.References {
+		if t.References[i].Symbol != -1 {
+			continue
+		}
+		if index, exists := globals[t.References[i].Name]; exists {
+			t.References[i].Symbol = index
+		}
+	}
+}
+
+// At returns the symbol declared or referenced at offset.
+func (t *SymbolTable) At(offset int) (int, bool) {
+	contains := func(span token.Span) bool {
+		return offset >= span.Offset && offset <= span.Offset+span.Length
+	}
+
+	for i, symbol := range t.Symbols {
+		if contains(symbol.Span) {
+			return i, true
+		}
+	}
+	for _, reference := range t.References {
+		if reference.Symbol != -1 && contains(reference.Span) {
+			return reference.Symbol, true
+		}
+	}
+	return -1, false
+}
+
+// ReferencesTo returns every use of the symbol in source order.
+func (t *SymbolTable) ReferencesTo(symbol int) []Reference {
+	references := make([]Reference, 0)
+	for _, reference := range t.References {
+		if reference.Symbol == symbol {
+			references = append(references, reference)
+		}
+	}
+	return references
+}
+
+// Visible returns the symbols that can be named at offset, the innermost
+// declaration of each name first.
+func (t *SymbolTable) Visible(offset int) []Symbol {
+	visible := make([]Symbol, 0)
+	seen := make(map[string]bool)
+
+	for i := len(t.Symbols) - 1; i >= 0; i-- {
+		symbol := t.Symbols[i]
+		if !symbol.IsGlobal() && (offset < symbol.Span.Offset || offset > symbol.ScopeEnd) {
+			continue
+		}
+		if !seen[symbol.Name] {
+			seen[symbol.Name] = true
+			visible = append(visible, symbol)
+		}
+	}
+
+	sort.SliceStable(visible, func(i, j int) bool {
+		return !visible[i].IsGlobal() && visible[j].IsGlobal()
+	})
+	return visible
+}
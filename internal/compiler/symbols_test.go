@@ -0,0 +1,120 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_Analyze(t *testing.T) {
+	source := []byte("var a = 1;\nfun add(x, y) {\n  var sum = x + y;\n  return sum;\n}\nprint add(a, b);")
+	analysis := Analyze(&source)
+
+	symbols := make([]string, 0)
+	for _, s := range analysis.Symbols.Symbols {
+		symbols = append(symbols, fmt.Sprintf("%s %d %q %q %d:%d global=%t",
+			s.Name, s.Kind, s.Detail, s.Container, s.Span.Line, s.Span.Column, s.IsGlobal()))
+	}
+	expected := []string{
+		`a 0 "var a" "" 1:5 global=true`,
+		`add 1 "fun add(x, y)" "" 2:5 global=true`,
+		`x 2 "(parameter) x" "add" 2:9 global=false`,
+		`y 2 "(parameter) y" "add" 2:12 global=false`,
+		`sum 0 "var sum" "add" 3:7 global=false`,
+	}
+	if strings.Join(symbols, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Analyze() symbols =\n%s\nexpected\n%s", strings.Join(symbols, "\n"), strings.Join(expected, "\n"))
+	}
+
+	references := make([]string, 0)
+	for _, r := range analysis.Symbols.References {
+		references = append(references, fmt.Sprintf("%s %d:%d -> %d", r.Name, r.Span.Line, r.Span.Column, r.Symbol))
+	}
+	expected = []string{"x 3:13 -> 2", "y 3:17 -> 3", "sum 4:10 -> 4", "add 6:7 -> 1", "a 6:11 -> 0", "b 6:14 -> -1"}
+	if strings.Join(references, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Analyze() references = %v, expected %v", references, expected)
+	}
+
+	if len(analysis.Diagnostics) != 0 {
+		t.Errorf("Analyze() diagnostics = %v, expected none", analysis.Diagnostics)
+	}
+}
+
+func Test_Analyze_errors(t *testing.T) {
+	source := []byte("var a = ;\n{ var unused = 1; }")
+	analysis := Analyze(&source)
+
+	codes := make([]string, 0)
+	for _, d := range analysis.Diagnostics {
+		codes = append(codes, d.Code)
+	}
+	if strings.Join(codes, " ") != "W0002 E0001 W0001" {
+		t.Errorf("Analyze() diagnostic codes = %v, expected [W0002 E0001 W0001]", codes)
+	}
+}
+
+func Test_SymbolTable_At(t *testing.T) {
+	source := []byte("var a = 1; { var a = 2; print a; } print a;")
+	table := Analyze(&source).Symbols
+
+	tests := []struct {
+		offset   int
+		expected int
+		ok       bool
+	}{
+		{offset: 4, expected: 0, ok: true},
+		{offset: 17, expected: 1, ok: true},
+		{offset: 30, expected: 1, ok: true},
+		{offset: 41, expected: 0, ok: true},
+		{offset: 8, expected: -1, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.offset), func(t *testing.T) {
+			symbol, ok := table.At(tt.offset)
+			if symbol != tt.expected || ok != tt.ok {
+				t.Errorf("At(%d) = %d, %t, expected %d, %t", tt.offset, symbol, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func Test_SymbolTable_ReferencesTo(t *testing.T) {
+	source := []byte("fun f() { return g(); } fun g() { return 1; } print g() + f();")
+	table := Analyze(&source).Symbols
+
+	offsets := make([]int, 0)
+	for _, r := range table.ReferencesTo(1) {
+		offsets = append(offsets, r.Span.Offset)
+	}
+	if fmt.Sprint(offsets) != "[17 52]" {
+		t.Errorf("ReferencesTo(g) offsets = %v, expected [17 52]", offsets)
+	}
+}
+
+func Test_SymbolTable_Visible(t *testing.T) {
+	source := []byte("var g = 1;\nfun f(p) {\n  { var inner = p; print inner; }\n  return p;\n}\nprint f(g);")
+	table := Analyze(&source).Symbols
+
+	tests := []struct {
+		name     string
+		offset   int
+		expected string
+	}{
+		{name: "top level", offset: len(source), expected: "f g"},
+		{name: "function body", offset: strings.Index(string(source), "return"), expected: "p f g"},
+		{name: "inner block", offset: strings.Index(string(source), "print inner"), expected: "inner p f g"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := make([]string, 0)
+			for _, s := range table.Visible(tt.offset) {
+				names = append(names, s.Name)
+			}
+			if strings.Join(names, " ") != tt.expected {
+				t.Errorf("Visible(%d) = %v, expected %s", tt.offset, names, tt.expected)
+			}
+		})
+	}
+}
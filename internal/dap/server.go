@@ -0,0 +1,381 @@
+// Package dap implements a Debug Adapter Protocol server that debugs one Lox
+// script over a pair of streams, normally the editor's pipes to stdin and
+// stdout.
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/VannRR/golox/internal/debugger"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/frame"
+	"github.com/VannRR/golox/internal/object"
+	"github.com/VannRR/golox/internal/value"
+	"github.com/VannRR/golox/internal/vm"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	mu  sync.Mutex // guards out and seq, events are sent from other goroutines
+	seq int
+
+	path        string
+	session     *debugger.Session
+	stopOnEntry bool
+	started     bool
+	exited      chan struct{}
+	breakpoints map[string][]int
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:          bufio.NewReader(in),
+		out:         out,
+		breakpoints: make(map[string][]int),
+	}
+}
+
+// Run handles requests until the client disconnects or closes the input, a
+// script still running then is terminated.
+func (s *Server) Run() error {
+	defer s.terminate()
+	for {
+		body, err := frame.Read(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var m message
+		if err := json.Unmarshal(body, &m); err != nil {
+			return fmt.Errorf("dap: invalid message: %v", err)
+		}
+		if m.Type != "request" {
+			continue
+		}
+		if m.Command == "disconnect" {
+			s.terminate()
+			s.reply(m, nil)
+			return nil
+		}
+		s.handle(m)
+	}
+}
+
+func (s *Server) write(build func(seq int) any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	body, err := json.Marshal(build(s.seq))
+	if err != nil {
+		panic(err)
+	}
+	frame.Write(s.out, body)
+}
+
+func (s *Server) reply(m message, body any) {
+	s.write(func(seq int) any {
+		return response{Seq: seq, Type: "response", RequestSeq: m.Seq, Success: true, Command: m.Command, Body: body}
+	})
+}
+
+func (s *Server) replyError(m message, text string) {
+	s.write(func(seq int) any {
+		return response{Seq: seq, Type: "response", RequestSeq: m.Seq, Command: m.Command, Message: text}
+	})
+}
+
+func (s *Server) event(name string, body any) {
+	s.write(func(seq int) any {
+		return event{Seq: seq, Type: "event", Event: name, Body: body}
+	})
+}
+
+func (s *Server) handle(m message) {
+	var body any
+	var err error
+
+	switch m.Command {
+	case "initialize":
+		s.reply(m, capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+		})
+		s.event("initialized", nil)
+		return
+	case "launch":
+		var args launchArguments
+		if err = json.Unmarshal(m.Arguments, &args); err == nil {
+			err = s.launch(args)
+		}
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err = json.Unmarshal(m.Arguments, &args); err == nil {
+			body = map[string]any{"breakpoints": s.setBreakpoints(args)}
+		}
+	case "configurationDone":
+		s.start()
+	case "threads":
+		body = map[string]any{"threads": []thread{{ID: threadID, Name: "main"}}}
+	case "stackTrace":
+		var frames []StackFrame
+		if frames, err = s.stackTrace(); err == nil {
+			body = map[string]any{"stackFrames": frames, "totalFrames": len(frames)}
+		}
+	case "scopes":
+		var args frameArguments
+		if err = json.Unmarshal(m.Arguments, &args); err == nil {
+			body = map[string]any{"scopes": []Scope{
+				{Name: "Locals", VariablesReference: args.FrameID + 1},
+				{Name: "Globals", VariablesReference: globalsReference},
+			}}
+		}
+	case "variables":
+		var args variablesArguments
+		var variables []Variable
+		if err = json.Unmarshal(m.Arguments, &args); err == nil {
+			if variables, err = s.variables(args.VariablesReference); err == nil {
+				body = map[string]any{"variables": variables}
+			}
+		}
+	case "evaluate":
+		var args evaluateArguments
+		var result value.Value
+		if err = json.Unmarshal(m.Arguments, &args); err == nil {
+			if result, err = s.evaluate(args); err == nil {
+				body = map[string]any{"result": display(result), "variablesReference": 0}
+			}
+		}
+	case "continue", "next", "stepIn", "stepOut":
+		if err = s.step(m.Command); err == nil && m.Command == "continue" {
+			body = map[string]any{"allThreadsContinued": true}
+		}
+	case "pause":
+		if s.session != nil {
+			s.session.Pause()
+		}
+	case "terminate":
+		s.terminate()
+	default:
+		s.replyError(m, "unsupported request: "+m.Command)
+		return
+	}
+
+	if err != nil {
+		s.replyError(m, err.Error())
+		return
+	}
+	s.reply(m, body)
+}
+
+// launch compiles the script, it starts running on configurationDone.
+func (s *Server) launch(args launchArguments) error {
+	if s.session != nil {
+		return errors.New("a program is already launched")
+	}
+	source, err := os.ReadFile(args.Program)
+	if err != nil {
+		return fmt.Errorf("could not read %q: %v", args.Program, err)
+	}
+
+	program, diagnostics := vm.CompileFileDiagnostics(args.Program, &source)
+	if len(diagnostics) > 0 {
+		var b bytes.Buffer
+		diagnostic.NewRenderer(source, args.Program, false).RenderAll(&b, diagnostics)
+		return errors.New(b.String())
+	}
+
+	s.path = args.Program
+	s.stopOnEntry = args.StopOnEntry
+	s.session = debugger.NewSession(program, &output{server: s, category: "stdout"}, &output{server: s, category: "stderr"})
+	s.session.VM().SetFileSystem(vm.OSFileSystem())
+
+	// Breakpoints set before the launch couldn't be checked against the code.
+	if lines, ok := s.breakpoints[key(s.path)]; ok {
+		for i, bp := range s.session.SetBreakpoints(lines) {
+			s.event("breakpoint", breakpointEvent{Reason: "changed", Breakpoint: s.breakpoint(i, bp)})
+		}
+	}
+	return nil
+}
+
+func (s *Server) setBreakpoints(args setBreakpointsArguments) []Breakpoint {
+	lines := make([]int, 0, len(args.Breakpoints))
+	for _, bp := range args.Breakpoints {
+		lines = append(lines, bp.Line)
+	}
+	s.breakpoints[key(args.Source.Path)] = lines
+
+	breakpoints := make([]Breakpoint, 0, len(lines))
+	if s.session == nil || key(args.Source.Path) != key(s.path) {
+		for i, line := range lines {
+			breakpoints = append(breakpoints, Breakpoint{ID: i + 1, Line: line, Source: args.Source})
+		}
+		return breakpoints
+	}
+
+	for i, bp := range s.session.SetBreakpoints(lines) {
+		breakpoints = append(breakpoints, s.breakpoint(i, bp))
+	}
+	return breakpoints
+}
+
+func (s *Server) breakpoint(i int, bp debugger.Breakpoint) Breakpoint {
+	return Breakpoint{ID: i + 1, Verified: bp.Verified, Line: bp.Line, Source: s.source()}
+}
+
+// start runs the launched script and forwards its events until it exits.
+func (s *Server) start() {
+	if s.session == nil || s.started {
+		return
+	}
+	s.started = true
+	s.exited = make(chan struct{})
+
+	go func() {
+		defer close(s.exited)
+		for e := range s.session.Events() {
+			if e.Kind == debugger.EventStopped {
+				s.event("stopped", stoppedEvent{Reason: string(e.Reason), ThreadID: threadID, AllThreadsStopped: true})
+				continue
+			}
+
+			exitCode := 0
+			if e.Result != vm.InterpretOk {
+				exitCode = 70
+			}
+			s.event("exited", exitedEvent{ExitCode: exitCode})
+			s.event("terminated", nil)
+		}
+	}()
+	s.session.Start(s.stopOnEntry)
+}
+
+// terminate stops the script and waits for its last events to be sent.
+func (s *Server) terminate() {
+	if !s.started {
+		return
+	}
+	s.session.Terminate()
+	<-s.exited
+}
+
+func (s *Server) step(command string) error {
+	if !s.started {
+		return errors.New("no program is running")
+	}
+	switch command {
+	case "next":
+		return s.session.Next()
+	case "stepIn":
+		return s.session.StepIn()
+	case "stepOut":
+		return s.session.StepOut()
+	}
+	return s.session.Continue()
+}
+
+func (s *Server) stackTrace() ([]StackFrame, error) {
+	if !s.started {
+		return nil, errors.New("no program is running")
+	}
+	frames, err := s.session.Frames()
+	if err != nil {
+		return nil, err
+	}
+
+	stackFrames := make([]StackFrame, 0, len(frames))
+	for i, f := range frames {
+		name := "script"
+		if f.Function != "" {
+			name = f.Function + "()"
+		}
+		stackFrames = append(stackFrames, StackFrame{
+			ID:     i + 1,
+			Name:   name,
+			Source: s.source(),
+			Line:   f.Span.Line,
+			Column: f.Span.Column,
+		})
+	}
+	return stackFrames, nil
+}
+
+func (s *Server) variables(reference int) ([]Variable, error) {
+	if !s.started {
+		return nil, errors.New("no program is running")
+	}
+
+	var found []vm.Variable
+	var err error
+	if reference == globalsReference {
+		found, err = s.session.Globals()
+	} else {
+		found, err = s.session.Locals(reference - 2)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	variables := make([]Variable, 0, len(found))
+	for _, v := range found {
+		variables = append(variables, Variable{Name: v.Name, Value: display(v.Value)})
+	}
+	return variables, nil
+}
+
+func (s *Server) evaluate(args evaluateArguments) (value.Value, error) {
+	if !s.started {
+		return nil, errors.New("no program is running")
+	}
+	frame := 0
+	if args.FrameID > 0 {
+		frame = args.FrameID - 1
+	}
+	return s.session.Evaluate(frame, args.Expression)
+}
+
+func (s *Server) source() Source {
+	return Source{Name: filepath.Base(s.path), Path: s.path}
+}
+
+// key identifies a source path however the client spelled it.
+func key(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// display formats a value the way it would be written in Lox.
+func display(v value.Value) string {
+	if s, ok := v.(object.ObjString); ok {
+		return strconv.Quote(string(s))
+	}
+	return v.String()
+}
+
+// output sends what the script writes as output events.
+type output struct {
+	server   *Server
+	category string
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.server.event("output", outputEvent{Category: o.category, Output: string(p)})
+	return len(p), nil
+}
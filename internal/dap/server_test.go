@@ -0,0 +1,394 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/VannRR/golox/internal/debug"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSource = `var total = 0;
+fun add(a, b) {
+  var sum = a + b;
+  return sum;
+}
+for (var i = 0; i < 2; i = i + 1) {
+  total = add(total, i);
+}
+print total;
+`
+
+type received struct {
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	Event      string          `json:"event"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client talks to a server over pipes the way an editor would, keeping the
+// events that arrive while it waits for responses.
+type client struct {
+	t        *testing.T
+	in       io.WriteCloser
+	messages chan received
+	pending  []received
+	seq      int
+	done     chan error
+}
+
+func newClient(t *testing.T) *client {
+	debug.PrintCode, debug.TraceExecution = false, false
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	c := &client{t: t, in: inWriter, messages: make(chan received, 100), done: make(chan error, 1)}
+
+	go func() {
+		c.done <- NewServer(inReader, outWriter).Run()
+		outWriter.Close()
+	}()
+	go func() {
+		defer close(c.messages)
+		reader := bufio.NewReader(outReader)
+		for {
+			header, err := textproto.NewReader(reader).ReadMIMEHeader()
+			if err != nil {
+				return
+			}
+			length, _ := strconv.Atoi(header.Get("Content-Length"))
+			body := make([]byte, length)
+			if _, err := io.ReadFull(reader, body); err != nil {
+				return
+			}
+			var r received
+			json.Unmarshal(body, &r)
+			c.messages <- r
+		}
+	}()
+	return c
+}
+
+func (c *client) next() received {
+	c.t.Helper()
+	select {
+	case r, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("The server closed its output")
+		}
+		return r
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("Timed out waiting for the server")
+		return received{}
+	}
+}
+
+func (c *client) request(command string, arguments string) received {
+	c.t.Helper()
+	c.seq++
+	body := fmt.Sprintf(`{"seq":%d,"type":"request","command":%q,"arguments":%s}`, c.seq, command, arguments)
+	fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+
+	for {
+		r := c.next()
+		if r.Type == "response" && r.RequestSeq == c.seq {
+			return r
+		}
+		c.pending = append(c.pending, r)
+	}
+}
+
+// succeed sends a request that must succeed and decodes its body into v.
+func (c *client) succeed(command string, arguments string, v any) {
+	c.t.Helper()
+	r := c.request(command, arguments)
+	if !r.Success {
+		c.t.Fatalf("%s failed: %s", command, r.Message)
+	}
+	if v != nil {
+		if err := json.Unmarshal(r.Body, v); err != nil {
+			c.t.Fatalf("%s body %s: %v", command, r.Body, err)
+		}
+	}
+}
+
+func (c *client) event(name string) received {
+	c.t.Helper()
+	for i, r := range c.pending {
+		if r.Type == "event" && r.Event == name {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return r
+		}
+	}
+	for {
+		r := c.next()
+		if r.Type == "event" && r.Event == name {
+			return r
+		}
+		c.pending = append(c.pending, r)
+	}
+}
+
+// output joins the output events received so far.
+func (c *client) output(category string) string {
+	var b strings.Builder
+	for _, r := range c.pending {
+		var body outputEvent
+		if r.Event == "output" && json.Unmarshal(r.Body, &body) == nil && body.Category == category {
+			b.WriteString(body.Output)
+		}
+	}
+	return b.String()
+}
+
+func (c *client) disconnect() {
+	c.t.Helper()
+	c.succeed("disconnect", `{}`, nil)
+	c.in.Close()
+	if err := <-c.done; err != nil {
+		c.t.Errorf("Run() error = %v", err)
+	}
+}
+
+func writeScript(t *testing.T, source string) string {
+	path := filepath.Join(t.TempDir(), "test.lox")
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func (c *client) stackTrace() string {
+	c.t.Helper()
+	var body struct{ StackFrames []StackFrame }
+	c.succeed("stackTrace", `{"threadId":1}`, &body)
+	frames := make([]string, 0, len(body.StackFrames))
+	for _, f := range body.StackFrames {
+		frames = append(frames, fmt.Sprintf("%d %s %s:%d:%d", f.ID, f.Name, f.Source.Name, f.Line, f.Column))
+	}
+	return strings.Join(frames, ", ")
+}
+
+func (c *client) variables(reference int) string {
+	c.t.Helper()
+	var body struct{ Variables []Variable }
+	c.succeed("variables", fmt.Sprintf(`{"variablesReference":%d}`, reference), &body)
+	variables := make([]string, 0, len(body.Variables))
+	for _, v := range body.Variables {
+		variables = append(variables, v.Name+"="+v.Value)
+	}
+	return strings.Join(variables, " ")
+}
+
+func Test_Server_session(t *testing.T) {
+	path := writeScript(t, testSource)
+	c := newClient(t)
+
+	var capabilities capabilities
+	c.succeed("initialize", `{"adapterID":"golox","linesStartAt1":true}`, &capabilities)
+	if !capabilities.SupportsConfigurationDoneRequest {
+		t.Errorf("initialize = %+v", capabilities)
+	}
+	c.event("initialized")
+
+	c.succeed("launch", fmt.Sprintf(`{"program":%q}`, path), nil)
+	var breakpoints struct{ Breakpoints []Breakpoint }
+	c.succeed("setBreakpoints", fmt.Sprintf(`{"source":{"path":%q},"breakpoints":[{"line":3},{"line":20}]}`, path), &breakpoints)
+	if got := fmt.Sprint(breakpoints.Breakpoints); got != fmt.Sprintf("[{1 true 3 {test.lox %s}} {2 false 20 {test.lox %s}}]", path, path) {
+		t.Errorf("setBreakpoints = %s", got)
+	}
+	c.succeed("configurationDone", `{}`, nil)
+
+	var stopped stoppedEvent
+	json.Unmarshal(c.event("stopped").Body, &stopped)
+	if stopped.Reason != "breakpoint" || stopped.ThreadID != threadID {
+		t.Errorf("stopped = %+v", stopped)
+	}
+
+	var threads struct{ Threads []thread }
+	c.succeed("threads", `{}`, &threads)
+	if len(threads.Threads) != 1 || threads.Threads[0].ID != threadID {
+		t.Errorf("threads = %+v", threads)
+	}
+
+	if got := c.stackTrace(); got != "1 add() test.lox:3:13, 2 script test.lox:7:14" {
+		t.Errorf("stackTrace = %s", got)
+	}
+
+	var scopes struct{ Scopes []Scope }
+	c.succeed("scopes", `{"frameId":1}`, &scopes)
+	if fmt.Sprint(scopes.Scopes) != "[{Locals 2 false} {Globals 1 false}]" {
+		t.Errorf("scopes = %v", scopes.Scopes)
+	}
+	if got := c.variables(2); got != "a=0 b=0" {
+		t.Errorf("locals = %s", got)
+	}
+	if got := c.variables(3); got != "i=0" {
+		t.Errorf("caller locals = %s", got)
+	}
+	if got := c.variables(globalsReference); got != "add=<fn add> total=0" {
+		t.Errorf("globals = %s", got)
+	}
+
+	var evaluated struct{ Result string }
+	c.succeed("evaluate", `{"expression":"a + b + 1","frameId":1}`, &evaluated)
+	if evaluated.Result != "1" {
+		t.Errorf("evaluate = %s, expected 1", evaluated.Result)
+	}
+	c.succeed("evaluate", `{"expression":"\"x\" + \"y\"","frameId":2}`, &evaluated)
+	if evaluated.Result != `"xy"` {
+		t.Errorf("evaluate = %s, expected a quoted string", evaluated.Result)
+	}
+	if r := c.request("evaluate", `{"expression":"sum","frameId":2}`); r.Success || r.Message != "Undefined variable 'sum'." {
+		t.Errorf("evaluate = %+v, expected sum to be undefined in the caller", r)
+	}
+
+	c.succeed("next", `{"threadId":1}`, nil)
+	c.event("stopped")
+	if got := c.stackTrace(); !strings.HasPrefix(got, "1 add() test.lox:4:") {
+		t.Errorf("stackTrace after next = %s", got)
+	}
+	c.succeed("stepOut", `{"threadId":1}`, nil)
+	c.event("stopped")
+	if got := c.stackTrace(); !strings.HasPrefix(got, "1 script test.lox:7:") {
+		t.Errorf("stackTrace after stepOut = %s", got)
+	}
+
+	c.succeed("setBreakpoints", fmt.Sprintf(`{"source":{"path":%q},"breakpoints":[]}`, path), nil)
+	c.succeed("continue", `{"threadId":1}`, nil)
+	var exited exitedEvent
+	json.Unmarshal(c.event("exited").Body, &exited)
+	c.event("terminated")
+	if exited.ExitCode != 0 {
+		t.Errorf("exitCode = %d, expected 0", exited.ExitCode)
+	}
+	if got := c.output("stdout"); got != "1\n" {
+		t.Errorf("stdout = %q, expected 1", got)
+	}
+	if r := c.request("stackTrace", `{"threadId":1}`); r.Success {
+		t.Errorf("stackTrace after exit = %+v, expected an error", r)
+	}
+
+	c.disconnect()
+}
+
+func Test_Server_breakpointsBeforeLaunch(t *testing.T) {
+	path := writeScript(t, testSource)
+	c := newClient(t)
+	c.succeed("initialize", `{}`, nil)
+
+	var breakpoints struct{ Breakpoints []Breakpoint }
+	c.succeed("setBreakpoints", fmt.Sprintf(`{"source":{"path":%q},"breakpoints":[{"line":6}]}`, path), &breakpoints)
+	if len(breakpoints.Breakpoints) != 1 || breakpoints.Breakpoints[0].Verified {
+		t.Errorf("setBreakpoints = %+v, expected an unverified breakpoint", breakpoints)
+	}
+
+	c.succeed("launch", fmt.Sprintf(`{"program":%q}`, path), nil)
+	var changed breakpointEvent
+	json.Unmarshal(c.event("breakpoint").Body, &changed)
+	if changed.Reason != "changed" || !changed.Breakpoint.Verified || changed.Breakpoint.Line != 6 {
+		t.Errorf("breakpoint event = %+v", changed)
+	}
+
+	c.succeed("configurationDone", `{}`, nil)
+	c.event("stopped")
+	if got := c.stackTrace(); !strings.HasPrefix(got, "1 script test.lox:6:") {
+		t.Errorf("stackTrace = %s", got)
+	}
+	c.disconnect()
+}
+
+func Test_Server_stopOnEntry(t *testing.T) {
+	path := writeScript(t, testSource)
+	c := newClient(t)
+	c.succeed("initialize", `{}`, nil)
+	c.succeed("launch", fmt.Sprintf(`{"program":%q,"stopOnEntry":true}`, path), nil)
+	c.succeed("configurationDone", `{}`, nil)
+
+	var stopped stoppedEvent
+	json.Unmarshal(c.event("stopped").Body, &stopped)
+	if stopped.Reason != "entry" {
+		t.Errorf("stopped = %+v, expected entry", stopped)
+	}
+	c.succeed("stepIn", `{"threadId":1}`, nil)
+	c.event("stopped")
+	if got := c.stackTrace(); got != "1 script test.lox:2:5" {
+		t.Errorf("stackTrace = %s", got)
+	}
+	c.disconnect()
+}
+
+func Test_Server_pause(t *testing.T) {
+	path := writeScript(t, "var i = 0;\nwhile (true) {\n  i = i + 1;\n}\n")
+	c := newClient(t)
+	c.succeed("initialize", `{}`, nil)
+	c.succeed("launch", fmt.Sprintf(`{"program":%q}`, path), nil)
+	c.succeed("configurationDone", `{}`, nil)
+	c.succeed("pause", `{"threadId":1}`, nil)
+
+	var stopped stoppedEvent
+	json.Unmarshal(c.event("stopped").Body, &stopped)
+	if stopped.Reason != "pause" {
+		t.Errorf("stopped = %+v, expected pause", stopped)
+	}
+
+	c.succeed("terminate", `{}`, nil)
+	var exited exitedEvent
+	json.Unmarshal(c.event("exited").Body, &exited)
+	if exited.ExitCode != 70 {
+		t.Errorf("exitCode = %d, expected 70", exited.ExitCode)
+	}
+	c.disconnect()
+}
+
+func Test_Server_runtimeError(t *testing.T) {
+	path := writeScript(t, "print 1;\nprint nil + 1;\n")
+	c := newClient(t)
+	c.succeed("initialize", `{}`, nil)
+	c.succeed("launch", fmt.Sprintf(`{"program":%q}`, path), nil)
+	c.succeed("configurationDone", `{}`, nil)
+
+	var exited exitedEvent
+	json.Unmarshal(c.event("exited").Body, &exited)
+	if exited.ExitCode != 70 {
+		t.Errorf("exitCode = %d, expected 70", exited.ExitCode)
+	}
+	if stderr := c.output("stderr"); !strings.Contains(stderr, "Operands must be of the same type.") {
+		t.Errorf("stderr = %q, expected the runtime error", stderr)
+	}
+	c.disconnect()
+}
+
+func Test_Server_errors(t *testing.T) {
+	path := writeScript(t, "print ;\n")
+	c := newClient(t)
+	c.succeed("initialize", `{}`, nil)
+
+	tests := []struct {
+		command   string
+		arguments string
+		expected  string
+	}{
+		{command: "launch", arguments: fmt.Sprintf(`{"program":%q}`, path), expected: "Expect expression."},
+		{command: "launch", arguments: `{"program":"missing.lox"}`, expected: "could not read"},
+		{command: "stackTrace", arguments: `{"threadId":1}`, expected: "no program is running"},
+		{command: "next", arguments: `{"threadId":1}`, expected: "no program is running"},
+		{command: "restartFrame", arguments: `{}`, expected: "unsupported request: restartFrame"},
+	}
+	for _, tt := range tests {
+		r := c.request(tt.command, tt.arguments)
+		if r.Success || !strings.Contains(r.Message, tt.expected) {
+			t.Errorf("%s = %+v, expected an error containing %q", tt.command, r, tt.expected)
+		}
+	}
+	c.disconnect()
+}
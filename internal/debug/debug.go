@@ -3,90 +3,135 @@ package debug
 import (
 	"fmt"
 	"github.com/VannRR/golox/internal/chunk"
+	"github.com/VannRR/golox/internal/object"
 	"github.com/VannRR/golox/internal/opcode"
+	"io"
+	"os"
 )
 
-const PrintCode bool = true
-const TraceExecution bool = true
+var PrintCode bool = false
+var TraceExecution bool = false
 
 func DisassembleChunk(c *chunk.Chunk, name string) {
-	fmt.Printf("== %s ==\n", name)
+	DisassembleChunkTo(os.Stdout, c, name)
+}
+
+// DisassembleChunkTo is like DisassembleChunk but writes to w.
+func DisassembleChunkTo(w io.Writer, c *chunk.Chunk, name string) {
+	fmt.Fprintf(w, "== %s ==\n", name)
 
 	for offset := 0; offset < c.Count(); {
-		offset = DisassembleInstruction(c, offset)
+		offset = DisassembleInstructionTo(w, c, offset)
+	}
+}
+
+// DisassembleAllTo is like DisassembleChunkTo but goes on to disassemble the
+// functions declared in c.
+func DisassembleAllTo(w io.Writer, c *chunk.Chunk, name string) {
+	DisassembleChunkTo(w, c, name)
+	for _, constant := range c.Constants {
+		if f, ok := constant.(*object.ObjFunction); ok {
+			DisassembleAllTo(w, f.Chunk(), f.Name())
+		}
 	}
 }
 
 func DisassembleInstruction(c *chunk.Chunk, offset int) int {
-	fmt.Printf("%04d ", offset)
+	return DisassembleInstructionTo(os.Stdout, c, offset)
+}
+
+// DisassembleInstructionTo is like DisassembleInstruction but writes to w.
+func DisassembleInstructionTo(w io.Writer, c *chunk.Chunk, offset int) int {
+	fmt.Fprintf(w, "%04d ", offset)
 
 	if l := c.GetLine(offset); offset > 0 && l == c.GetLine(offset-1) {
-		fmt.Printf("   | ")
+		fmt.Fprintf(w, "   | ")
 	} else {
-		fmt.Printf("%4d ", l)
+		fmt.Fprintf(w, "%4d ", l)
 	}
 
 	switch op := c.Code[offset]; op {
 	case opcode.Constant, opcode.DefineGlobal, opcode.GetGlobal, opcode.SetGlobal:
-		return constantInstruction(opcode.Name[op], c, offset)
+		return constantInstruction(w, opcode.Name[op], c, offset)
 	case opcode.ConstantLong, opcode.DefineGlobalLong, opcode.GetGlobalLong, opcode.SetGlobalLong:
-		return constantLongInstruction(opcode.Name[op], c, offset)
+		return constantLongInstruction(w, opcode.Name[op], c, offset)
 	case opcode.Nil, opcode.True, opcode.False, opcode.Pop,
 		opcode.Equal, opcode.NotEqual, opcode.Greater, opcode.GreaterEqual,
 		opcode.Less, opcode.LessEqual, opcode.Add, opcode.Subtract,
 		opcode.Multiply, opcode.Divide, opcode.Not, opcode.Modulo,
 		opcode.Negate, opcode.Print, opcode.Return:
-		return simpleInstruction(opcode.Name[op], offset)
-	case opcode.GetLocal, opcode.SetLocal:
-		return byteInstruction(opcode.Name[op], c, offset)
+		return simpleInstruction(w, opcode.Name[op], offset)
+	case opcode.GetLocal, opcode.SetLocal, opcode.Call:
+		return byteInstruction(w, opcode.Name[op], c, offset)
 	case opcode.GetLocalLong, opcode.SetLocalLong:
-		return byteInstructionLong(opcode.Name[op], c, offset)
+		return byteInstructionLong(w, opcode.Name[op], c, offset)
 	case opcode.Jump, opcode.JumpIfFalse:
-		return jumpInstruction(opcode.Name[op], 1, c, offset)
+		return jumpInstruction(w, opcode.Name[op], 1, c, offset)
 	case opcode.Loop:
-		return jumpInstruction(opcode.Name[op], -1, c, offset)
+		return jumpInstruction(w, opcode.Name[op], -1, c, offset)
+	case opcode.IncrementLocal:
+		return localConstantInstruction(w, opcode.Name[op], c, offset)
+	case opcode.LessLocalJumpIfFalse:
+		return localConstantJumpInstruction(w, opcode.Name[op], c, offset)
 	default:
-		fmt.Printf("Unknown opcode %d\n", op)
+		fmt.Fprintf(w, "Unknown opcode %d\n", op)
 		return offset + 1
 	}
 }
 
-func constantInstruction(name string, c *chunk.Chunk, offset int) int {
+func constantInstruction(w io.Writer, name string, c *chunk.Chunk, offset int) int {
 	constantIndex := c.Code[offset+1]
-	fmt.Printf("%-16s %4d '%s'\n", name, constantIndex, c.Constants[constantIndex])
+	fmt.Fprintf(w, "%-16s %4d '%s'\n", name, constantIndex, c.Constants[constantIndex])
 	return offset + 2
 }
 
-func constantLongInstruction(name string, c *chunk.Chunk, offset int) int {
+func constantLongInstruction(w io.Writer, name string, c *chunk.Chunk, offset int) int {
 	constantIndex := uint32(c.Code[offset+1]) << 16
 	constantIndex |= uint32(c.Code[offset+2]) << 8
 	constantIndex |= uint32(c.Code[offset+3])
-	fmt.Printf("%-16s %4d '%s'\n", name, constantIndex, c.Constants[constantIndex])
+	fmt.Fprintf(w, "%-16s %4d '%s'\n", name, constantIndex, c.Constants[constantIndex])
 	return offset + 4
 }
 
-func simpleInstruction(name string, offset int) int {
-	fmt.Printf("%s\n", name)
+func simpleInstruction(w io.Writer, name string, offset int) int {
+	fmt.Fprintf(w, "%s\n", name)
 	return offset + 1
 }
 
-func byteInstruction(name string, c *chunk.Chunk, offset int) int {
+func byteInstruction(w io.Writer, name string, c *chunk.Chunk, offset int) int {
 	slot := c.Code[offset+1]
-	fmt.Printf("%-16s %4d\n", name, slot)
+	fmt.Fprintf(w, "%-16s %4d\n", name, slot)
 	return offset + 2
 }
 
-func byteInstructionLong(name string, c *chunk.Chunk, offset int) int {
+func byteInstructionLong(w io.Writer, name string, c *chunk.Chunk, offset int) int {
 	slot := uint32(c.Code[offset+1]) << 16
 	slot |= uint32(c.Code[offset+2]) << 8
 	slot |= uint32(c.Code[offset+3])
-	fmt.Printf("%-16s %4d\n", name, slot)
+	fmt.Fprintf(w, "%-16s %4d\n", name, slot)
 	return offset + 4
 }
 
-func jumpInstruction(name string, sign int, chunk *chunk.Chunk, offset int) int {
+func jumpInstruction(w io.Writer, name string, sign int, chunk *chunk.Chunk, offset int) int {
 	jump := uint16(chunk.Code[offset+1]) << 8
 	jump |= uint16(chunk.Code[offset+2])
-	fmt.Printf("%-16s %4d -> %d\n", name, offset, offset+3+sign*int(jump))
+	fmt.Fprintf(w, "%-16s %4d -> %d\n", name, offset, offset+3+sign*int(jump))
 	return offset + 3
 }
+
+func localConstantInstruction(w io.Writer, name string, c *chunk.Chunk, offset int) int {
+	slot := c.Code[offset+1]
+	constantIndex := c.Code[offset+2]
+	fmt.Fprintf(w, "%-16s %4d %4d '%s'\n", name, slot, constantIndex, c.Constants[constantIndex])
+	return offset + 3
+}
+
+func localConstantJumpInstruction(w io.Writer, name string, c *chunk.Chunk, offset int) int {
+	slot := c.Code[offset+1]
+	constantIndex := c.Code[offset+2]
+	jump := uint16(c.Code[offset+3]) << 8
+	jump |= uint16(c.Code[offset+4])
+	fmt.Fprintf(w, "%-16s %4d %4d '%s' %4d -> %d\n", name, slot, constantIndex,
+		c.Constants[constantIndex], offset, offset+5+int(jump))
+	return offset + 5
+}
@@ -48,6 +48,95 @@ func TestDisassembleInstruction(t *testing.T) {
 	}
 }
 
+func TestDisassembleInstruction_superinstructions(t *testing.T) {
+	c := &chunk.Chunk{
+		Code: []byte{
+			opcode.IncrementLocal, 1, 0,
+			opcode.LessLocalJumpIfFalse, 1, 1, 0, 4,
+		},
+		Constants: []value.Value{value.NumberVal(1), value.NumberVal(10)},
+	}
+
+	tests := []struct {
+		offset int
+		next   int
+		want   []string
+	}{
+		{0, 3, []string{"0000", "OpIncrementLocal", "1", "0", "'1'"}},
+		{3, 8, []string{"0003", "OpLessLocalJumpIfFalse", "'10'", "3 -> 12"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("Offset %d", tt.offset), func(t *testing.T) {
+			next := 0
+			output := captureOutput(func() {
+				next = debug.DisassembleInstruction(c, tt.offset)
+			})
+
+			if next != tt.next {
+				t.Errorf("Expected next offset %d, got %d", tt.next, next)
+			}
+
+			for _, part := range tt.want {
+				if !strings.Contains(output, part) {
+					t.Errorf("Expected output to contain: %s\nGot:\n%s", part, output)
+				}
+			}
+		})
+	}
+}
+
+func TestDisassembleInstructionTo(t *testing.T) {
+	c := &chunk.Chunk{
+		Code:      []byte{opcode.Constant, 0, opcode.Return},
+		Constants: []value.Value{value.NumberVal(1)},
+	}
+
+	var b bytes.Buffer
+	next := debug.DisassembleInstructionTo(&b, c, 0)
+	next = debug.DisassembleInstructionTo(&b, c, next)
+
+	expected := "0000    0 OpConstant          0 '1'\n0002    | OpReturn\n"
+	if next != 3 || b.String() != expected {
+		t.Errorf("DisassembleInstructionTo() = %d %q, expected 3 %q", next, b.String(), expected)
+	}
+}
+
+func TestDisassembleChunkTo(t *testing.T) {
+	c := &chunk.Chunk{
+		Code:      []byte{opcode.Nil, opcode.Return},
+		Constants: []value.Value{},
+	}
+
+	var b bytes.Buffer
+	debug.DisassembleChunkTo(&b, c, "code")
+
+	expected := "== code ==\n0000    0 OpNil\n0001    | OpReturn\n"
+	if b.String() != expected {
+		t.Errorf("DisassembleChunkTo() = %q, expected %q", b.String(), expected)
+	}
+}
+
+func TestDisassembleAllTo(t *testing.T) {
+	f := object.NewFunctionWithChunk("f", 0, &chunk.Chunk{
+		Code:      []byte{opcode.Nil, opcode.Return},
+		Constants: []value.Value{},
+	})
+	c := &chunk.Chunk{
+		Code:      []byte{opcode.Constant, 0, opcode.Return},
+		Constants: []value.Value{f},
+	}
+
+	var b bytes.Buffer
+	debug.DisassembleAllTo(&b, c, "code")
+
+	expected := "== code ==\n0000    0 OpConstant          0 '<fn f>'\n0002    | OpReturn\n" +
+		"== f ==\n0000    0 OpNil\n0001    | OpReturn\n"
+	if b.String() != expected {
+		t.Errorf("DisassembleAllTo() = %q, expected %q", b.String(), expected)
+	}
+}
+
 func captureOutput(f func()) string {
 	old := os.Stdout
 	r, w, _ := os.Pipe()
@@ -0,0 +1,391 @@
+package debugger
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/VannRR/golox/internal/debug"
+	"github.com/VannRR/golox/internal/vm"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const consoleHelp = `Commands:
+  break <line>, b        set a breakpoint on the first line with code at or after line
+  delete [n], d          delete breakpoint n, or all of them
+  info breakpoints       list the breakpoints
+  continue, c            run until the next breakpoint
+  next, n                run to the next line, stepping over calls
+  step, s                run to the next line, stepping into calls
+  stepi, si              run a single instruction
+  finish                 run until the current function returns
+  backtrace, bt          print the active calls
+  frame <n>, f           select frame n for print, locals and disassemble
+  stack                  print the value stack
+  disassemble, disas     print the instructions around the current one
+  list, l                print the source around the current line
+  locals                 print the locals of the selected frame
+  globals                print the globals
+  print <expr>, p        evaluate an expression in the selected frame
+  help, h                print this help
+  quit, q                stop the program and exit
+An empty line repeats the previous command.
+`
+
+// disassembleContext is how many instructions disassemble prints on each
+// side of the current one.
+const disassembleContext = 4
+
+// Console is a gdb-like command prompt for a Session.
+type Console struct {
+	session     *Session
+	lines       [][]byte
+	in          *bufio.Scanner
+	out         io.Writer
+	breakpoints []int
+	frame       int
+	previous    string
+}
+
+// NewConsole reads commands from in and writes its replies to out, source is
+// the program's source for listing lines.
+func NewConsole(session *Session, source []byte, in io.Reader, out io.Writer) *Console {
+	return &Console{
+		session: session,
+		lines:   bytes.Split(source, []byte("\n")),
+		in:      bufio.NewScanner(in),
+		out:     out,
+	}
+}
+
+// Run starts the program paused before its first instruction and reads
+// commands until it exits, it is stopped when the input ends or on quit.
+func (c *Console) Run() vm.InterpretResult {
+	c.session.Start(true)
+	for e := range c.session.Events() {
+		if e.Kind == EventExited {
+			if e.Result == vm.InterpretOk {
+				fmt.Fprintln(c.out, "Program exited normally.")
+			} else if e.Result != vm.InterpretCanceled {
+				fmt.Fprintln(c.out, "Program exited with an error.")
+			}
+			return e.Result
+		}
+
+		c.frame = 0
+		c.stopped(e.Reason)
+		for !c.prompt() {
+		}
+	}
+	return vm.InterpretCanceled
+}
+
+func (c *Console) stopped(reason StopReason) {
+	frames, err := c.session.Frames()
+	if err != nil {
+		return
+	}
+	switch reason {
+	case StopBreakpoint:
+		fmt.Fprintf(c.out, "Breakpoint, %s\n", describe(frames[0]))
+	case StopPause:
+		fmt.Fprintf(c.out, "Paused, %s\n", describe(frames[0]))
+	}
+	c.printLine(frames[0].Span.Line)
+	if reason == StopStep && c.previous == "stepi" {
+		c.disassemble(frames[0], 0)
+	}
+}
+
+func describe(f vm.Frame) string {
+	if f.Function == "" {
+		return fmt.Sprintf("script at line %d", f.Span.Line)
+	}
+	return fmt.Sprintf("%s() at line %d", f.Function, f.Span.Line)
+}
+
+func (c *Console) printLine(line int) {
+	if line >= 1 && line <= len(c.lines) {
+		fmt.Fprintf(c.out, "%d\t%s\n", line, c.lines[line-1])
+	}
+}
+
+// prompt reads and runs one command, it returns true once the program was
+// resumed or stopped.
+func (c *Console) prompt() bool {
+	fmt.Fprint(c.out, "(golox) ")
+	if !c.in.Scan() {
+		fmt.Fprintln(c.out)
+		c.session.Terminate()
+		return true
+	}
+
+	line := strings.TrimSpace(c.in.Text())
+	if line == "" {
+		line = c.previous
+	}
+	command, argument, _ := strings.Cut(line, " ")
+	argument = strings.TrimSpace(argument)
+	command = expand(command)
+	if command != "" {
+		c.previous = command
+		if argument != "" {
+			c.previous += " " + argument
+		}
+	}
+
+	switch command {
+	case "":
+	case "break":
+		c.addBreakpoint(argument)
+	case "delete":
+		c.deleteBreakpoint(argument)
+	case "info":
+		c.info(argument)
+	case "continue":
+		return c.resume(c.session.Continue)
+	case "next":
+		return c.resume(c.session.Next)
+	case "step":
+		return c.resume(c.session.StepIn)
+	case "stepi":
+		return c.resume(c.session.StepInstruction)
+	case "finish":
+		return c.finish()
+	case "backtrace":
+		c.backtrace()
+	case "frame":
+		c.selectFrame(argument)
+	case "stack":
+		c.stack()
+	case "disassemble":
+		if frames, err := c.session.Frames(); err == nil {
+			c.disassemble(frames[c.frame], disassembleContext)
+		}
+	case "list":
+		c.list()
+	case "locals":
+		c.info("locals")
+	case "globals":
+		c.info("globals")
+	case "print":
+		c.print(argument)
+	case "help":
+		fmt.Fprint(c.out, consoleHelp)
+	case "quit":
+		c.session.Terminate()
+		return true
+	default:
+		fmt.Fprintf(c.out, "Unknown command %q, try help.\n", command)
+	}
+	return false
+}
+
+var aliases = map[string]string{
+	"b": "break", "d": "delete", "c": "continue", "n": "next", "s": "step",
+	"si": "stepi", "bt": "backtrace", "where": "backtrace", "f": "frame",
+	"disas": "disassemble", "l": "list", "p": "print", "h": "help", "q": "quit",
+}
+
+func expand(command string) string {
+	if name, ok := aliases[command]; ok {
+		return name
+	}
+	return command
+}
+
+func (c *Console) resume(step func() error) bool {
+	if err := step(); err != nil {
+		fmt.Fprintln(c.out, err)
+		return false
+	}
+	return true
+}
+
+func (c *Console) finish() bool {
+	if frames, err := c.session.Frames(); err == nil && len(frames) == 1 {
+		fmt.Fprintln(c.out, "\"finish\" not meaningful in the outermost frame.")
+		return false
+	}
+	return c.resume(c.session.StepOut)
+}
+
+func (c *Console) setBreakpoints() {
+	lines := make([]int, 0, len(c.breakpoints))
+	for _, line := range c.breakpoints {
+		if line > 0 {
+			lines = append(lines, line)
+		}
+	}
+	c.session.SetBreakpoints(lines)
+}
+
+func (c *Console) addBreakpoint(argument string) {
+	line, err := strconv.Atoi(argument)
+	if err != nil || line < 1 {
+		fmt.Fprintln(c.out, "Usage: break <line>")
+		return
+	}
+
+	bp := c.session.SetBreakpoints([]int{line})[0]
+	if !bp.Verified {
+		fmt.Fprintf(c.out, "No code at or after line %d.\n", line)
+		c.setBreakpoints()
+		return
+	}
+	c.breakpoints = append(c.breakpoints, bp.Line)
+	c.setBreakpoints()
+	fmt.Fprintf(c.out, "Breakpoint %d at line %d.\n", len(c.breakpoints), bp.Line)
+}
+
+func (c *Console) deleteBreakpoint(argument string) {
+	if argument == "" {
+		for i := range c.breakpoints {
+			c.breakpoints[i] = 0
+		}
+		c.setBreakpoints()
+		return
+	}
+
+	n, err := strconv.Atoi(argument)
+	if err != nil || n < 1 || n > len(c.breakpoints) || c.breakpoints[n-1] == 0 {
+		fmt.Fprintf(c.out, "No breakpoint number %s.\n", argument)
+		return
+	}
+	c.breakpoints[n-1] = 0
+	c.setBreakpoints()
+}
+
+func (c *Console) info(argument string) {
+	switch argument {
+	case "breakpoints", "b":
+		if !slices.ContainsFunc(c.breakpoints, func(line int) bool { return line > 0 }) {
+			fmt.Fprintln(c.out, "No breakpoints.")
+			return
+		}
+		for i, line := range c.breakpoints {
+			if line > 0 {
+				fmt.Fprintf(c.out, "%d\tline %d\n", i+1, line)
+			}
+		}
+	case "locals":
+		locals, err := c.session.Locals(c.frame)
+		c.printVariables(locals, err, "No locals.")
+	case "globals":
+		globals, err := c.session.Globals()
+		c.printVariables(globals, err, "No globals.")
+	case "frame":
+		if frames, err := c.session.Frames(); err == nil {
+			fmt.Fprintf(c.out, "#%d %s\n", c.frame, describe(frames[c.frame]))
+		}
+	default:
+		fmt.Fprintln(c.out, "Usage: info breakpoints|locals|globals|frame")
+	}
+}
+
+func (c *Console) printVariables(variables []vm.Variable, err error, none string) {
+	if err != nil {
+		fmt.Fprintln(c.out, err)
+		return
+	}
+	if len(variables) == 0 {
+		fmt.Fprintln(c.out, none)
+	}
+	for _, v := range variables {
+		fmt.Fprintf(c.out, "%s = %s\n", v.Name, v.Value)
+	}
+}
+
+func (c *Console) backtrace() {
+	frames, err := c.session.Frames()
+	if err != nil {
+		fmt.Fprintln(c.out, err)
+		return
+	}
+	for i, f := range frames {
+		marker := " "
+		if i == c.frame {
+			marker = "*"
+		}
+		fmt.Fprintf(c.out, "%s#%d %s\n", marker, i, describe(f))
+	}
+}
+
+func (c *Console) selectFrame(argument string) {
+	frames, err := c.session.Frames()
+	if err != nil {
+		fmt.Fprintln(c.out, err)
+		return
+	}
+	if argument != "" {
+		n, err := strconv.Atoi(argument)
+		if err != nil || n < 0 || n >= len(frames) {
+			fmt.Fprintf(c.out, "No frame %s.\n", argument)
+			return
+		}
+		c.frame = n
+	}
+	fmt.Fprintf(c.out, "#%d %s\n", c.frame, describe(frames[c.frame]))
+	c.printLine(frames[c.frame].Span.Line)
+}
+
+// stack prints the value stack the way the execution tracer does.
+func (c *Console) stack() {
+	stack, err := c.session.Stack()
+	if err != nil {
+		fmt.Fprintln(c.out, err)
+		return
+	}
+	fmt.Fprint(c.out, "          ")
+	for _, v := range stack {
+		fmt.Fprintf(c.out, "[ %s ]", v)
+	}
+	fmt.Fprintln(c.out)
+}
+
+// disassemble prints the instruction at a frame's ip with context
+// instructions on each side, marking the current one.
+func (c *Console) disassemble(f vm.Frame, context int) {
+	offsets := f.Chunk.Instructions()
+	current, _ := slices.BinarySearch(offsets, f.IP)
+	if c.frame > 0 {
+		// Callers are paused on the call they made, just before their ip.
+		current--
+	}
+
+	for i := max(current-context, 0); i <= min(current+context, len(offsets)-1); i++ {
+		if i == current {
+			fmt.Fprint(c.out, "=> ")
+		} else {
+			fmt.Fprint(c.out, "   ")
+		}
+		debug.DisassembleInstructionTo(c.out, f.Chunk, offsets[i])
+	}
+}
+
+func (c *Console) list() {
+	frames, err := c.session.Frames()
+	if err != nil {
+		fmt.Fprintln(c.out, err)
+		return
+	}
+	line := frames[c.frame].Span.Line
+	for l := max(line-5, 1); l <= min(line+5, len(c.lines)); l++ {
+		c.printLine(l)
+	}
+}
+
+func (c *Console) print(expression string) {
+	if expression == "" {
+		fmt.Fprintln(c.out, "Usage: print <expr>")
+		return
+	}
+	result, err := c.session.Evaluate(c.frame, expression)
+	if err != nil {
+		fmt.Fprintln(c.out, err)
+		return
+	}
+	fmt.Fprintln(c.out, result)
+}
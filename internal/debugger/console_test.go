@@ -0,0 +1,100 @@
+package debugger
+
+import (
+	"github.com/VannRR/golox/internal/vm"
+	"strings"
+	"testing"
+)
+
+// runConsole debugs testSource with the given commands and returns the
+// console's output, with the program's output mixed in.
+func runConsole(t *testing.T, commands ...string) (string, vm.InterpretResult) {
+	s, _ := newSession(t, testSource)
+	var out strings.Builder
+	s.vm.SetOutput(&out, &out)
+	c := NewConsole(s, []byte(testSource), strings.NewReader(strings.Join(commands, "\n")+"\n"), &out)
+	result := c.Run()
+	return out.String(), result
+}
+
+func Test_Console(t *testing.T) {
+	output, result := runConsole(t,
+		"break 3",
+		"b 99",
+		"info breakpoints",
+		"c",
+		"bt",
+		"locals",
+		"print a + b + 100",
+		"frame 1",
+		"locals",
+		"stack",
+		"globals",
+		"finish",
+		"next",
+		"",
+		"delete",
+		"continue",
+	)
+	if result != vm.InterpretOk {
+		t.Errorf("Run() = %d, expected InterpretOk", result)
+	}
+
+	expected := []string{
+		"1\tvar total = 0;\n(golox) ",
+		"Breakpoint 1 at line 3.\n",
+		"No code at or after line 99.\n",
+		"1\tline 3\n",
+		"Breakpoint, add() at line 3\n3\t  var sum = a + b;\n",
+		"*#0 add() at line 3\n #1 script at line 7\n",
+		"a = 0\nb = 0\n",
+		"100\n",
+		"#1 script at line 7\n7\t  total = add(total, i);\n",
+		"i = 0\n",
+		"          [ 0 ][ total ][ <fn add> ][ 0 ][ 0 ]\n",
+		"add = <fn add>\ntotal = 0\n",
+		"(golox) 7\t  total = add(total, i);\n(golox) 8\t}\n(golox) 6\tfor",
+		"1\nProgram exited normally.\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(output, e) {
+			t.Errorf("Expected the output to contain %q, got\n%s", e, output)
+		}
+	}
+}
+
+func Test_Console_instructions(t *testing.T) {
+	output, _ := runConsole(t, "stepi", "disassemble", "quit")
+
+	expected := []string{
+		"(golox) 1\tvar total = 0;\n=> 0002    | OpConstant          1 '0'\n(golox) ",
+		"   0000    1 OpConstant          0 'total'\n=> 0002    | OpConstant          1 '0'\n   0004    | OpDefineGlobal",
+		"   0010    | OpDefineGlobal      2 'add'\n(golox) ",
+	}
+	for _, e := range expected {
+		if !strings.Contains(output, e) {
+			t.Errorf("Expected the output to contain %q, got\n%s", e, output)
+		}
+	}
+}
+
+func Test_Console_errors(t *testing.T) {
+	output, result := runConsole(t, "finish", "frame 5", "delete 3", "break x", "print 1 +", "jump")
+	if result != vm.InterpretCanceled {
+		t.Errorf("Run() = %d, expected the end of input to stop the program", result)
+	}
+
+	expected := []string{
+		"\"finish\" not meaningful in the outermost frame.\n",
+		"No frame 5.\n",
+		"No breakpoint number 3.\n",
+		"Usage: break <line>\n",
+		"Expect expression.\n",
+		"Unknown command \"jump\", try help.\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(output, e) {
+			t.Errorf("Expected the output to contain %q, got\n%s", e, output)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+// Package debugger runs a program on its own goroutine and pauses it at
+// breakpoints and steps, for the debug adapter and the command line debugger.
+//
+// A Session is driven by one goroutine: it resumes the program and inspects
+// it while paused, and reads the Events channel to learn when it stops.
+package debugger
+
+import (
+	"errors"
+	"github.com/VannRR/golox/internal/chunk"
+	"github.com/VannRR/golox/internal/object"
+	"github.com/VannRR/golox/internal/value"
+	"github.com/VannRR/golox/internal/vm"
+	"io"
+	"sort"
+	"sync/atomic"
+)
+
+// ErrRunning is returned when the program can't be inspected or resumed
+// because it isn't paused.
+var ErrRunning = errors.New("the program is not paused")
+
+type StopReason string
+
+const (
+	StopEntry      StopReason = "entry"
+	StopBreakpoint StopReason = "breakpoint"
+	StopStep       StopReason = "step"
+	StopPause      StopReason = "pause"
+)
+
+type EventKind uint8
+
+const (
+	EventStopped EventKind = iota
+	EventExited
+)
+
+// Event reports that the program paused, or that it finished with Result
+// and, after a runtime error, Err.
+type Event struct {
+	Kind   EventKind
+	Reason StopReason
+	Result vm.InterpretResult
+	Err    *vm.RuntimeError
+}
+
+// Breakpoint is where a requested line ended up, on the first line at or
+// after it that has code. It isn't verified when no such line exists.
+type Breakpoint struct {
+	Line     int
+	Verified bool
+}
+
+type stepMode uint8
+
+const (
+	stepContinue stepMode = iota
+	stepOver
+	stepIn
+	stepOut
+	stepInstruction
+)
+
+type location struct {
+	chunk  *chunk.Chunk
+	offset int
+}
+
+type command struct {
+	inspect func(v *vm.VM)
+	done    chan struct{}
+	mode    stepMode
+	stop    bool
+}
+
+type Session struct {
+	program     *vm.Program
+	vm          *vm.VM
+	lines       map[int][]location
+	breakpoints atomic.Pointer[map[location]bool]
+	events      chan Event
+	commands    chan command
+	paused      atomic.Bool
+	pause       atomic.Bool
+	stop        atomic.Bool
+
+	// Only used by the goroutine running the program.
+	entry     bool
+	mode      stepMode
+	stepDepth int
+	stepLine  int
+}
+
+// NewSession prepares to debug program, what it prints goes to stdout and
+// its runtime errors to stderr.
+func NewSession(program *vm.Program, stdout io.Writer, stderr io.Writer) *Session {
+	s := &Session{
+		program:  program,
+		vm:       vm.NewVM(),
+		lines:    make(map[int][]location),
+		events:   make(chan Event, 1),
+		commands: make(chan command),
+	}
+	s.vm.SetOutput(stdout, stderr)
+	s.breakpoints.Store(&map[location]bool{})
+	s.addLines(program.Chunk())
+	return s
+}
+
+// VM returns the VM the program runs on, for setting it up before Start.
+func (s *Session) VM() *vm.VM {
+	return s.vm
+}
+
+// addLines records where each run of instructions on the same line starts,
+// in c and in the functions it defines.
+func (s *Session) addLines(c *chunk.Chunk) {
+	previous := 0
+	for _, offset := range c.Instructions() {
+		if line := c.GetSpan(offset).Line; offset == 0 || line != previous {
+			s.lines[line] = append(s.lines[line], location{chunk: c, offset: offset})
+			previous = line
+		}
+	}
+	for _, constant := range c.Constants {
+		if function, ok := constant.(*object.ObjFunction); ok {
+			s.addLines(function.Chunk())
+		}
+	}
+}
+
+// Events delivers a stopped event each time the program pauses and a final
+// exited event, it must be read for the program to make progress.
+func (s *Session) Events() <-chan Event {
+	return s.events
+}
+
+// Start runs the program, pausing before its first instruction when
+// stopOnEntry is set.
+func (s *Session) Start(stopOnEntry bool) {
+	s.entry = stopOnEntry
+	s.vm.SetDebugHook(s.hook)
+	go func() {
+		result := s.vm.Run(s.program)
+		s.events <- Event{Kind: EventExited, Result: result, Err: s.vm.Err()}
+		close(s.events)
+	}()
+}
+
+// SetBreakpoints replaces the breakpoints with ones on lines.
+func (s *Session) SetBreakpoints(lines []int) []Breakpoint {
+	known := make([]int, 0, len(s.lines))
+	for line := range s.lines {
+		known = append(known, line)
+	}
+	sort.Ints(known)
+
+	set := make(map[location]bool)
+	breakpoints := make([]Breakpoint, 0, len(lines))
+	for _, line := range lines {
+		i := sort.SearchInts(known, line)
+		if i == len(known) {
+			breakpoints = append(breakpoints, Breakpoint{Line: line})
+			continue
+		}
+		for _, loc := range s.lines[known[i]] {
+			set[loc] = true
+		}
+		breakpoints = append(breakpoints, Breakpoint{Line: known[i], Verified: true})
+	}
+	s.breakpoints.Store(&set)
+	return breakpoints
+}
+
+// Continue resumes the program until the next breakpoint.
+func (s *Session) Continue() error {
+	return s.resume(command{mode: stepContinue})
+}
+
+// Next runs until the next line of the current function, stepping over
+// calls.
+func (s *Session) Next() error {
+	return s.resume(command{mode: stepOver})
+}
+
+// StepIn runs until the next line, following calls.
+func (s *Session) StepIn() error {
+	return s.resume(command{mode: stepIn})
+}
+
+// StepOut runs until the current function returns.
+func (s *Session) StepOut() error {
+	return s.resume(command{mode: stepOut})
+}
+
+// StepInstruction runs a single instruction.
+func (s *Session) StepInstruction() error {
+	return s.resume(command{mode: stepInstruction})
+}
+
+// Pause asks the running program to stop before its next instruction.
+func (s *Session) Pause() {
+	s.pause.Store(true)
+}
+
+// Terminate stops the program whether it is paused or running.
+func (s *Session) Terminate() {
+	s.stop.Store(true)
+	s.resume(command{stop: true})
+}
+
+func (s *Session) resume(cmd command) error {
+	if !s.paused.CompareAndSwap(true, false) {
+		return ErrRunning
+	}
+	s.commands <- cmd
+	return nil
+}
+
+// Frames returns the paused program's active calls, innermost first.
+func (s *Session) Frames() ([]vm.Frame, error) {
+	var frames []vm.Frame
+	err := s.inspect(func(v *vm.VM) {
+		frames = v.Frames()
+	})
+	return frames, err
+}
+
+// Locals returns the locals in scope in a frame, counted from zero for the
+// innermost.
+func (s *Session) Locals(frame int) ([]vm.Variable, error) {
+	var locals []vm.Variable
+	err := s.inspect(func(v *vm.VM) {
+		locals = v.Locals(frame)
+	})
+	return locals, err
+}
+
+// Stack returns the paused program's value stack, bottom first.
+func (s *Session) Stack() ([]value.Value, error) {
+	var stack []value.Value
+	err := s.inspect(func(v *vm.VM) {
+		stack = v.Stack()
+	})
+	return stack, err
+}
+
+func (s *Session) Globals() ([]vm.Variable, error) {
+	var globals []vm.Variable
+	err := s.inspect(func(v *vm.VM) {
+		globals = v.Globals()
+	})
+	return globals, err
+}
+
+// Evaluate runs a Lox expression in a frame of the paused program.
+func (s *Session) Evaluate(frame int, expression string) (value.Value, error) {
+	var result value.Value
+	var evalErr error
+	err := s.inspect(func(v *vm.VM) {
+		result, evalErr = v.Evaluate(frame, expression)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, evalErr
+}
+
+// inspect runs f on the program's goroutine while it is paused.
+func (s *Session) inspect(f func(v *vm.VM)) error {
+	if !s.paused.Load() {
+		return ErrRunning
+	}
+	done := make(chan struct{})
+	s.commands <- command{inspect: f, done: done}
+	<-done
+	return nil
+}
+
+func (s *Session) hook(v *vm.VM) bool {
+	if s.stop.Load() {
+		return false
+	}
+	reason, ok := s.stopReason(v)
+	if !ok {
+		return true
+	}
+
+	// Terminate may have come in while deciding to stop, when it didn't see
+	// the pause it won't send the stop command.
+	s.paused.Store(true)
+	if s.stop.Load() && s.paused.CompareAndSwap(true, false) {
+		return false
+	}
+	s.events <- Event{Kind: EventStopped, Reason: reason}
+	for cmd := range s.commands {
+		if cmd.inspect != nil {
+			cmd.inspect(v)
+			close(cmd.done)
+			continue
+		}
+		if cmd.stop {
+			return false
+		}
+
+		c, ip := v.Location()
+		s.mode, s.stepDepth, s.stepLine = cmd.mode, v.Depth(), c.GetSpan(ip).Line
+		return true
+	}
+	return false
+}
+
+// stopReason decides whether to pause before the instruction about to run.
+func (s *Session) stopReason(v *vm.VM) (StopReason, bool) {
+	if s.entry {
+		s.entry = false
+		return StopEntry, true
+	}
+	if s.pause.Swap(false) {
+		return StopPause, true
+	}
+
+	c, ip := v.Location()
+	if (*s.breakpoints.Load())[location{chunk: c, offset: ip}] {
+		return StopBreakpoint, true
+	}
+
+	depth, line := v.Depth(), c.GetSpan(ip).Line
+	switch s.mode {
+	case stepOver:
+		if depth < s.stepDepth || (depth == s.stepDepth && line != s.stepLine) {
+			return StopStep, true
+		}
+	case stepIn:
+		if depth != s.stepDepth || line != s.stepLine {
+			return StopStep, true
+		}
+	case stepOut:
+		if depth < s.stepDepth {
+			return StopStep, true
+		}
+	case stepInstruction:
+		return StopStep, true
+	}
+	return "", false
+}
@@ -0,0 +1,211 @@
+package debugger
+
+import (
+	"fmt"
+	"github.com/VannRR/golox/internal/debug"
+	"github.com/VannRR/golox/internal/vm"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSource = `var total = 0;
+fun add(a, b) {
+  var sum = a + b;
+  return sum;
+}
+for (var i = 0; i < 2; i = i + 1) {
+  total = add(total, i);
+}
+print total;`
+
+func newSession(t *testing.T, source string) (*Session, *strings.Builder) {
+	debug.PrintCode, debug.TraceExecution = false, false
+	s := []byte(source)
+	program, ok := vm.Compile(&s)
+	if !ok {
+		t.Fatalf("Expected source to compile")
+	}
+	var stdout strings.Builder
+	return NewSession(program, &stdout, &strings.Builder{}), &stdout
+}
+
+func nextEvent(t *testing.T, s *Session) Event {
+	select {
+	case e := <-s.Events():
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for an event")
+		return Event{}
+	}
+}
+
+// stopped waits for the program to pause and describes where, as the reason
+// followed by function:line for each frame.
+func stopped(t *testing.T, s *Session) string {
+	e := nextEvent(t, s)
+	if e.Kind != EventStopped {
+		t.Fatalf("Expected a stopped event, got %v", e)
+	}
+	frames, err := s.Frames()
+	if err != nil {
+		t.Fatalf("Frames() = %v", err)
+	}
+	parts := []string{string(e.Reason)}
+	for _, f := range frames {
+		parts = append(parts, fmt.Sprintf("%s:%d", f.Function, f.Span.Line))
+	}
+	return strings.Join(parts, " ")
+}
+
+func exited(t *testing.T, s *Session) Event {
+	e := nextEvent(t, s)
+	if e.Kind != EventExited {
+		t.Fatalf("Expected an exited event, got %v", e)
+	}
+	return e
+}
+
+func sprintVariables(variables []vm.Variable) string {
+	parts := make([]string, 0, len(variables))
+	for _, v := range variables {
+		parts = append(parts, fmt.Sprintf("%s=%s", v.Name, v.Value))
+	}
+	return strings.Join(parts, " ")
+}
+
+func Test_SetBreakpoints(t *testing.T) {
+	s, _ := newSession(t, testSource)
+	got := s.SetBreakpoints([]int{3, 10, 8, 1})
+	expected := []Breakpoint{{Line: 3, Verified: true}, {Line: 10}, {Line: 8, Verified: true}, {Line: 1, Verified: true}}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("SetBreakpoints() = %v, expected %v", got, expected)
+	}
+}
+
+func Test_Session_breakpoints(t *testing.T) {
+	s, stdout := newSession(t, testSource)
+	s.SetBreakpoints([]int{3})
+	s.Start(false)
+
+	for _, expected := range []string{"a=0 b=0", "a=0 b=1"} {
+		if got := stopped(t, s); got != "breakpoint add:3 :7" {
+			t.Errorf("Stopped at %s, expected breakpoint add:3 :7", got)
+		}
+		if locals, _ := s.Locals(0); sprintVariables(locals) != expected {
+			t.Errorf("Locals(0) = %s, expected %s", sprintVariables(locals), expected)
+		}
+		if err := s.Continue(); err != nil {
+			t.Fatalf("Continue() = %v", err)
+		}
+	}
+
+	if e := exited(t, s); e.Result != vm.InterpretOk {
+		t.Errorf("Exited with %d, expected InterpretOk", e.Result)
+	}
+	if stdout.String() != "1\n" {
+		t.Errorf("stdout = %q, expected 1", stdout.String())
+	}
+	if err := s.Continue(); err != ErrRunning {
+		t.Errorf("Continue() after exit = %v, expected ErrRunning", err)
+	}
+}
+
+func Test_Session_steps(t *testing.T) {
+	s, _ := newSession(t, testSource)
+	s.SetBreakpoints([]int{7})
+	s.Start(true)
+
+	steps := []struct {
+		name     string
+		step     func() error
+		expected string
+	}{
+		{name: "entry", expected: "entry :1"},
+		{name: "continue", step: s.Continue, expected: "breakpoint :7"},
+		{name: "step in", step: s.StepIn, expected: "step add:3 :7"},
+		{name: "next", step: s.Next, expected: "step add:4 :7"},
+		{name: "step out", step: s.StepOut, expected: "step :7"},
+		{name: "next", step: s.Next, expected: "step :8"},
+		{name: "next", step: s.Next, expected: "step :6"},
+		{name: "next", step: s.Next, expected: "breakpoint :7"},
+		{name: "next over the call", step: s.Next, expected: "step :8"},
+		{name: "instruction", step: s.StepInstruction, expected: "step :6"},
+	}
+	for _, step := range steps {
+		if step.step != nil {
+			if err := step.step(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+		}
+		if got := stopped(t, s); got != step.expected {
+			t.Fatalf("%s: stopped at %s, expected %s", step.name, got, step.expected)
+		}
+	}
+
+	s.SetBreakpoints(nil)
+	s.Continue()
+	exited(t, s)
+}
+
+func Test_Session_inspect(t *testing.T) {
+	s, stdout := newSession(t, testSource)
+	s.SetBreakpoints([]int{4})
+	s.Start(false)
+	stopped(t, s)
+
+	if locals, _ := s.Locals(1); sprintVariables(locals) != "i=0" {
+		t.Errorf("Locals(1) = %s, expected i=0", sprintVariables(locals))
+	}
+	if globals, _ := s.Globals(); sprintVariables(globals) != "add=<fn add> total=0" {
+		t.Errorf("Globals() = %s", sprintVariables(globals))
+	}
+	if got, err := s.Evaluate(0, "sum = a + b + 10"); err != nil || got.String() != "10" {
+		t.Errorf("Evaluate() = %v, %v, expected 10", got, err)
+	}
+	if _, err := s.Evaluate(1, "sum"); err == nil || err.Error() != "Undefined variable 'sum'." {
+		t.Errorf("Evaluate() error = %v, expected sum to be undefined in the caller", err)
+	}
+
+	s.SetBreakpoints(nil)
+	s.Continue()
+	exited(t, s)
+	if stdout.String() != "11\n" {
+		t.Errorf("stdout = %q, expected the evaluated assignment to change the result", stdout.String())
+	}
+	if _, err := s.Globals(); err != ErrRunning {
+		t.Errorf("Globals() after exit = %v, expected ErrRunning", err)
+	}
+}
+
+func Test_Session_pause(t *testing.T) {
+	s, _ := newSession(t, "var i = 0;\nwhile (true) {\n  i = i + 1;\n}")
+	s.Start(false)
+	s.Pause()
+	if got := stopped(t, s); !strings.HasPrefix(got, "pause :") {
+		t.Errorf("Stopped at %s, expected a pause", got)
+	}
+
+	s.Terminate()
+	if e := exited(t, s); e.Result != vm.InterpretCanceled {
+		t.Errorf("Exited with %d, expected InterpretCanceled", e.Result)
+	}
+}
+
+func Test_Session_terminateRunning(t *testing.T) {
+	s, _ := newSession(t, "while (true) {}")
+	s.Start(false)
+	s.Terminate()
+	if e := exited(t, s); e.Result != vm.InterpretCanceled {
+		t.Errorf("Exited with %d, expected InterpretCanceled", e.Result)
+	}
+}
+
+func Test_Session_VM(t *testing.T) {
+	s, stdout := newSession(t, "print argv(0);")
+	s.VM().SetArgs([]string{"configured"})
+	s.Start(false)
+	if e := exited(t, s); e.Result != vm.InterpretOk || stdout.String() != "configured\n" {
+		t.Errorf("Exited with %d printing %q, expected the VM's arguments to be used", e.Result, stdout.String())
+	}
+}
@@ -0,0 +1,34 @@
+package diagnostic
+
+// Codes identify a kind of diagnostic so tools can match on it without
+// parsing the message, once published a code keeps its meaning.
+const (
+	// Compile errors.
+	CodeSyntax            = "E0001"
+	CodeInvalidToken      = "E0002"
+	CodeInvalidAssignment = "E0003"
+	CodeDuplicateVariable = "E0004"
+	CodeOwnInitializer    = "E0005"
+	CodeCompilerLimit     = "E0006"
+	CodeInvalidReturn     = "E0007"
+
+	// Runtime errors.
+	CodeType              = "R0001"
+	CodeUndefinedVariable = "R0002"
+	CodeStackOverflow     = "R0003"
+	CodeMemoryLimit       = "R0004"
+	CodeInstructionLimit  = "R0005"
+	CodeCanceled          = "R0006"
+	CodeInvalidProgram    = "R0007"
+	CodeArity             = "R0008"
+	CodeNotCallable       = "R0009"
+	CodeNative            = "R0010"
+
+	// Lint warnings.
+	CodeUnusedLocal          = "W0001"
+	CodeUnusedGlobal         = "W0002"
+	CodeShadowedVariable     = "W0003"
+	CodeUnreachableCode      = "W0004"
+	CodeConstantCondition    = "W0005"
+	CodeUndeclaredAssignment = "W0006"
+)
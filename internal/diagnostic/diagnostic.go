@@ -0,0 +1,205 @@
+package diagnostic
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/VannRR/golox/internal/token"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+type Severity uint8
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return fmt.Sprintf("severity(%d)", uint8(s))
+	}
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Message  string
+	Span     token.Span
+	Notes    []string
+	Hints    []string
+}
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[1;31m"
+	colorYellow = "\x1b[1;33m"
+	colorBlue   = "\x1b[1;34m"
+	colorCyan   = "\x1b[1;36m"
+)
+
+// Renderer prints diagnostics with the offending source line and a caret
+// underline, source may be nil when only bytecode is available.
+type Renderer struct {
+	source []byte
+	file   string
+	color  bool
+}
+
+func NewRenderer(source []byte, file string, color bool) *Renderer {
+	if file == "" {
+		file = "script"
+	}
+	return &Renderer{source: source, file: file, color: color}
+}
+
+// IsTerminal reports whether w is a terminal that should get coloured output,
+// honouring the NO_COLOR convention.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (r *Renderer) paint(color string, text string) string {
+	if !r.color {
+		return text
+	}
+	return color + text + colorReset
+}
+
+func (r *Renderer) Render(w io.Writer, d Diagnostic) {
+	severityColor := colorRed
+	if d.Severity == Warning {
+		severityColor = colorYellow
+	}
+
+	label := d.Severity.String()
+	if d.Code != "" {
+		label += "[" + d.Code + "]"
+	}
+	fmt.Fprintf(w, "%s%s\n", r.paint(severityColor, label), r.paint(colorBold, ": "+d.Message))
+
+	line, ok := r.line(d.Span)
+	gutter := strings.Repeat(" ", len(fmt.Sprint(d.Span.Line)))
+	if d.Span.Line == 0 {
+		fmt.Fprintf(w, "%s%s %s\n", gutter, r.paint(colorBlue, "-->"), r.file)
+	} else {
+		fmt.Fprintf(w, "%s%s %s:%d:%d\n", gutter, r.paint(colorBlue, "-->"), r.file, d.Span.Line, d.Span.Column)
+	}
+
+	if ok {
+		fmt.Fprintf(w, "%s %s\n", gutter, r.paint(colorBlue, "|"))
+		fmt.Fprintf(w, "%s %s %s\n", r.paint(colorBlue, fmt.Sprint(d.Span.Line)), r.paint(colorBlue, "|"), line)
+		padding, width := underline(line, d.Span)
+		fmt.Fprintf(w, "%s %s %s%s\n", gutter, r.paint(colorBlue, "|"), padding,
+			r.paint(severityColor, strings.Repeat("^", width)))
+	}
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(w, "%s %s %s\n", gutter, r.paint(colorBlue, "="), r.paint(colorBold, "note:")+" "+note)
+	}
+	for _, hint := range d.Hints {
+		fmt.Fprintf(w, "%s %s %s\n", gutter, r.paint(colorBlue, "="), r.paint(colorCyan, "help:")+" "+hint)
+	}
+}
+
+func (r *Renderer) RenderAll(w io.Writer, diagnostics []Diagnostic) {
+	for _, d := range diagnostics {
+		r.Render(w, d)
+	}
+}
+
+// line returns the source line the span starts on without its line break.
+func (r *Renderer) line(span token.Span) (string, bool) {
+	if r.source == nil || span.Line == 0 || span.Offset > len(r.source) {
+		return "", false
+	}
+
+	start := bytes.LastIndexByte(r.source[:span.Offset], '\n') + 1
+	end := bytes.IndexByte(r.source[span.Offset:], '\n')
+	if end == -1 {
+		end = len(r.source)
+	} else {
+		end += span.Offset
+	}
+
+	return strings.TrimRight(string(r.source[start:end]), "\r"), true
+}
+
+// underline returns the whitespace that lines a caret up under the span's
+// column, keeping tabs so it matches the rendered line, and how many carets
+// cover the span on that line.
+func underline(line string, span token.Span) (string, int) {
+	column := min(max(span.Column-1, 0), len(line))
+
+	var padding strings.Builder
+	for _, c := range line[:column] {
+		if c == '\t' {
+			padding.WriteByte('\t')
+		} else {
+			padding.WriteByte(' ')
+		}
+	}
+
+	end := min(column+span.Length, len(line))
+	width := max(utf8.RuneCountInString(line[column:end]), 1)
+	return padding.String(), width
+}
+
+// Suggest returns the candidate closest to name by edit distance, if one is
+// close enough to be a likely typo.
+func Suggest(name string, candidates []string) (string, bool) {
+	best, bestDistance := "", max(1, len(name)/3)+1
+
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		d := editDistance(name, candidate)
+		if d < bestDistance || (d == bestDistance && best != "" && best[0] != name[0] && candidate[0] == name[0]) {
+			best, bestDistance = candidate, d
+		}
+	}
+
+	return best, best != ""
+}
+
+// editDistance counts the insertions, deletions, substitutions and adjacent
+// transpositions needed to turn a into b.
+func editDistance(a string, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
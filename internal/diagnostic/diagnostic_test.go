@@ -0,0 +1,131 @@
+package diagnostic
+
+import (
+	"bytes"
+	"github.com/VannRR/golox/internal/token"
+	"strings"
+	"testing"
+)
+
+func Test_Render(t *testing.T) {
+	source := []byte("var a = 1;\n\tprint a +;\n")
+	d := Diagnostic{
+		Severity: Error,
+		Message:  "Expect expression.",
+		Span:     token.Span{Line: 2, Column: 11, Offset: 21, Length: 1},
+		Notes:    []string{"found ';'"},
+		Hints:    []string{"remove the '+'"},
+	}
+
+	var out bytes.Buffer
+	NewRenderer(source, "test.lox", false).Render(&out, d)
+
+	expected := strings.Join([]string{
+		"error: Expect expression.",
+		" --> test.lox:2:11",
+		"  |",
+		"2 | \tprint a +;",
+		"  | \t         ^",
+		"  = note: found ';'",
+		"  = help: remove the '+'",
+		"",
+	}, "\n")
+
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func Test_Render_noSource(t *testing.T) {
+	d := Diagnostic{Severity: Warning, Message: "careful", Span: token.Span{Line: 3, Column: 1}}
+
+	var out bytes.Buffer
+	NewRenderer(nil, "", false).Render(&out, d)
+
+	expected := "warning: careful\n --> script:3:1\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func Test_Render_color(t *testing.T) {
+	source := []byte("a")
+	d := Diagnostic{Severity: Error, Message: "bad", Span: token.Span{Line: 1, Column: 1, Length: 1}}
+
+	var out bytes.Buffer
+	NewRenderer(source, "", true).Render(&out, d)
+
+	if !strings.Contains(out.String(), colorRed+"error"+colorReset) {
+		t.Errorf("Expected coloured severity, got %q", out.String())
+	}
+}
+
+func Test_underline(t *testing.T) {
+	tests := []struct {
+		line    string
+		span    token.Span
+		padding string
+		width   int
+	}{
+		{"abc def", token.Span{Column: 5, Length: 3}, "    ", 3},
+		{"\tx", token.Span{Column: 2, Length: 1}, "\t", 1},
+		{"é = \"日本\"", token.Span{Column: 6, Length: 8}, "    ", 4},
+		{"abc", token.Span{Column: 4, Length: 0}, "   ", 1},
+		{"abc", token.Span{Column: 2, Length: 10}, " ", 2},
+	}
+
+	for _, tt := range tests {
+		padding, width := underline(tt.line, tt.span)
+		if padding != tt.padding || width != tt.width {
+			t.Errorf("Expected padding %q and width %d for %q, got %q and %d", tt.padding, tt.width, tt.line, padding, width)
+		}
+	}
+}
+
+func Test_Suggest(t *testing.T) {
+	candidates := []string{"and", "or", "print", "return", "var", "while"}
+
+	tests := []struct {
+		name     string
+		expected string
+		ok       bool
+	}{
+		{"pritn", "print", true},
+		{"retrun", "return", true},
+		{"vr", "var", true},
+		{"whiel", "while", true},
+		{"print", "", false},
+		{"banana", "", false},
+	}
+
+	for _, tt := range tests {
+		actual, ok := Suggest(tt.name, candidates)
+		if actual != tt.expected || ok != tt.ok {
+			t.Errorf("Expected Suggest(%q) to be (%q, %v), got (%q, %v)", tt.name, tt.expected, tt.ok, actual, ok)
+		}
+	}
+}
+
+func Test_editDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "abc", 3},
+		{"print", "print", 0},
+		{"pritn", "print", 1},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, tt := range tests {
+		if actual := editDistance(tt.a, tt.b); actual != tt.expected {
+			t.Errorf("Expected editDistance(%q, %q) to be %d, got %d", tt.a, tt.b, tt.expected, actual)
+		}
+	}
+}
+
+func Test_IsTerminal(t *testing.T) {
+	if IsTerminal(&bytes.Buffer{}) {
+		t.Errorf("Expected a buffer not to be a terminal")
+	}
+}
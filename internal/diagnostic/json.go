@@ -0,0 +1,63 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type jsonDiagnostic struct {
+	Severity  string   `json:"severity"`
+	Code      string   `json:"code"`
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Column    int      `json:"column"`
+	EndLine   int      `json:"endLine"`
+	EndColumn int      `json:"endColumn"`
+	Message   string   `json:"message"`
+	Notes     []string `json:"notes,omitempty"`
+	Hints     []string `json:"hints,omitempty"`
+}
+
+// WriteJSON writes diagnostics as a JSON array, one object per diagnostic.
+// Columns are 1-based byte columns and the end position is exclusive.
+func WriteJSON(w io.Writer, file string, source []byte, diagnostics []Diagnostic) error {
+	out := make([]jsonDiagnostic, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		endLine, endColumn := End(source, d)
+		out = append(out, jsonDiagnostic{
+			Severity:  d.Severity.String(),
+			Code:      d.Code,
+			File:      file,
+			Line:      d.Span.Line,
+			Column:    d.Span.Column,
+			EndLine:   endLine,
+			EndColumn: endColumn,
+			Message:   d.Message,
+			Notes:     d.Notes,
+			Hints:     d.Hints,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// End returns the line and column just past the diagnostic's span, following
+// line breaks inside the span when the source is available.
+func End(source []byte, d Diagnostic) (int, int) {
+	line, column := d.Span.Line, d.Span.Column
+	if d.Span.Offset+d.Span.Length > len(source) {
+		return line, column + d.Span.Length
+	}
+
+	for _, c := range source[d.Span.Offset : d.Span.Offset+d.Span.Length] {
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
@@ -0,0 +1,85 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/VannRR/golox/internal/token"
+	"testing"
+)
+
+func Test_WriteJSON(t *testing.T) {
+	source := []byte("print \"a\nb\" + 1;")
+	diagnostics := []Diagnostic{
+		{
+			Severity: Error,
+			Code:     CodeType,
+			Message:  "Operands must be of the same type.",
+			Span:     token.Span{Line: 1, Column: 7, Offset: 6, Length: 5},
+			Hints:    []string{"convert one side"},
+		},
+		{
+			Severity: Warning,
+			Code:     CodeSyntax,
+			Message:  "careful",
+			Span:     token.Span{Line: 2, Column: 5, Offset: 12, Length: 1},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := WriteJSON(&out, "test.lox", source, diagnostics); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+
+	var decoded []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Expected valid JSON, got %v:\n%s", err, out.String())
+	}
+
+	expected := []map[string]any{
+		{
+			"severity": "error", "code": "R0001", "file": "test.lox",
+			"line": 1.0, "column": 7.0, "endLine": 2.0, "endColumn": 3.0,
+			"message": "Operands must be of the same type.", "hints": []any{"convert one side"},
+		},
+		{
+			"severity": "warning", "code": "E0001", "file": "test.lox",
+			"line": 2.0, "column": 5.0, "endLine": 2.0, "endColumn": 6.0,
+			"message": "careful",
+		},
+	}
+
+	if len(decoded) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d", len(expected), len(decoded))
+	}
+	for i := range expected {
+		if got, want := mustMarshal(t, decoded[i]), mustMarshal(t, expected[i]); got != want {
+			t.Errorf("Expected diagnostic %d to be %s, got %s", i, want, got)
+		}
+	}
+}
+
+func Test_WriteJSON_empty(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteJSON(&out, "test.lox", nil, nil); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("Expected an empty array, got %q", out.String())
+	}
+}
+
+func Test_End(t *testing.T) {
+	d := Diagnostic{Span: token.Span{Line: 3, Column: 2, Offset: 40, Length: 4}}
+
+	if line, column := End(nil, d); line != 3 || column != 6 {
+		t.Errorf("Expected 3:6 without source, got %d:%d", line, column)
+	}
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,57 @@
+package diagnostic
+
+import (
+	"fmt"
+	"github.com/VannRR/golox/internal/token"
+	"sort"
+)
+
+var keywords = func() []string {
+	names := make([]string, 0, len(token.Keywords))
+	for name := range token.Keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}()
+
+// AtToken returns an error reported at t, noting what was found there. When
+// previous or t looks like a misspelt keyword, such as 'pritn' for 'print',
+// the keyword is suggested.
+func AtToken(code string, message string, t token.Token, previous token.Token) Diagnostic {
+	d := Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Message:  message,
+		Span:     t.Span(),
+	}
+
+	switch t.Type {
+	case token.Eof:
+		d.Notes = append(d.Notes, "reached the end of the source")
+	case token.Error:
+		// Nothing.
+	default:
+		d.Notes = append(d.Notes, fmt.Sprintf("found '%s'", t.Lexeme))
+	}
+
+	for _, candidate := range []token.Token{previous, t} {
+		if hint, ok := keywordHint(candidate); ok {
+			d.Hints = append(d.Hints, hint)
+			break
+		}
+	}
+
+	return d
+}
+
+func keywordHint(t token.Token) (string, bool) {
+	if t.Type != token.Identifier || len(t.Lexeme) < 2 {
+		return "", false
+	}
+	keyword, ok := Suggest(string(t.Lexeme), keywords)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("did you mean `%s` instead of `%s` on line %d?", keyword, t.Lexeme, t.Line), true
+}
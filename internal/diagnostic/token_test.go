@@ -0,0 +1,47 @@
+package diagnostic
+
+import (
+	"fmt"
+	"github.com/VannRR/golox/internal/token"
+	"testing"
+)
+
+func Test_AtToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		at       token.Token
+		previous token.Token
+		expected string
+	}{
+		{
+			name:     "found",
+			at:       token.Token{Type: token.Semicolon, Lexeme: []byte(";"), Line: 1, Column: 9, Offset: 8, Length: 1},
+			expected: "{error E0001 Expect expression. {1 9 8 1} [found ';'] []}",
+		},
+		{
+			name:     "end of source",
+			at:       token.Token{Type: token.Eof, Line: 2, Column: 1, Offset: 10},
+			expected: "{error E0001 Expect expression. {2 1 10 0} [reached the end of the source] []}",
+		},
+		{
+			name:     "error token",
+			at:       token.Token{Type: token.Error, Lexeme: []byte("Unterminated string."), Line: 1, Column: 1, Length: 3},
+			expected: "{error E0001 Expect expression. {1 1 0 3} [] []}",
+		},
+		{
+			name:     "misspelt keyword before",
+			at:       token.Token{Type: token.Number, Lexeme: []byte("1"), Line: 1, Column: 7, Offset: 6, Length: 1},
+			previous: token.Token{Type: token.Identifier, Lexeme: []byte("pritn"), Line: 1, Column: 1, Length: 5},
+			expected: "{error E0001 Expect expression. {1 7 6 1} [found '1'] [did you mean `print` instead of `pritn` on line 1?]}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := AtToken(CodeSyntax, "Expect expression.", tt.at, tt.previous)
+			if got := fmt.Sprint(d); got != tt.expected {
+				t.Errorf("AtToken() = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
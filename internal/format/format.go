@@ -0,0 +1,359 @@
+// Package format reprints Lox source in one canonical style.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/VannRR/golox/internal/ast"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/parser"
+	"github.com/VannRR/golox/internal/token"
+	"strings"
+)
+
+const indentation = "  "
+
+// Source returns source formatted, or the syntax errors that stop it from
+// being formatted. The layout follows the syntax tree, so a statement is
+// indented one level deeper than the statement it belongs to. Comments are
+// kept, and at most one blank line is kept between statements.
+func Source(source []byte) ([]byte, []diagnostic.Diagnostic) {
+	file, diagnostics := parser.Parse(&source)
+	if len(diagnostics) > 0 {
+		return nil, diagnostics
+	}
+
+	p := printer{source: source, comments: file.Comments, lineStart: true}
+	for _, statement := range file.Statements {
+		p.statement(statement)
+	}
+	p.ownLineComments(len(source))
+	if p.buf.Len() == 0 {
+		p.buf.WriteByte('\n')
+	}
+
+	return p.buf.Bytes(), nil
+}
+
+type printer struct {
+	source []byte
+	// comments are the comments not printed yet, in source order.
+	comments []token.Token
+	buf      bytes.Buffer
+	indent   int
+	// continued is set once a comment ends a line in the middle of a
+	// statement, the rest of the statement is indented one more level.
+	continued bool
+	lineStart bool
+	// inHeader is set until the first statement of a braceless body is
+	// printed, so no blank line separates it from its header.
+	inHeader bool
+	// last is the token or comment printed last.
+	last token.Token
+}
+
+// statement prints s on lines of its own, after the comments before it.
+func (p *printer) statement(s ast.Stmt) {
+	p.ownLineComments(s.Span().Offset)
+	p.blankLine(s.Span().Offset)
+	p.inHeader = false
+
+	switch s := s.(type) {
+	case *ast.ExpressionStmt, *ast.VarStmt:
+		p.simpleStatement(s)
+	case *ast.PrintStmt:
+		p.token(s.Keyword)
+		p.text(" ")
+		p.expression(s.Expression)
+		p.token(s.Semicolon)
+	case *ast.BlockStmt:
+		p.block(s)
+	case *ast.IfStmt:
+		p.ifStatement(s)
+	case *ast.WhileStmt:
+		p.token(s.Keyword)
+		p.text(" (")
+		p.expression(s.Condition)
+		p.token(s.RightParen)
+		p.body(s.Body)
+	case *ast.ForStmt:
+		p.forStatement(s)
+	case *ast.FunStmt:
+		p.token(s.Keyword)
+		p.text(" ")
+		p.token(s.Name)
+		p.text("(")
+		for i, param := range s.Params {
+			if i > 0 {
+				p.text(", ")
+			}
+			p.token(param)
+		}
+		p.text(") ")
+		p.block(s.Body)
+	case *ast.ReturnStmt:
+		p.token(s.Keyword)
+		if s.Value != nil {
+			p.text(" ")
+			p.expression(s.Value)
+		}
+		p.token(s.Semicolon)
+	default:
+		panic(fmt.Sprintf("format, unknown statement %T", s))
+	}
+
+	p.endLine()
+}
+
+// simpleStatement prints the statements that can start a for loop, without
+// ending the line.
+func (p *printer) simpleStatement(s ast.Stmt) {
+	switch s := s.(type) {
+	case *ast.ExpressionStmt:
+		p.expression(s.Expression)
+		p.token(s.Semicolon)
+	case *ast.VarStmt:
+		p.token(s.Keyword)
+		p.text(" ")
+		p.token(s.Name)
+		if s.Initializer != nil {
+			p.text(" = ")
+			p.expression(s.Initializer)
+		}
+		p.token(s.Semicolon)
+	}
+}
+
+// block prints s with its closing brace left open for an 'else' to follow.
+func (p *printer) block(s *ast.BlockStmt) {
+	p.token(s.LeftBrace)
+	if len(s.Statements) == 0 && !p.commentBefore(s.RightBrace.Offset) {
+		p.token(s.RightBrace)
+		return
+	}
+
+	p.indent++
+	p.endLine()
+	for _, statement := range s.Statements {
+		p.statement(statement)
+	}
+	p.ownLineComments(s.RightBrace.Offset)
+	p.indent--
+	p.token(s.RightBrace)
+}
+
+// body prints the body of an if, else or loop, a block on the line of its
+// header and any other statement indented on the lines after it.
+func (p *printer) body(s ast.Stmt) {
+	if block, isBlock := s.(*ast.BlockStmt); isBlock {
+		p.text(" ")
+		p.block(block)
+		return
+	}
+
+	p.endLine()
+	p.indent++
+	p.inHeader = true
+	p.statement(s)
+	p.indent--
+}
+
+// ifStatement lines each 'else' up with its own 'if', and keeps an 'else if'
+// chain at one level.
+func (p *printer) ifStatement(s *ast.IfStmt) {
+	p.token(s.Keyword)
+	p.text(" (")
+	p.expression(s.Condition)
+	p.token(s.RightParen)
+	p.body(s.Then)
+	if s.Else == nil {
+		return
+	}
+
+	if p.lineStart {
+		p.text("else")
+	} else {
+		p.text(" else")
+	}
+	if elseIf, isIf := s.Else.(*ast.IfStmt); isIf {
+		p.text(" ")
+		p.ifStatement(elseIf)
+		return
+	}
+	p.body(s.Else)
+}
+
+func (p *printer) forStatement(s *ast.ForStmt) {
+	p.token(s.Keyword)
+	p.text(" (")
+	if s.Initializer != nil {
+		p.simpleStatement(s.Initializer)
+	} else {
+		p.text(";")
+	}
+	if s.Condition != nil {
+		p.text(" ")
+		p.expression(s.Condition)
+	}
+	p.token(s.ConditionSemicolon)
+	if s.Increment != nil {
+		p.text(" ")
+		p.expression(s.Increment)
+	}
+	p.token(s.RightParen)
+	p.body(s.Body)
+}
+
+func (p *printer) expression(e ast.Expr) {
+	switch e := e.(type) {
+	case *ast.Literal:
+		p.token(e.Token)
+	case *ast.Variable:
+		p.token(e.Name)
+	case *ast.Assign:
+		p.token(e.Name)
+		p.text(" = ")
+		p.expression(e.Value)
+	case *ast.Grouping:
+		p.token(e.LeftParen)
+		p.expression(e.Expression)
+		p.token(e.RightParen)
+	case *ast.Unary:
+		p.token(e.Operator)
+		p.expression(e.Right)
+	case *ast.Binary:
+		p.expression(e.Left)
+		p.text(" ")
+		p.token(e.Operator)
+		p.text(" ")
+		p.expression(e.Right)
+	case *ast.Logical:
+		p.expression(e.Left)
+		p.text(" ")
+		p.token(e.Operator)
+		p.text(" ")
+		p.expression(e.Right)
+	case *ast.Call:
+		p.expression(e.Callee)
+		p.token(e.LeftParen)
+		for i, argument := range e.Arguments {
+			if i > 0 {
+				p.text(", ")
+			}
+			p.expression(argument)
+		}
+		p.token(e.RightParen)
+	default:
+		panic(fmt.Sprintf("format, unknown expression %T", e))
+	}
+}
+
+// token prints t after the comments that come before it.
+func (p *printer) token(t token.Token) {
+	for p.commentBefore(t.Offset) {
+		p.comment(p.nextComment())
+	}
+	p.text(string(t.Lexeme))
+	p.last = t
+}
+
+// text prints s, after a space when it follows a comment on the same line.
+func (p *printer) text(s string) {
+	if p.lineStart {
+		s = strings.TrimLeft(s, " ")
+		p.startLine()
+	} else if p.last.Type == token.Comment && !strings.HasPrefix(s, " ") && !p.endsWith(' ') {
+		p.buf.WriteByte(' ')
+	}
+	p.buf.WriteString(s)
+}
+
+// startLine indents an empty line for the statement being printed.
+func (p *printer) startLine() {
+	depth := p.indent
+	if p.continued {
+		depth++
+	}
+	p.buf.WriteString(strings.Repeat(indentation, depth))
+	p.lineStart = false
+}
+
+// comment prints c after the code on the line, or on a line of its own when
+// the line is empty. A line comment ends the line, and when it comes after
+// code the rest of the statement is continued on the next line.
+func (p *printer) comment(c token.Token) {
+	text := bytes.TrimRight(c.Lexeme, " \t\r")
+	afterCode := !p.lineStart
+	if p.lineStart {
+		p.startLine()
+	} else if !p.endsWith(' ') && !p.endsWith('(') {
+		p.buf.WriteByte(' ')
+	}
+	p.buf.Write(text)
+	p.last = c
+
+	if !bytes.HasPrefix(text, []byte("/*")) {
+		p.continued = p.continued || afterCode
+		p.breakLine()
+	}
+}
+
+// ownLineComments prints the comments before offset each on its own line.
+func (p *printer) ownLineComments(offset int) {
+	for p.commentBefore(offset) {
+		c := p.nextComment()
+		p.blankLine(c.Offset)
+		p.comment(c)
+		p.endLine()
+	}
+}
+
+// endLine ends the line after the comments that directly follow the code
+// before them on the same line of the source.
+func (p *printer) endLine() {
+	for !p.lineStart && len(p.comments) > 0 && len(bytes.Trim(p.gap(p.comments[0].Offset), " \t\r")) == 0 {
+		p.comment(p.nextComment())
+	}
+	if !p.lineStart {
+		p.breakLine()
+	}
+	p.continued = false
+}
+
+func (p *printer) breakLine() {
+	p.buf.WriteByte('\n')
+	p.lineStart = true
+}
+
+// blankLine keeps one empty line before the code or comment at offset when
+// the source had any right before it, except at the start of the file, of a
+// block or of a braceless body.
+func (p *printer) blankLine(offset int) {
+	if p.buf.Len() == 0 || p.inHeader || p.last.Type == token.LeftBrace {
+		return
+	}
+	gap := p.gap(offset)
+	space := gap[len(bytes.TrimRight(gap, " \t\r\n")):]
+	if bytes.Count(space, []byte("\n")) > 1 {
+		p.buf.WriteByte('\n')
+	}
+}
+
+// gap is the source between what was printed last and offset.
+func (p *printer) gap(offset int) []byte {
+	return p.source[p.last.Offset+p.last.Length : offset]
+}
+
+func (p *printer) commentBefore(offset int) bool {
+	return len(p.comments) > 0 && p.comments[0].Offset < offset
+}
+
+func (p *printer) nextComment() token.Token {
+	c := p.comments[0]
+	p.comments = p.comments[1:]
+	return c
+}
+
+func (p *printer) endsWith(b byte) bool {
+	return p.buf.Len() > 0 && p.buf.Bytes()[p.buf.Len()-1] == b
+}
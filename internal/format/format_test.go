@@ -0,0 +1,147 @@
+package format
+
+import (
+	"testing"
+)
+
+func Test_Source(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{
+			name:     "spacing",
+			source:   "var   a=1+2*  3;print a ;",
+			expected: "var a = 1 + 2 * 3;\nprint a;\n",
+		},
+		{
+			name:     "shebang",
+			source:   "#!/usr/bin/env golox\nprint  1;",
+			expected: "#!/usr/bin/env golox\nprint 1;\n",
+		},
+		{
+			name:     "unary",
+			source:   "print - 1;print !true;print 1- -2;print(-a)-(b);",
+			expected: "print -1;\nprint !true;\nprint 1 - -2;\nprint (-a) - (b);\n",
+		},
+		{
+			name:     "blocks",
+			source:   "{\nvar a=1;\n      {print a;}\n}",
+			expected: "{\n  var a = 1;\n  {\n    print a;\n  }\n}\n",
+		},
+		{
+			name:     "empty block",
+			source:   "fun f(){}\nf( );",
+			expected: "fun f() {}\nf();\n",
+		},
+		{
+			name:     "functions and calls",
+			source:   "fun add(a,b)\n{\nreturn a+b;}\nprint add(1,add(2 , 3));",
+			expected: "fun add(a, b) {\n  return a + b;\n}\nprint add(1, add(2, 3));\n",
+		},
+		{
+			name:     "if else",
+			source:   "if(a){print 1;}\nelse\n{print 2;}\nif (b) print 3; else if (c) print 4;",
+			expected: "if (a) {\n  print 1;\n} else {\n  print 2;\n}\nif (b)\n  print 3;\nelse if (c)\n  print 4;\n",
+		},
+		{
+			name:     "else of a nested if",
+			source:   "if (a) if (b) print 1; else print 2;",
+			expected: "if (a)\n  if (b)\n    print 1;\n  else\n    print 2;\n",
+		},
+		{
+			name:     "else of an outer if",
+			source:   "if (a) { if (b) print 1; } else print 2;",
+			expected: "if (a) {\n  if (b)\n    print 1;\n} else\n  print 2;\n",
+		},
+		{
+			name:     "loop bodies",
+			source:   "while (a) a = a - 1; for (;;) while (b) print b;",
+			expected: "while (a)\n  a = a - 1;\nfor (;;)\n  while (b)\n    print b;\n",
+		},
+		{
+			name:     "comments around bodies",
+			source:   "if (a) // why\nprint 1; // then\nelse\n\nprint 2;\nfor (;;) print 3; // loop",
+			expected: "if (a) // why\n  print 1; // then\nelse\n  print 2;\nfor (;;)\n  print 3; // loop\n",
+		},
+		{
+			name:     "loops",
+			source:   "for(var i=0;i<3;i=i+1){print i;}\nfor(;;){}\nwhile(a and !b or c){a=false;}",
+			expected: "for (var i = 0; i < 3; i = i + 1) {\n  print i;\n}\nfor (;;) {}\nwhile (a and !b or c) {\n  a = false;\n}\n",
+		},
+		{
+			name:     "blank lines",
+			source:   "\n\nvar a = 1;\n\n\n\nvar b = 2;\n{\n\nprint a;\n\n}\n\n",
+			expected: "var a = 1;\n\nvar b = 2;\n{\n  print a;\n}\n",
+		},
+		{
+			name:     "trailing comments",
+			source:   "var a = 1;   // one\t\n{ // open\nprint a; /* block */\n}",
+			expected: "var a = 1; // one\n{ // open\n  print a; /* block */\n}\n",
+		},
+		{
+			name:     "own line comments",
+			source:   "// header\n\n   // about a\nvar a = 1;\n{\n// inside\nprint a;\n      /* before end */\n}",
+			expected: "// header\n\n// about a\nvar a = 1;\n{\n  // inside\n  print a;\n  /* before end */\n}\n",
+		},
+		{
+			name:     "comment inside an expression",
+			source:   "print f(1, // first\n2);",
+			expected: "print f(1, // first\n  2);\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatted, diagnostics := Source([]byte(tt.source))
+			if len(diagnostics) > 0 {
+				t.Fatalf("Source() diagnostics = %v", diagnostics)
+			}
+			if string(formatted) != tt.expected {
+				t.Errorf("Source() =\n%q\nexpected\n%q", formatted, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_Source_compileError(t *testing.T) {
+	formatted, diagnostics := Source([]byte("var a = ;"))
+	if formatted != nil || len(diagnostics) != 1 || diagnostics[0].Code != "E0001" {
+		t.Errorf("Source() = %q, %v, expected one E0001 error", formatted, diagnostics)
+	}
+}
+
+// Formatting formatted source must change nothing, whatever shape the input
+// had.
+func Test_Source_idempotent(t *testing.T) {
+	sources := []string{
+		"var foo = (1 / 0.3) + (20 - 2) * 11;\nvar bar = foo % 3;\nbar = bar + 10;\nprint bar;",
+		"fun fib(n){if(n<2)return n;return fib(n-1)+fib(n-2);}print fib(10);",
+		"fun f(a,\n  b) {\n\n\n  return -a\n   - -b;}",
+		"{{{print 1;}}}\n\n\n{}",
+		"// a\n/* b */ var a = 1; /* c */ // d\n/* multi\n   line */\nprint a;",
+		"if (a) print 1;\nelse\n  print 2;\nfun f() { while (true) { if (b) { return; } } }",
+		"if (a) if (b) print 1; else print 2; else { if (c) print 3; }",
+		"while (a) // until done\n  for (;;) if (b) return; else {}",
+		"for (var i = 0; i < 10; i = i + 1) print i; // loop\nfor (;;) {}",
+		"print f(1, // first\n2, /* second */ 3)\n;",
+		"print \"a string\" + \"with // no comment\";",
+		"var _unused = nil; print !(!true == false) != nil;",
+		"fun outer() {\n  fun inner() {} // nested\n  return inner;\n}\nprint outer()();",
+	}
+
+	for _, source := range sources {
+		once, diagnostics := Source([]byte(source))
+		if len(diagnostics) > 0 {
+			t.Fatalf("Source(%q) diagnostics = %v", source, diagnostics)
+		}
+		twice, diagnostics := Source(once)
+		if len(diagnostics) > 0 {
+			t.Fatalf("Source(%q) diagnostics = %v", once, diagnostics)
+		}
+		if string(once) != string(twice) {
+			t.Errorf("Source() is not idempotent for %q\nonce:\n%s\ntwice:\n%s", source, once, twice)
+		}
+	}
+}
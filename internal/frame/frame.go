@@ -0,0 +1,48 @@
+// Package frame reads and writes messages framed by a Content-Length header,
+// the way the Language Server and Debug Adapter protocols send them.
+package frame
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// MaxLength is the longest body Read accepts, a longer one is an error
+// instead of an allocation the size of whatever the header claims.
+const MaxLength = 64 << 20
+
+// Read returns the body of the next message, or io.EOF once the input ends
+// before another one starts.
+func Read(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("frame: invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	if length > MaxLength {
+		return nil, fmt.Errorf("frame: Content-Length %d is over the limit of %d bytes", length, MaxLength)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Write writes body as a message.
+func Write(w io.Writer, body []byte) error {
+	_, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
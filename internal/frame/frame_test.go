@@ -0,0 +1,53 @@
+package frame
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func Test_Read(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+		err   string
+	}{
+		{"two messages", "Content-Length: 2\r\n\r\n{}Content-Length: 3\r\n\r\n[1]", []string{"{}", "[1]"}, ""},
+		{"empty input", "", nil, ""},
+		{"missing length", "Content-Type: x\r\n\r\n{}", nil, `frame: invalid Content-Length ""`},
+		{"negative length", "Content-Length: -1\r\n\r\n", nil, `frame: invalid Content-Length "-1"`},
+		{"huge length", "Content-Length: 4611686018427387904\r\n\r\n{}", nil, "frame: Content-Length 4611686018427387904 is over the limit of 67108864 bytes"},
+		{"short body", "Content-Length: 5\r\n\r\n{}", nil, "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.input))
+			var got []string
+			for {
+				body, err := Read(r)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					if err.Error() != tt.err {
+						t.Errorf("Expected error %q, got %q", tt.err, err)
+					}
+					return
+				}
+				got = append(got, string(body))
+			}
+			if tt.err != "" || strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected %q with error %q, got %q", tt.want, tt.err, got)
+			}
+		})
+	}
+}
+
+func Test_Write(t *testing.T) {
+	var b strings.Builder
+	if err := Write(&b, []byte(`{"a":1}`)); err != nil || b.String() != "Content-Length: 7\r\n\r\n{\"a\":1}" {
+		t.Errorf("Expected a framed message, got %q, %v", b.String(), err)
+	}
+}
@@ -7,10 +7,14 @@ import (
 )
 
 type Lexer struct {
-	source  []byte
-	start   int
-	current int
-	line    uint16
+	source         []byte
+	start          int
+	current        int
+	line           int
+	lineStart      int
+	startLine      int
+	startLineStart int
+	comments       []token.Token
 }
 
 func NewLexer(source *[]byte) *Lexer {
@@ -23,11 +27,12 @@ func NewLexer(source *[]byte) *Lexer {
 }
 
 func (l *Lexer) ScanToken() token.Token {
+	l.markStart()
 	t := l.skipWhitespace()
 	if t.Type == token.Error {
 		return t
 	}
-	l.start = l.current
+	l.markStart()
 
 	if l.isAtEnd() {
 		return l.makeToken(token.Eof)
@@ -84,6 +89,22 @@ func (l *Lexer) ScanToken() token.Token {
 	return l.errorToken(err)
 }
 
+// Comments returns the comments skipped so far, in source order.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+func (l *Lexer) markStart() {
+	l.start = l.current
+	l.startLine = l.line
+	l.startLineStart = l.lineStart
+}
+
+func (l *Lexer) newline() {
+	l.line++
+	l.lineStart = l.current + 1
+}
+
 func (l *Lexer) isAtEnd() bool {
 	return l.current >= len(l.source)
 }
@@ -119,7 +140,10 @@ func (l *Lexer) makeToken(tokenType token.TokenType) token.Token {
 	return token.Token{
 		Type:   tokenType,
 		Lexeme: l.source[l.start:l.current],
-		Line:   l.line,
+		Line:   l.startLine,
+		Column: l.start - l.startLineStart + 1,
+		Offset: l.start,
+		Length: l.current - l.start,
 	}
 }
 
@@ -136,7 +160,10 @@ func (l *Lexer) errorToken(message string) token.Token {
 	return token.Token{
 		Type:   token.Error,
 		Lexeme: []byte(message),
-		Line:   l.line,
+		Line:   l.startLine,
+		Column: l.start - l.startLineStart + 1,
+		Offset: l.start,
+		Length: l.current - l.start,
 	}
 }
 
@@ -146,20 +173,34 @@ func (l *Lexer) skipWhitespace() token.Token {
 		case ' ', '\r', '\t':
 			l.current++
 		case '\n':
-			l.line++
+			l.newline()
 			l.current++
+		case '#':
+			// A #! line at the very start lets scripts be run directly.
+			if l.current != 0 || l.peekNext() != '!' {
+				return token.Token{}
+			}
+			l.markStart()
+			for l.peek() != '\n' && !l.isAtEnd() {
+				l.current++
+			}
+			l.comments = append(l.comments, l.makeToken(token.Comment))
 		case '/':
 			switch nc := l.peekNext(); nc {
 			case '/':
+				l.markStart()
 				for l.peek() != '\n' && !l.isAtEnd() {
 					l.current++
 				}
+				l.comments = append(l.comments, l.makeToken(token.Comment))
 			case '*':
+				l.markStart()
 				l.current += 2
 				t := l.skipBlockComment()
 				if t.Type == token.Error {
 					return t
 				}
+				l.comments = append(l.comments, l.makeToken(token.Comment))
 				return l.skipWhitespace()
 			default:
 				return token.Token{}
@@ -179,6 +220,9 @@ func (l *Lexer) skipBlockComment() token.Token {
 			l.current += 2
 			l.skipBlockComment()
 		} else {
+			if l.peek() == '\n' {
+				l.newline()
+			}
 			l.current++
 		}
 	}
@@ -193,7 +237,7 @@ func (l *Lexer) skipBlockComment() token.Token {
 func (l *Lexer) string() token.Token {
 	for l.peek() != '"' && !l.isAtEnd() {
 		if l.peek() == '\n' {
-			l.line++
+			l.newline()
 		}
 		l.current++
 	}
@@ -280,7 +324,7 @@ func (l *Lexer) identifierType() token.TokenType {
 func (l *Lexer) checkKeyword(start int, rest []byte, t token.TokenType) token.TokenType {
 	s := l.start + start
 	e := len(rest) + s
-	if e < len(l.source) && bytes.Equal(l.source[s:e], rest) {
+	if e == l.current && bytes.Equal(l.source[s:e], rest) {
 		return t
 	}
 	return token.Identifier
@@ -25,6 +25,85 @@ func Test_ScanToken(t *testing.T) {
 	}
 }
 
+func Test_ScanToken_spans(t *testing.T) {
+	source := []byte("var a = \"x\ny\";\n/* one\ntwo */ a\n  @")
+	l := NewLexer(&source)
+
+	expected := []token.Token{
+		{Type: token.Var, Line: 1, Column: 1, Offset: 0, Length: 3},
+		{Type: token.Identifier, Line: 1, Column: 5, Offset: 4, Length: 1},
+		{Type: token.Equal, Line: 1, Column: 7, Offset: 6, Length: 1},
+		{Type: token.String, Line: 1, Column: 9, Offset: 8, Length: 5},
+		{Type: token.Semicolon, Line: 2, Column: 3, Offset: 13, Length: 1},
+		{Type: token.Identifier, Line: 4, Column: 8, Offset: 29, Length: 1},
+		{Type: token.Error, Line: 5, Column: 3, Offset: 33, Length: 1},
+		{Type: token.Eof, Line: 5, Column: 4, Offset: 34, Length: 0},
+	}
+
+	for _, e := range expected {
+		tok := l.ScanToken()
+		if tok.Type != e.Type || tok.Span() != e.Span() {
+			t.Errorf("Expected token type %v at %+v, got type %v at %+v", e.Type, e.Span(), tok.Type, tok.Span())
+		}
+	}
+}
+
+func Test_Comments(t *testing.T) {
+	source := []byte("// first\nvar a; /* second\nline */ a // third")
+	l := NewLexer(&source)
+
+	for l.ScanToken().Type != token.Eof {
+	}
+
+	expected := []token.Token{
+		{Type: token.Comment, Lexeme: []byte("// first"), Line: 1, Column: 1, Offset: 0, Length: 8},
+		{Type: token.Comment, Lexeme: []byte("/* second\nline */"), Line: 2, Column: 8, Offset: 16, Length: 17},
+		{Type: token.Comment, Lexeme: []byte("// third"), Line: 3, Column: 11, Offset: 36, Length: 8},
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("Expected %d comments, got %d", len(expected), len(comments))
+	}
+	for i, e := range expected {
+		c := comments[i]
+		if c.Type != e.Type || !bytes.Equal(c.Lexeme, e.Lexeme) || c.Span() != e.Span() {
+			t.Errorf("Expected comment %q at %+v, got %q at %+v", e.Lexeme, e.Span(), c.Lexeme, c.Span())
+		}
+	}
+}
+
+func Test_ScanToken_shebang(t *testing.T) {
+	tests := []struct {
+		source string
+		types  []token.TokenType
+	}{
+		{"#!/usr/bin/env golox\nprint 1;", []token.TokenType{token.Print, token.Number, token.Semicolon, token.Eof}},
+		{"#!golox", []token.TokenType{token.Eof}},
+		{"print 1;\n#!golox", []token.TokenType{token.Print, token.Number, token.Semicolon, token.Error}},
+		{" #!golox", []token.TokenType{token.Error}},
+	}
+	for _, tt := range tests {
+		source := []byte(tt.source)
+		l := NewLexer(&source)
+		for i, want := range tt.types {
+			if got := l.ScanToken(); got.Type != want {
+				t.Errorf("Expected token %d of %q to be %d, got %d", i, tt.source, want, got.Type)
+				break
+			}
+		}
+	}
+
+	source := []byte("#!/usr/bin/env golox\nprint 1;")
+	l := NewLexer(&source)
+	if line := l.ScanToken().Line; line != 2 {
+		t.Errorf("Expected the shebang to keep line numbers, print is on line %d", line)
+	}
+	if comments := l.Comments(); len(comments) != 1 || string(comments[0].Lexeme) != "#!/usr/bin/env golox" {
+		t.Errorf("Expected the shebang to be kept as a comment, got %v", comments)
+	}
+}
+
 func Test_isAtEnd(t *testing.T) {
 	source := []byte("some source code")
 	l := NewLexer(&source)
@@ -181,6 +260,22 @@ func Test_identifierType(t *testing.T) {
 	}
 }
 
+func Test_identifierType_keywordPrefix(t *testing.T) {
+	source := []byte("forever fun funny orchid and")
+	l := NewLexer(&source)
+
+	expectedTypes := []token.TokenType{
+		token.Identifier, token.Fun, token.Identifier, token.Identifier, token.And,
+	}
+
+	for _, expected := range expectedTypes {
+		tok := l.ScanToken()
+		if tok.Type != expected {
+			t.Errorf("Expected %q to be token type %v, but got %v", tok.Lexeme, expected, tok.Type)
+		}
+	}
+}
+
 func Test_checkKeyword(t *testing.T) {
 	source := []byte("var class true;")
 	l := NewLexer(&source)
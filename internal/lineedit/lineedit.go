@@ -0,0 +1,297 @@
+// Package lineedit reads lines of input with cursor movement and history
+// when the input is a terminal, and plain lines when it isn't.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C.
+var ErrInterrupted = errors.New("lineedit: interrupted")
+
+// maxHistory is how many lines the history keeps, the oldest go first.
+const maxHistory = 1000
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+type Editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	fd      int
+	history []string
+}
+
+// NewEditor reads from in, which is only edited in place when it is a
+// terminal, and echoes to out.
+func NewEditor(in io.Reader, out io.Writer) *Editor {
+	e := &Editor{in: bufio.NewReader(in), out: out, fd: -1}
+	if f, ok := in.(*os.File); ok && isTerminal(int(f.Fd())) {
+		e.fd = int(f.Fd())
+	}
+	return e
+}
+
+// ReadLine prints prompt and returns the next line without its line ending.
+// It returns io.EOF at the end of the input or on Ctrl-D at an empty line.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.fd < 0 {
+		return e.readPlain(prompt)
+	}
+	state, err := makeRaw(e.fd)
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+	defer restore(e.fd, state)
+	return e.edit(prompt)
+}
+
+func (e *Editor) readPlain(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+	line, err := e.in.ReadString('\n')
+	if err == io.EOF && line == "" {
+		fmt.Fprintln(e.out)
+		return "", io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// AddHistory appends a line to the history, skipping blank lines and
+// repeats of the previous line.
+func (e *Editor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// History returns the lines in the history, oldest first.
+func (e *Editor) History() []string {
+	return e.history
+}
+
+// ReadHistory adds the lines of r to the history.
+func (e *Editor) ReadHistory(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		e.AddHistory(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// WriteHistory writes the history to w, one line each.
+func (e *Editor) WriteHistory(w io.Writer) error {
+	for _, line := range e.history {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// line is the state of the line being edited.
+type line struct {
+	prompt  string
+	buffer  []rune
+	cursor  int
+	history int
+	edited  []rune
+}
+
+// edit reads keys until enter, redrawing the line after each one. The
+// terminal must already be in raw mode.
+func (e *Editor) edit(prompt string) (string, error) {
+	l := &line{prompt: prompt, history: len(e.history)}
+	e.refresh(l)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			fmt.Fprint(e.out, "\r\n")
+			if err == io.EOF && len(l.buffer) > 0 {
+				return string(l.buffer), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(l.buffer), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(l.buffer) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			l.deleteForward()
+		case keyDelete, keyBackspace:
+			l.deleteBackward()
+		case keyCtrlA:
+			l.cursor = 0
+		case keyCtrlE:
+			l.cursor = len(l.buffer)
+		case keyCtrlB:
+			l.cursor = max(l.cursor-1, 0)
+		case keyCtrlF:
+			l.cursor = min(l.cursor+1, len(l.buffer))
+		case keyCtrlK:
+			l.buffer = l.buffer[:l.cursor]
+		case keyCtrlU:
+			l.buffer = l.buffer[l.cursor:]
+			l.cursor = 0
+		case keyCtrlW:
+			l.deleteWord()
+		case keyCtrlP:
+			e.previousHistory(l)
+		case keyCtrlN:
+			e.nextHistory(l)
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyEscape:
+			e.escape(l)
+		default:
+			if r >= ' ' {
+				l.insert(r)
+			}
+		}
+		e.refresh(l)
+	}
+}
+
+// escape handles the arrow, home, end and delete keys, which terminals send
+// as escape sequences.
+func (e *Editor) escape(l *line) {
+	if b, err := e.in.ReadByte(); err != nil || (b != '[' && b != 'O') {
+		return
+	}
+	b, err := e.in.ReadByte()
+	if err != nil {
+		return
+	}
+
+	if b >= '0' && b <= '9' {
+		if tilde, err := e.in.ReadByte(); err != nil || tilde != '~' {
+			return
+		}
+		switch b {
+		case '1', '7':
+			l.cursor = 0
+		case '4', '8':
+			l.cursor = len(l.buffer)
+		case '3':
+			l.deleteForward()
+		}
+		return
+	}
+
+	switch b {
+	case 'A':
+		e.previousHistory(l)
+	case 'B':
+		e.nextHistory(l)
+	case 'C':
+		l.cursor = min(l.cursor+1, len(l.buffer))
+	case 'D':
+		l.cursor = max(l.cursor-1, 0)
+	case 'H':
+		l.cursor = 0
+	case 'F':
+		l.cursor = len(l.buffer)
+	}
+}
+
+func (e *Editor) previousHistory(l *line) {
+	if l.history == 0 {
+		return
+	}
+	if l.history == len(e.history) {
+		l.edited = l.buffer
+	}
+	l.history--
+	l.buffer = []rune(e.history[l.history])
+	l.cursor = len(l.buffer)
+}
+
+func (e *Editor) nextHistory(l *line) {
+	if l.history == len(e.history) {
+		return
+	}
+	l.history++
+	if l.history == len(e.history) {
+		l.buffer = l.edited
+	} else {
+		l.buffer = []rune(e.history[l.history])
+	}
+	l.cursor = len(l.buffer)
+}
+
+// refresh redraws the prompt and line and puts the cursor back in place.
+func (e *Editor) refresh(l *line) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", l.prompt, string(l.buffer))
+	if back := len(l.buffer) - l.cursor; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+func (l *line) insert(r rune) {
+	l.buffer = append(l.buffer[:l.cursor], append([]rune{r}, l.buffer[l.cursor:]...)...)
+	l.cursor++
+}
+
+func (l *line) deleteBackward() {
+	if l.cursor == 0 {
+		return
+	}
+	l.buffer = append(l.buffer[:l.cursor-1], l.buffer[l.cursor:]...)
+	l.cursor--
+}
+
+func (l *line) deleteForward() {
+	if l.cursor == len(l.buffer) {
+		return
+	}
+	l.buffer = append(l.buffer[:l.cursor], l.buffer[l.cursor+1:]...)
+}
+
+// deleteWord deletes the word before the cursor and the spaces after it.
+func (l *line) deleteWord() {
+	start := l.cursor
+	for start > 0 && l.buffer[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && l.buffer[start-1] != ' ' {
+		start--
+	}
+	l.buffer = append(l.buffer[:start], l.buffer[l.cursor:]...)
+	l.cursor = start
+}
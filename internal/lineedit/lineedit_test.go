@@ -0,0 +1,93 @@
+package lineedit
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func Test_Editor_edit(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{"plain", nil, "print 1;\r", "print 1;", nil},
+		{"backspace", nil, "ab\x7fc\r", "ac", nil},
+		{"left and insert", nil, "ac\x1b[Db\r", "abc", nil},
+		{"home and end", nil, "bc\x1b[Ha\x1b[Fd\r", "abcd", nil},
+		{"ctrl a and e", nil, "bc\x01a\x05d\r", "abcd", nil},
+		{"delete key", nil, "abc\x01\x1b[3~\r", "bc", nil},
+		{"kill to end", nil, "abc\x02\x02\x0b\r", "a", nil},
+		{"kill to start", nil, "abc\x02\x15\r", "c", nil},
+		{"delete word", nil, "var a = 1\x17\x17\r", "var a ", nil},
+		{"history up", []string{"one", "two"}, "\x1b[A\x1b[A\r", "one", nil},
+		{"history down restores the line", []string{"one"}, "x\x1b[A\x1b[B\r", "x", nil},
+		{"ctrl p and n", []string{"one", "two"}, "\x10\x10\x0e\r", "two", nil},
+		{"ctrl d deletes", nil, "ab\x01\x04\r", "b", nil},
+		{"ctrl d at an empty line", nil, "\x04", "", io.EOF},
+		{"ctrl c", nil, "abc\x03", "", ErrInterrupted},
+		{"end of input", nil, "abc", "abc", nil},
+		{"unicode", nil, "héllo\x7f\x7f\r", "hél", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor(strings.NewReader(tt.input), io.Discard)
+			for _, line := range tt.history {
+				e.AddHistory(line)
+			}
+			got, err := e.edit("> ")
+			if err != tt.wantErr {
+				t.Fatalf("edit() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("edit() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Editor_ReadLine(t *testing.T) {
+	var out bytes.Buffer
+	e := NewEditor(strings.NewReader("one\r\ntwo\nthree"), &out)
+
+	for _, want := range []string{"one", "two", "three"} {
+		got, err := e.ReadLine("> ")
+		if err != nil || got != want {
+			t.Fatalf("ReadLine() = %q, %v, want %q", got, err, want)
+		}
+	}
+	if _, err := e.ReadLine("> "); err != io.EOF {
+		t.Errorf("ReadLine() at the end error = %v, want io.EOF", err)
+	}
+	if out.String() != "> > > > \n" {
+		t.Errorf("ReadLine() printed %q", out.String())
+	}
+}
+
+func Test_Editor_history(t *testing.T) {
+	e := NewEditor(strings.NewReader(""), io.Discard)
+	if err := e.ReadHistory(strings.NewReader("one\n\ntwo\ntwo\n  \nthree\n")); err != nil {
+		t.Fatal(err)
+	}
+	e.AddHistory("three")
+	e.AddHistory("four")
+
+	var b bytes.Buffer
+	if err := e.WriteHistory(&b); err != nil {
+		t.Fatal(err)
+	}
+	if want := "one\ntwo\nthree\nfour\n"; b.String() != want {
+		t.Errorf("WriteHistory() = %q, want %q", b.String(), want)
+	}
+
+	for i := range maxHistory + 10 {
+		e.AddHistory(strings.Repeat("x", i+1))
+	}
+	if len(e.History()) != maxHistory || e.History()[0] != strings.Repeat("x", 11) {
+		t.Errorf("History() kept %d lines starting with %q", len(e.History()), e.History()[0])
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package lineedit
+
+import "errors"
+
+// Raw mode isn't supported here, so lines are read without editing.
+
+type termState struct{}
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (*termState, error) {
+	return nil, errors.New("lineedit: raw mode is not supported")
+}
+
+func restore(fd int, state *termState) {}
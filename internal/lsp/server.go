@@ -0,0 +1,378 @@
+// Package lsp implements a Language Server Protocol server for Lox over a
+// pair of streams, normally the editor's pipes to stdin and stdout.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/VannRR/golox/internal/compiler"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/frame"
+	"github.com/VannRR/golox/internal/token"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// ErrExitWithoutShutdown is returned by Run when the client sends exit
+// without asking the server to shut down first.
+var ErrExitWithoutShutdown = errors.New("lsp: exit before shutdown")
+
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+type document struct {
+	text       []byte
+	lineStarts []int
+	analysis   *compiler.Analysis
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]*document),
+	}
+}
+
+// Run handles messages until the client sends exit or closes the input.
+func (s *Server) Run() error {
+	for {
+		body, err := frame.Read(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var m message
+		if err := json.Unmarshal(body, &m); err != nil {
+			s.replyError(nil, codeParseError, err.Error())
+			continue
+		}
+
+		if m.Method == "exit" {
+			if !s.shutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		}
+		s.handle(m)
+	}
+}
+
+func (s *Server) write(v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	frame.Write(s.out, body)
+}
+
+func (s *Server) reply(id *json.RawMessage, result any) {
+	s.write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, message string) {
+	s.write(errorResponse{JSONRPC: "2.0", ID: id, Error: responseError{Code: code, Message: message}})
+}
+
+func (s *Server) notify(method string, params any) {
+	s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) handle(m message) {
+	isRequest := m.ID != nil
+	if isRequest && s.shutdown {
+		s.replyError(m.ID, codeInvalidRequest, "server is shutting down")
+		return
+	}
+
+	var result any
+	var err error
+
+	switch m.Method {
+	case "initialize":
+		result = s.initialize()
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err = json.Unmarshal(m.Params, &params); err == nil {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err = json.Unmarshal(m.Params, &params); err == nil && len(params.ContentChanges) > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err = json.Unmarshal(m.Params, &params); err == nil {
+			delete(s.documents, params.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+				URI: params.TextDocument.URI, Diagnostics: []Diagnostic{},
+			})
+		}
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err = json.Unmarshal(m.Params, &params); err == nil {
+			result = s.definition(params)
+		}
+	case "textDocument/references":
+		var params referenceParams
+		if err = json.Unmarshal(m.Params, &params); err == nil {
+			result = s.references(params)
+		}
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err = json.Unmarshal(m.Params, &params); err == nil {
+			result = s.hover(params)
+		}
+	case "textDocument/documentSymbol":
+		var params documentSymbolParams
+		if err = json.Unmarshal(m.Params, &params); err == nil {
+			result = s.documentSymbols(params)
+		}
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err = json.Unmarshal(m.Params, &params); err == nil {
+			result = s.completion(params)
+		}
+	default:
+		if isRequest {
+			s.replyError(m.ID, codeMethodNotFound, "method not found: "+m.Method)
+		}
+		return
+	}
+
+	if !isRequest {
+		return
+	}
+	if err != nil {
+		s.replyError(m.ID, codeInvalidParams, err.Error())
+		return
+	}
+	s.reply(m.ID, result)
+}
+
+func (s *Server) initialize() initializeResult {
+	var result initializeResult
+	result.ServerInfo.Name = "golox"
+	result.Capabilities = serverCapabilities{
+		TextDocumentSync:       textDocumentSyncFull,
+		DefinitionProvider:     true,
+		ReferencesProvider:     true,
+		HoverProvider:          true,
+		DocumentSymbolProvider: true,
+		CompletionProvider:     map[string]any{},
+	}
+	return result
+}
+
+// update reanalyzes a document after it is opened or changed and publishes
+// its diagnostics.
+func (s *Server) update(uri string, text string) {
+	doc := newDocument([]byte(text))
+	s.documents[uri] = doc
+
+	diagnostics := make([]Diagnostic, 0, len(doc.analysis.Diagnostics))
+	for _, d := range doc.analysis.Diagnostics {
+		severity := severityError
+		if d.Severity == diagnostic.Warning {
+			severity = severityWarning
+		}
+
+		message := d.Message
+		for _, hint := range d.Hints {
+			message += "\nhelp: " + hint
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    doc.spanRange(d.Span),
+			Severity: severity,
+			Code:     d.Code,
+			Source:   "golox",
+			Message:  message,
+		})
+	}
+
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+// symbolAt finds the document and the symbol declared or used at a position.
+func (s *Server) symbolAt(params textDocumentPositionParams) (*document, int, bool) {
+	doc, exists := s.documents[params.TextDocument.URI]
+	if !exists {
+		return nil, -1, false
+	}
+	symbol, ok := doc.analysis.Symbols.At(doc.offset(params.Position))
+	return doc, symbol, ok
+}
+
+func (s *Server) definition(params textDocumentPositionParams) *Location {
+	doc, symbol, ok := s.symbolAt(params)
+	if !ok {
+		return nil
+	}
+	return &Location{URI: params.TextDocument.URI, Range: doc.spanRange(doc.analysis.Symbols.Symbols[symbol].Span)}
+}
+
+func (s *Server) references(params referenceParams) []Location {
+	locations := make([]Location, 0)
+	doc, symbol, ok := s.symbolAt(params.textDocumentPositionParams)
+	if !ok {
+		return locations
+	}
+
+	uri := params.TextDocument.URI
+	if params.Context.IncludeDeclaration {
+		locations = append(locations, Location{URI: uri, Range: doc.spanRange(doc.analysis.Symbols.Symbols[symbol].Span)})
+	}
+	for _, reference := range doc.analysis.Symbols.ReferencesTo(symbol) {
+		locations = append(locations, Location{URI: uri, Range: doc.spanRange(reference.Span)})
+	}
+	return locations
+}
+
+func (s *Server) hover(params textDocumentPositionParams) *hover {
+	doc, index, ok := s.symbolAt(params)
+	if !ok {
+		return nil
+	}
+
+	symbol := doc.analysis.Symbols.Symbols[index]
+	value := fmt.Sprintf("```lox\n%s\n```\nDeclared on line %d", symbol.Detail, symbol.Span.Line)
+	if symbol.Container != "" {
+		value += fmt.Sprintf(" in `%s`", symbol.Container)
+	}
+	value += "."
+
+	offset := doc.offset(params.Position)
+	span := symbol.Span
+	for _, reference := range doc.analysis.Symbols.ReferencesTo(index) {
+		if offset >= reference.Span.Offset && offset <= reference.Span.Offset+reference.Span.Length {
+			span = reference.Span
+		}
+	}
+
+	return &hover{Contents: markupContent{Kind: "markdown", Value: value}, Range: doc.spanRange(span)}
+}
+
+func (s *Server) documentSymbols(params documentSymbolParams) []symbolInformation {
+	symbols := make([]symbolInformation, 0)
+	doc, exists := s.documents[params.TextDocument.URI]
+	if !exists {
+		return symbols
+	}
+
+	for _, symbol := range doc.analysis.Symbols.Symbols {
+		if symbol.Kind == compiler.SymbolParameter {
+			continue
+		}
+		kind := symbolKindVariable
+		if symbol.Kind == compiler.SymbolFunction {
+			kind = symbolKindFunction
+		}
+		symbols = append(symbols, symbolInformation{
+			Name:          symbol.Name,
+			Kind:          kind,
+			Location:      Location{URI: params.TextDocument.URI, Range: doc.spanRange(symbol.Span)},
+			ContainerName: symbol.Container,
+		})
+	}
+	return symbols
+}
+
+var keywords = func() []string {
+	names := make([]string, 0, len(token.Keywords))
+	for name := range token.Keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}()
+
+// completion offers the names visible at the cursor followed by keywords.
+func (s *Server) completion(params textDocumentPositionParams) []completionItem {
+	items := make([]completionItem, 0)
+
+	if doc, exists := s.documents[params.TextDocument.URI]; exists {
+		offset := doc.offset(params.Position)
+		for _, symbol := range doc.analysis.Symbols.Visible(offset) {
+			if symbol.Span.Offset <= offset && offset <= symbol.Span.Offset+symbol.Span.Length {
+				continue
+			}
+			kind := completionKindVariable
+			if symbol.Kind == compiler.SymbolFunction {
+				kind = completionKindFunction
+			}
+			items = append(items, completionItem{Label: symbol.Name, Kind: kind, Detail: symbol.Detail})
+		}
+	}
+
+	for _, keyword := range keywords {
+		items = append(items, completionItem{Label: keyword, Kind: completionKindKeyword})
+	}
+	return items
+}
+
+func newDocument(text []byte) *document {
+	lineStarts := []int{0}
+	for i, c := range text {
+		if c == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	return &document{text: text, lineStarts: lineStarts, analysis: compiler.Analyze(&text)}
+}
+
+// position converts a byte offset to a zero based line and a character
+// counted in UTF-16 code units, as the protocol requires.
+func (d *document) position(offset int) Position {
+	offset = min(max(offset, 0), len(d.text))
+	line := sort.Search(len(d.lineStarts), func(i int) bool { return d.lineStarts[i] > offset }) - 1
+
+	character := 0
+	for _, r := range string(d.text[d.lineStarts[line]:offset]) {
+		character += utf16Length(r)
+	}
+	return Position{Line: line, Character: character}
+}
+
+// offset converts a protocol position back to a byte offset, clamping it to
+// the end of its line.
+func (d *document) offset(p Position) int {
+	if p.Line < 0 {
+		return 0
+	}
+	if p.Line >= len(d.lineStarts) {
+		return len(d.text)
+	}
+
+	offset := d.lineStarts[p.Line]
+	for character := 0; character < p.Character && offset < len(d.text) && d.text[offset] != '\n'; {
+		r, size := utf8.DecodeRune(d.text[offset:])
+		character += utf16Length(r)
+		offset += size
+	}
+	return offset
+}
+
+func (d *document) spanRange(span token.Span) Range {
+	return Range{Start: d.position(span.Offset), End: d.position(span.Offset + span.Length)}
+}
+
+func utf16Length(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
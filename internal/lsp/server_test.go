@@ -0,0 +1,258 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testURI = "file:///test.lox"
+
+// script frames each message the way an editor would.
+func script(messages ...string) io.Reader {
+	var b bytes.Buffer
+	for _, m := range messages {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	return &b
+}
+
+func request(id int, method string, params string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q,"params":%s}`, id, method, params)
+}
+
+func notify(method string, params string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","method":%q,"params":%s}`, method, params)
+}
+
+func position(method string, id int, line int, character int) string {
+	return request(id, method, fmt.Sprintf(`{"textDocument":{"uri":%q},"position":{"line":%d,"character":%d}}`,
+		testURI, line, character))
+}
+
+type received struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// run feeds the messages to a server and returns everything it wrote.
+func run(t *testing.T, messages ...string) ([]received, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := NewServer(script(messages...), &out).Run()
+
+	reader := bufio.NewReader(&out)
+	all := make([]received, 0)
+	for {
+		header, headerErr := textproto.NewReader(reader).ReadMIMEHeader()
+		if headerErr != nil {
+			break
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		if _, readErr := io.ReadFull(reader, body); readErr != nil {
+			t.Fatalf("short message body: %v", readErr)
+		}
+		var r received
+		if jsonErr := json.Unmarshal(body, &r); jsonErr != nil {
+			t.Fatalf("invalid message %s: %v", body, jsonErr)
+		}
+		all = append(all, r)
+	}
+	return all, err
+}
+
+func result(t *testing.T, messages []received, id int, v any) {
+	t.Helper()
+	for _, m := range messages {
+		if m.ID != nil && *m.ID == id {
+			if m.Error != nil {
+				t.Fatalf("request %d failed: %d %s", id, m.Error.Code, m.Error.Message)
+			}
+			if err := json.Unmarshal(m.Result, v); err != nil {
+				t.Fatalf("request %d result %s: %v", id, m.Result, err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no response to request %d", id)
+}
+
+func publishedDiagnostics(messages []received) []publishDiagnosticsParams {
+	published := make([]publishDiagnosticsParams, 0)
+	for _, m := range messages {
+		if m.Method == "textDocument/publishDiagnostics" {
+			var params publishDiagnosticsParams
+			json.Unmarshal(m.Params, &params)
+			published = append(published, params)
+		}
+	}
+	return published
+}
+
+func Test_Server_session(t *testing.T) {
+	source := "var greeting = \"hi\";\nfun shout(word) {\n  return word + \"!\";\n}\nprint shout(greeting);\n"
+	changed := "var greeting = \"hi\";\nprint greting;\n"
+
+	messages, err := run(t,
+		request(1, "initialize", `{"capabilities":{}}`),
+		notify("initialized", `{}`),
+		notify("textDocument/didOpen", fmt.Sprintf(`{"textDocument":{"uri":%q,"languageId":"lox","version":1,"text":%q}}`, testURI, source)),
+		position("textDocument/definition", 2, 4, 14),
+		request(3, "textDocument/references", fmt.Sprintf(
+			`{"textDocument":{"uri":%q},"position":{"line":0,"character":6},"context":{"includeDeclaration":true}}`, testURI)),
+		position("textDocument/hover", 4, 4, 8),
+		request(5, "textDocument/documentSymbol", fmt.Sprintf(`{"textDocument":{"uri":%q}}`, testURI)),
+		position("textDocument/completion", 6, 2, 2),
+		notify("textDocument/didChange", fmt.Sprintf(`{"textDocument":{"uri":%q,"version":2},"contentChanges":[{"text":%q}]}`, testURI, changed)),
+		request(7, "textDocument/formatting", `{}`),
+		request(8, "shutdown", `null`),
+		notify("exit", `null`),
+	)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var initialized initializeResult
+	result(t, messages, 1, &initialized)
+	if initialized.ServerInfo.Name != "golox" || !initialized.Capabilities.HoverProvider ||
+		initialized.Capabilities.TextDocumentSync != textDocumentSyncFull {
+		t.Errorf("initialize = %+v", initialized)
+	}
+
+	var definition Location
+	result(t, messages, 2, &definition)
+	expectedRange := Range{Start: Position{Line: 0, Character: 4}, End: Position{Line: 0, Character: 12}}
+	if definition.URI != testURI || definition.Range != expectedRange {
+		t.Errorf("definition = %+v, expected %+v", definition, expectedRange)
+	}
+
+	var references []Location
+	result(t, messages, 3, &references)
+	lines := make([]string, 0)
+	for _, r := range references {
+		lines = append(lines, fmt.Sprintf("%d:%d-%d", r.Range.Start.Line, r.Range.Start.Character, r.Range.End.Character))
+	}
+	if strings.Join(lines, " ") != "0:4-12 4:12-20" {
+		t.Errorf("references = %v, expected [0:4-12 4:12-20]", lines)
+	}
+
+	var hovered hover
+	result(t, messages, 4, &hovered)
+	if !strings.Contains(hovered.Contents.Value, "fun shout(word)") || hovered.Range.Start != (Position{Line: 4, Character: 6}) {
+		t.Errorf("hover = %+v", hovered)
+	}
+
+	var symbols []symbolInformation
+	result(t, messages, 5, &symbols)
+	names := make([]string, 0)
+	for _, s := range symbols {
+		names = append(names, fmt.Sprintf("%s/%d", s.Name, s.Kind))
+	}
+	if strings.Join(names, " ") != "greeting/13 shout/12" {
+		t.Errorf("documentSymbol = %v, expected [greeting/13 shout/12]", names)
+	}
+
+	var completions []completionItem
+	result(t, messages, 6, &completions)
+	labels := make([]string, 0)
+	for _, c := range completions[:3] {
+		labels = append(labels, c.Label)
+	}
+	if strings.Join(labels, " ") != "word shout greeting" || completions[3].Kind != completionKindKeyword {
+		t.Errorf("completion starts with %v, expected [word shout greeting] then keywords", labels)
+	}
+
+	for _, m := range messages {
+		if m.ID != nil && *m.ID == 7 && (m.Error == nil || m.Error.Code != codeMethodNotFound) {
+			t.Errorf("unknown request got %+v, expected method not found", m)
+		}
+	}
+
+	published := publishedDiagnostics(messages)
+	if len(published) != 2 {
+		t.Fatalf("published diagnostics %d times, expected 2", len(published))
+	}
+	if len(published[0].Diagnostics) != 0 {
+		t.Errorf("diagnostics after open = %+v, expected none", published[0].Diagnostics)
+	}
+	codes := make([]string, 0)
+	for _, d := range published[1].Diagnostics {
+		codes = append(codes, fmt.Sprintf("%s %d %d:%d", d.Code, d.Severity, d.Range.Start.Line, d.Range.Start.Character))
+	}
+	if strings.Join(codes, ", ") != "W0002 2 0:4" {
+		t.Errorf("diagnostics after change = %v, expected [W0002 2 0:4]", codes)
+	}
+}
+
+func Test_Server_compileError(t *testing.T) {
+	messages, err := run(t,
+		notify("textDocument/didOpen", fmt.Sprintf(`{"textDocument":{"uri":%q,"text":%q}}`, testURI, "print 1 +;")),
+		notify("textDocument/didClose", fmt.Sprintf(`{"textDocument":{"uri":%q}}`, testURI)),
+	)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	published := publishedDiagnostics(messages)
+	if len(published) != 2 {
+		t.Fatalf("published diagnostics %d times, expected 2", len(published))
+	}
+	d := published[0].Diagnostics
+	if len(d) != 1 || d[0].Code != "E0001" || d[0].Severity != severityError || d[0].Source != "golox" {
+		t.Errorf("diagnostics = %+v, expected one E0001 error", d)
+	}
+	if len(published[1].Diagnostics) != 0 {
+		t.Errorf("diagnostics after close = %+v, expected none", published[1].Diagnostics)
+	}
+}
+
+func Test_Server_exitWithoutShutdown(t *testing.T) {
+	if _, err := run(t, notify("exit", `null`)); err != ErrExitWithoutShutdown {
+		t.Errorf("Run() error = %v, expected %v", err, ErrExitWithoutShutdown)
+	}
+}
+
+func Test_Server_parseError(t *testing.T) {
+	messages, _ := run(t, "{not json")
+	if len(messages) != 1 || messages[0].Error == nil || messages[0].Error.Code != codeParseError {
+		t.Errorf("messages = %+v, expected a parse error", messages)
+	}
+}
+
+func Test_document_position(t *testing.T) {
+	doc := newDocument([]byte("a\n😀 b\n"))
+
+	tests := []struct {
+		offset   int
+		expected Position
+	}{
+		{offset: 0, expected: Position{Line: 0, Character: 0}},
+		{offset: 2, expected: Position{Line: 1, Character: 0}},
+		{offset: 6, expected: Position{Line: 1, Character: 2}},
+		{offset: 7, expected: Position{Line: 1, Character: 3}},
+		{offset: 100, expected: Position{Line: 2, Character: 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.offset), func(t *testing.T) {
+			if got := doc.position(tt.offset); got != tt.expected {
+				t.Errorf("position(%d) = %+v, expected %+v", tt.offset, got, tt.expected)
+			}
+			if tt.offset <= len(doc.text) {
+				if got := doc.offset(tt.expected); got != tt.offset {
+					t.Errorf("offset(%+v) = %d, expected %d", tt.expected, got, tt.offset)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package object
+
+import (
+	"github.com/VannRR/golox/internal/value"
+	"strings"
+)
+
+// ObjArray is an ordered list of values, arrays are compared by identity.
+type ObjArray struct {
+	Elements []value.Value
+}
+
+func NewArray(elements []value.Value) *ObjArray {
+	return &ObjArray{Elements: elements}
+}
+
+func (a *ObjArray) String() string {
+	var b strings.Builder
+	a.write(&b)
+	return boundedString(&b)
+}
+
+func (a *ObjArray) write(b *strings.Builder) {
+	b.WriteByte('[')
+	for i, e := range a.Elements {
+		if b.Len() > maxStringLength {
+			return
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		writeElement(b, e)
+	}
+	b.WriteByte(']')
+}
+
+// maxStringLength bounds the text of an array or a map. Arrays and maps can
+// hold the same one many times over, so printed they can be far bigger than
+// they are in memory.
+const maxStringLength = 1 << 24
+
+// writeElement writes v, nested arrays and maps write into b directly so
+// they stop once it is too long.
+func writeElement(b *strings.Builder, v value.Value) {
+	switch v := v.(type) {
+	case *ObjArray:
+		v.write(b)
+	case *ObjMap:
+		v.write(b)
+	default:
+		b.WriteString(v.String())
+	}
+}
+
+// boundedString returns what was written to b, cut to maxStringLength and
+// marked with "..." when it is longer.
+func boundedString(b *strings.Builder) string {
+	if b.Len() <= maxStringLength {
+		return b.String()
+	}
+	return strings.ToValidUTF8(b.String()[:maxStringLength], "") + "..."
+}
+
+func (a *ObjArray) IsEqual(other value.Value) bool {
+	o, ok := other.(*ObjArray)
+	return ok && o == a
+}
+
+func (a *ObjArray) IsFalsey() bool { return false }
+
+func (a *ObjArray) IsType(other value.Value) bool {
+	_, ok := other.(*ObjArray)
+	return ok
+}
+func (a *ObjArray) IsBool() bool     { return false }
+func (a *ObjArray) IsNil() bool      { return false }
+func (a *ObjArray) IsNumber() bool   { return false }
+func (a *ObjArray) IsString() bool   { return false }
+func (a *ObjArray) IsFunction() bool { return false }
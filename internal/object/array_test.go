@@ -0,0 +1,36 @@
+package object
+
+import (
+	"github.com/VannRR/golox/internal/value"
+	"strings"
+	"testing"
+)
+
+func Test_ObjArray(t *testing.T) {
+	a := NewArray([]value.Value{value.NumberVal(1), ObjString("two"), NewArray(nil), value.NilVal{}})
+	other := NewArray([]value.Value{value.NumberVal(1)})
+
+	if want := "[1, two, [], nil]"; a.String() != want {
+		t.Errorf("Expected String to return %q, but got %q", want, a.String())
+	}
+	if !a.IsEqual(a) || a.IsEqual(other) {
+		t.Errorf("Expected arrays to only be equal to themselves")
+	}
+	if !a.IsType(other) || a.IsType(ObjString("")) {
+		t.Errorf("Expected arrays to only have the type of other arrays")
+	}
+	if a.IsFalsey() || a.IsString() || a.IsFunction() || a.IsNil() {
+		t.Errorf("Expected an array to be a truthy value of its own type")
+	}
+}
+
+func Test_ObjArray_String_shared(t *testing.T) {
+	a := NewArray([]value.Value{ObjString("abc")})
+	for range 40 {
+		a = NewArray([]value.Value{a, a})
+	}
+	s := a.String()
+	if len(s) > maxStringLength+len("...") || !strings.HasSuffix(s, "...") {
+		t.Errorf("Expected an array holding 2^40 strings to print cut short, got %d bytes", len(s))
+	}
+}
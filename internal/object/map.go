@@ -0,0 +1,91 @@
+package object
+
+import (
+	"github.com/VannRR/golox/internal/value"
+	"slices"
+	"strings"
+)
+
+// ObjMap maps string keys to values, keeping the keys in the order they were
+// first set. Maps are compared by identity.
+type ObjMap struct {
+	keys   []string
+	values map[string]value.Value
+}
+
+func NewMap() *ObjMap {
+	return &ObjMap{values: make(map[string]value.Value)}
+}
+
+// Get returns the value of key and whether it is set.
+func (m *ObjMap) Get(key string) (value.Value, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+// Set sets key to v, a key that is already set keeps its place.
+func (m *ObjMap) Set(key string, v value.Value) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = v
+}
+
+// Delete removes key and returns whether it was set, the keys after it keep
+// their order.
+func (m *ObjMap) Delete(key string) bool {
+	if _, ok := m.values[key]; !ok {
+		return false
+	}
+	delete(m.values, key)
+	m.keys = slices.DeleteFunc(m.keys, func(k string) bool { return k == key })
+	return true
+}
+
+// Keys returns the keys in the order they were first set.
+func (m *ObjMap) Keys() []string {
+	return m.keys
+}
+
+func (m *ObjMap) Len() int {
+	return len(m.keys)
+}
+
+func (m *ObjMap) String() string {
+	var b strings.Builder
+	m.write(&b)
+	return boundedString(&b)
+}
+
+func (m *ObjMap) write(b *strings.Builder) {
+	b.WriteByte('{')
+	for i, k := range m.keys {
+		if b.Len() > maxStringLength {
+			return
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k)
+		b.WriteString(": ")
+		writeElement(b, m.values[k])
+	}
+	b.WriteByte('}')
+}
+
+func (m *ObjMap) IsEqual(other value.Value) bool {
+	o, ok := other.(*ObjMap)
+	return ok && o == m
+}
+
+func (m *ObjMap) IsFalsey() bool { return false }
+
+func (m *ObjMap) IsType(other value.Value) bool {
+	_, ok := other.(*ObjMap)
+	return ok
+}
+func (m *ObjMap) IsBool() bool     { return false }
+func (m *ObjMap) IsNil() bool      { return false }
+func (m *ObjMap) IsNumber() bool   { return false }
+func (m *ObjMap) IsString() bool   { return false }
+func (m *ObjMap) IsFunction() bool { return false }
@@ -0,0 +1,44 @@
+package object
+
+import (
+	"github.com/VannRR/golox/internal/value"
+	"slices"
+	"testing"
+)
+
+func Test_ObjMap(t *testing.T) {
+	m := NewMap()
+	m.Set("b", value.NumberVal(1))
+	m.Set("a", ObjString("two"))
+	m.Set("b", value.NilVal{})
+	other := NewMap()
+
+	if want := "{b: nil, a: two}"; m.String() != want {
+		t.Errorf("Expected String to return %q, but got %q", want, m.String())
+	}
+	if want := []string{"b", "a"}; !slices.Equal(m.Keys(), want) || m.Len() != 2 {
+		t.Errorf("Expected keys %v, but got %v", want, m.Keys())
+	}
+	if v, ok := m.Get("a"); !ok || !v.IsEqual(ObjString("two")) {
+		t.Errorf("Expected a to be two, but got %v", v)
+	}
+	if _, ok := m.Get("c"); ok {
+		t.Errorf("Expected c not to be set")
+	}
+	if !m.Delete("b") || m.Delete("b") || m.String() != "{a: two}" {
+		t.Errorf("Expected Delete to remove b once, but got %v", m)
+	}
+	m.Set("b", value.NumberVal(3))
+	if want := []string{"a", "b"}; !slices.Equal(m.Keys(), want) {
+		t.Errorf("Expected a deleted key to be set again at the end, but got %v", m.Keys())
+	}
+	if !m.IsEqual(m) || m.IsEqual(other) {
+		t.Errorf("Expected maps to only be equal to themselves")
+	}
+	if !m.IsType(other) || m.IsType(NewArray(nil)) {
+		t.Errorf("Expected maps to only have the type of other maps")
+	}
+	if m.IsFalsey() || m.IsString() || m.IsFunction() || m.IsNil() {
+		t.Errorf("Expected a map to be a truthy value of its own type")
+	}
+}
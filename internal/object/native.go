@@ -0,0 +1,54 @@
+package object
+
+import (
+	"fmt"
+	"github.com/VannRR/golox/internal/value"
+)
+
+// NativeFn implements a native function in Go, it is called with exactly as
+// many arguments as the function's arity and returns an error to stop the
+// script with a runtime error.
+type NativeFn func(args []value.Value) (value.Value, error)
+
+type ObjNative struct {
+	arity    int
+	name     string
+	fn       NativeFn
+	accessor bool
+}
+
+func NewNative(name string, arity int, fn NativeFn) *ObjNative {
+	return &ObjNative{arity: arity, name: name, fn: fn}
+}
+
+// NewAccessor returns a native that only returns values its arguments
+// already hold, so its results are nothing newly allocated.
+func NewAccessor(name string, arity int, fn NativeFn) *ObjNative {
+	return &ObjNative{arity: arity, name: name, fn: fn, accessor: true}
+}
+
+func (n *ObjNative) Arity() int { return n.arity }
+
+func (n *ObjNative) Name() string { return n.name }
+
+func (n *ObjNative) IsAccessor() bool { return n.accessor }
+
+func (n *ObjNative) Call(args []value.Value) (value.Value, error) { return n.fn(args) }
+
+func (n *ObjNative) String() string {
+	return fmt.Sprintf("<native fn %s>", n.name)
+}
+
+func (n *ObjNative) IsEqual(other value.Value) bool {
+	o, ok := other.(*ObjNative)
+	return ok && o == n
+}
+
+func (n *ObjNative) IsFalsey() bool { return false }
+
+func (n *ObjNative) IsType(other value.Value) bool { return other.IsFunction() }
+func (n *ObjNative) IsBool() bool                  { return false }
+func (n *ObjNative) IsNil() bool                   { return false }
+func (n *ObjNative) IsNumber() bool                { return false }
+func (n *ObjNative) IsString() bool                { return false }
+func (n *ObjNative) IsFunction() bool              { return true }
@@ -0,0 +1,34 @@
+package object
+
+import (
+	"github.com/VannRR/golox/internal/value"
+	"testing"
+)
+
+func Test_ObjNative(t *testing.T) {
+	double := NewNative("double", 1, func(args []value.Value) (value.Value, error) {
+		return args[0].(value.NumberVal) * 2, nil
+	})
+	other := NewNative("double", 1, nil)
+
+	if double.String() != "<native fn double>" {
+		t.Errorf("Expected String to return \"<native fn double>\", but got %q", double.String())
+	}
+	if double.IsAccessor() || !NewAccessor("first", 1, nil).IsAccessor() {
+		t.Errorf("Expected only natives made by NewAccessor to be accessors")
+	}
+	if double.Arity() != 1 || double.Name() != "double" {
+		t.Errorf("Expected arity 1 and name double, but got %d and %q", double.Arity(), double.Name())
+	}
+	if !double.IsEqual(double) || double.IsEqual(other) {
+		t.Errorf("Expected natives to only be equal to themselves")
+	}
+	if !double.IsType(NewFunction()) || !double.IsFunction() || double.IsFalsey() {
+		t.Errorf("Expected a native to be a truthy function")
+	}
+
+	result, err := double.Call([]value.Value{value.NumberVal(21)})
+	if err != nil || result != value.NumberVal(42) {
+		t.Errorf("Expected Call to return 42, but got %v, %v", result, err)
+	}
+}
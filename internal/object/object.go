@@ -1,11 +1,19 @@
 package object
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/VannRR/golox/internal/chunk"
+	"github.com/VannRR/golox/internal/common"
 	"github.com/VannRR/golox/internal/value"
 )
 
+func init() {
+	chunk.RegisterConstant(chunk.ConstantString, unmarshalString)
+	chunk.RegisterConstant(chunk.ConstantFunction, unmarshalFunction)
+}
+
 type ObjString string
 
 func (s ObjString) String() string { return string(s) }
@@ -26,6 +34,14 @@ func (s ObjString) IsNumber() bool                { return false }
 func (s ObjString) IsString() bool                { return true }
 func (s ObjString) IsFunction() bool              { return false }
 
+func (s ObjString) ConstantTag() byte { return chunk.ConstantString }
+
+func (s ObjString) MarshalBinary() ([]byte, error) { return []byte(s), nil }
+
+func unmarshalString(data []byte) (value.Value, error) {
+	return ObjString(data), nil
+}
+
 type ObjFunction struct {
 	arity int
 	chunk chunk.Chunk
@@ -40,6 +56,21 @@ func NewFunction() *ObjFunction {
 	}
 }
 
+// NewFunctionWithChunk wraps the bytecode compiled for a function body.
+func NewFunctionWithChunk(name string, arity int, c *chunk.Chunk) *ObjFunction {
+	return &ObjFunction{
+		arity: arity,
+		name:  name,
+		chunk: *c,
+	}
+}
+
+func (f *ObjFunction) Arity() int { return f.arity }
+
+func (f *ObjFunction) Name() string { return f.name }
+
+func (f *ObjFunction) Chunk() *chunk.Chunk { return &f.chunk }
+
 func (f ObjFunction) String() string {
 	return fmt.Sprintf("<fn %s>", f.name)
 }
@@ -56,3 +87,49 @@ func (f ObjFunction) IsString() bool                { return false }
 func (f ObjFunction) IsFunction() bool              { return true }
 
 func (f *ObjFunction) Free() { f.chunk.Free() }
+
+func (f ObjFunction) Verify() error {
+	if err := f.chunk.VerifyFunction(f.arity); err != nil {
+		return fmt.Errorf("function '%s': %w", f.name, err)
+	}
+	return nil
+}
+
+func (f ObjFunction) ConstantTag() byte { return chunk.ConstantFunction }
+
+func (f ObjFunction) MarshalBinary() ([]byte, error) {
+	code, err := f.chunk.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("function '%s': %w", f.name, err)
+	}
+
+	buf := binary.AppendUvarint(nil, uint64(f.arity))
+	buf = binary.AppendUvarint(buf, uint64(len(f.name)))
+	buf = append(buf, f.name...)
+	return append(buf, code...), nil
+}
+
+func unmarshalFunction(data []byte) (value.Value, error) {
+	arity, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, errors.New("function arity is truncated")
+	}
+	if arity > uint64(common.Uint8Max) {
+		return nil, fmt.Errorf("function arity %d is more than %d", arity, common.Uint8Max)
+	}
+	data = data[n:]
+
+	nameLength, n := binary.Uvarint(data)
+	if n <= 0 || nameLength > uint64(len(data)-n) {
+		return nil, errors.New("function name is truncated")
+	}
+	data = data[n:]
+
+	f := NewFunction()
+	f.arity = int(arity)
+	f.name = string(data[:nameLength])
+	if err := f.chunk.UnmarshalBinary(data[nameLength:]); err != nil {
+		return nil, fmt.Errorf("function '%s': %w", f.name, err)
+	}
+	return f, nil
+}
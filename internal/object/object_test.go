@@ -1,6 +1,8 @@
 package object
 
 import (
+	"github.com/VannRR/golox/internal/chunk"
+	"github.com/VannRR/golox/internal/opcode"
 	"github.com/VannRR/golox/internal/value"
 	"testing"
 )
@@ -124,3 +126,68 @@ func Test_ObjFunction_Stringify(t *testing.T) {
 		t.Errorf("Expected Stringify to return \"%s\" for ObjFunction 'bar', but got \"%s\"", expectedBarString, actualBarString)
 	}
 }
+
+func Test_NewFunctionWithChunk(t *testing.T) {
+	c := chunk.NewChunk()
+	c.Code = []byte{opcode.GetLocal, 2, opcode.Return}
+
+	f := NewFunctionWithChunk("add", 2, c)
+
+	if f.Name() != "add" || f.Arity() != 2 {
+		t.Errorf("Expected function add with arity 2, got %s with arity %d", f.Name(), f.Arity())
+	}
+	if len(f.Chunk().Code) != 3 {
+		t.Errorf("Expected the function to keep its chunk, got %v", f.Chunk().Code)
+	}
+	if err := f.Verify(); err != nil {
+		t.Errorf("Expected the second argument to be readable, got %v", err)
+	}
+	if err := NewFunctionWithChunk("add", 1, c).Verify(); err == nil {
+		t.Errorf("Expected reading past the arguments to fail verification")
+	}
+}
+
+func Test_MarshalBinary_constants(t *testing.T) {
+	inner := NewFunction()
+	inner.name = "inner"
+	inner.arity = 2
+	inner.chunk.AddConstant(ObjString("hello"))
+	inner.chunk.Write(1, 3)
+
+	ch := chunk.NewChunk()
+	ch.AddConstant(ObjString("foo"))
+	ch.AddConstant(inner)
+
+	data, err := ch.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Expected no error marshaling chunk, got '%v'.", err)
+	}
+
+	decoded := chunk.NewChunk()
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Expected no error unmarshaling chunk, got '%v'.", err)
+	}
+
+	if decoded.Constants[0] != ObjString("foo") {
+		t.Errorf("Expected ObjString 'foo', got '%v'.", decoded.Constants[0])
+	}
+
+	f, ok := decoded.Constants[1].(*ObjFunction)
+	if !ok {
+		t.Fatalf("Expected *ObjFunction, got '%T'.", decoded.Constants[1])
+	}
+	if f.name != "inner" || f.arity != 2 {
+		t.Errorf("Expected function 'inner' with arity 2, got '%s' with arity %d.", f.name, f.arity)
+	}
+	if f.chunk.Constants[0] != ObjString("hello") || f.chunk.GetLine(0) != 3 {
+		t.Errorf("Expected function chunk to round trip, got constants '%v' and line %d.", f.chunk.Constants, f.chunk.GetLine(0))
+	}
+}
+
+func Test_unmarshalFunction_errors(t *testing.T) {
+	for _, data := range [][]byte{{}, {0}, {0, 5, 'a'}, {0xff, 0x03}, {0, 1, 'f', 'L'}} {
+		if _, err := unmarshalFunction(data); err == nil {
+			t.Errorf("Expected an error unmarshaling function from %v.", data)
+		}
+	}
+}
@@ -34,42 +34,49 @@ const (
 	Jump
 	JumpIfFalse
 	Loop
+	IncrementLocal
+	LessLocalJumpIfFalse
 	Return
+	// Opcodes are numbered in .loxc files, so new ones go after this line.
+	Call
 )
 
 var Name = map[byte]string{
-	Constant:         "OpConstant",
-	ConstantLong:     "OpConstantLong",
-	Nil:              "OpNil",
-	True:             "OpTrue",
-	False:            "OpFalse",
-	Pop:              "OpPop",
-	GetLocal:         "OpGetLocal",
-	GetLocalLong:     "OpGetLocalLong",
-	SetLocal:         "OpSetLocal",
-	SetLocalLong:     "OpSetLocalLong",
-	GetGlobal:        "OpGetGlobal",
-	GetGlobalLong:    "OpGetGlobalLong",
-	DefineGlobal:     "OpDefineGlobal",
-	DefineGlobalLong: "OpDefineGlobalLong",
-	SetGlobal:        "OpSetGlobal",
-	SetGlobalLong:    "OpSetGlobalLong",
-	Equal:            "OpEqual",
-	NotEqual:         "OpNotEqual",
-	Greater:          "OpGreater",
-	GreaterEqual:     "OpGreaterEqual",
-	Less:             "OpLess",
-	LessEqual:        "OpLessEqual",
-	Add:              "OpAdd",
-	Subtract:         "OpSubtract",
-	Multiply:         "OpMultiply",
-	Divide:           "OpDivide",
-	Not:              "OpNot",
-	Modulo:           "OpModulo",
-	Negate:           "OpNegate",
-	Print:            "OpPrint",
-	Jump:             "OpJump",
-	JumpIfFalse:      "OpJumpIfFalse",
-	Loop:             "OpLoop",
-	Return:           "OpReturn",
+	Constant:             "OpConstant",
+	ConstantLong:         "OpConstantLong",
+	Nil:                  "OpNil",
+	True:                 "OpTrue",
+	False:                "OpFalse",
+	Pop:                  "OpPop",
+	GetLocal:             "OpGetLocal",
+	GetLocalLong:         "OpGetLocalLong",
+	SetLocal:             "OpSetLocal",
+	SetLocalLong:         "OpSetLocalLong",
+	GetGlobal:            "OpGetGlobal",
+	GetGlobalLong:        "OpGetGlobalLong",
+	DefineGlobal:         "OpDefineGlobal",
+	DefineGlobalLong:     "OpDefineGlobalLong",
+	SetGlobal:            "OpSetGlobal",
+	SetGlobalLong:        "OpSetGlobalLong",
+	Equal:                "OpEqual",
+	NotEqual:             "OpNotEqual",
+	Greater:              "OpGreater",
+	GreaterEqual:         "OpGreaterEqual",
+	Less:                 "OpLess",
+	LessEqual:            "OpLessEqual",
+	Add:                  "OpAdd",
+	Subtract:             "OpSubtract",
+	Multiply:             "OpMultiply",
+	Divide:               "OpDivide",
+	Not:                  "OpNot",
+	Modulo:               "OpModulo",
+	Negate:               "OpNegate",
+	Print:                "OpPrint",
+	Jump:                 "OpJump",
+	JumpIfFalse:          "OpJumpIfFalse",
+	Loop:                 "OpLoop",
+	IncrementLocal:       "OpIncrementLocal",
+	LessLocalJumpIfFalse: "OpLessLocalJumpIfFalse",
+	Return:               "OpReturn",
+	Call:                 "OpCall",
 }
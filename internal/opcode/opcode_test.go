@@ -6,7 +6,7 @@ import (
 )
 
 func Test_Name(t *testing.T) {
-	for i := byte(0); i < opcode.Return; i++ {
+	for i := byte(0); i <= opcode.Call; i++ {
 		_, exists := opcode.Name[i]
 		if !exists {
 			t.Errorf("Opcode '%v' is unknown.", i)
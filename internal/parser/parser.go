@@ -0,0 +1,385 @@
+// Package parser builds the syntax tree of a Lox script and reports its
+// syntax errors.
+package parser
+
+import (
+	"github.com/VannRR/golox/internal/ast"
+	"github.com/VannRR/golox/internal/common"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/lexer"
+	"github.com/VannRR/golox/internal/token"
+)
+
+const (
+	precNone       precedence = iota
+	precAssignment            // =
+	precOr                    // or
+	precAnd                   // and
+	precEquality              // == !=
+	precComparison            // < > <= >=
+	precTerm                  // + -
+	precFactor                // * / %
+	precUnary                 // ! -
+	precCall                  // ()
+	precPrimary
+)
+
+type precedence = uint8
+
+var precedences = map[token.TokenType]precedence{
+	token.LeftParen:    precCall,
+	token.Minus:        precTerm,
+	token.Plus:         precTerm,
+	token.Slash:        precFactor,
+	token.Star:         precFactor,
+	token.Percent:      precFactor,
+	token.BangEqual:    precEquality,
+	token.EqualEqual:   precEquality,
+	token.Greater:      precComparison,
+	token.GreaterEqual: precComparison,
+	token.Less:         precComparison,
+	token.LessEqual:    precComparison,
+	token.And:          precAnd,
+	token.Or:           precOr,
+}
+
+type Parser struct {
+	lexer       *lexer.Lexer
+	current     token.Token
+	previous    token.Token
+	panicMode   bool
+	diagnostics []diagnostic.Diagnostic
+}
+
+func newParser(source *[]byte) *Parser {
+	return &Parser{lexer: lexer.NewLexer(source)}
+}
+
+// Parse returns the syntax tree of source and its syntax errors. When there
+// are errors the tree holds what could be parsed, with BadExpr nodes where
+// expressions were missing.
+func Parse(source *[]byte) (*ast.File, []diagnostic.Diagnostic) {
+	p := newParser(source)
+	file := &ast.File{Statements: make([]ast.Stmt, 0)}
+
+	p.advance()
+	for !p.match(token.Eof) {
+		if statement := p.declaration(); statement != nil {
+			file.Statements = append(file.Statements, statement)
+		}
+	}
+	file.Eof = p.previous
+	file.Comments = p.lexer.Comments()
+
+	return file, p.diagnostics
+}
+
+// ParseExpression parses source as a single expression, with nothing after
+// it.
+func ParseExpression(source *[]byte) (ast.Expr, []diagnostic.Diagnostic) {
+	p := newParser(source)
+	p.advance()
+	expression := p.expression()
+	p.consume(token.Eof, "Expect end of expression.")
+	return expression, p.diagnostics
+}
+
+func (p *Parser) declaration() ast.Stmt {
+	var statement ast.Stmt
+	if p.match(token.Fun) {
+		statement = p.funDeclaration()
+	} else if p.match(token.Var) {
+		statement = p.varDeclaration()
+	} else {
+		statement = p.statement()
+	}
+
+	if p.panicMode {
+		p.synchronize()
+	}
+	return statement
+}
+
+func (p *Parser) statement() ast.Stmt {
+	if p.match(token.Print) {
+		return p.printStatement()
+	} else if p.match(token.For) {
+		return p.forStatement()
+	} else if p.match(token.If) {
+		return p.ifStatement()
+	} else if p.match(token.Return) {
+		return p.returnStatement()
+	} else if p.match(token.While) {
+		return p.whileStatement()
+	} else if p.match(token.LeftBrace) {
+		return p.block()
+	}
+	return p.expressionStatement()
+}
+
+func (p *Parser) printStatement() ast.Stmt {
+	s := &ast.PrintStmt{Keyword: p.previous}
+	s.Expression = p.expression()
+	s.Semicolon = p.consume(token.Semicolon, "Expect ';' after value.")
+	return s
+}
+
+func (p *Parser) forStatement() ast.Stmt {
+	s := &ast.ForStmt{Keyword: p.previous}
+	p.consume(token.LeftParen, "Expect '(' after 'for'.")
+	if p.match(token.Semicolon) {
+		// No initializer.
+	} else if p.match(token.Var) {
+		s.Initializer = p.varDeclaration()
+	} else {
+		s.Initializer = p.expressionStatement()
+	}
+
+	if !p.match(token.Semicolon) {
+		s.Condition = p.expression()
+		p.consume(token.Semicolon, "Expect ';' after loop condition.")
+	}
+	s.ConditionSemicolon = p.previous
+
+	if !p.match(token.RightParen) {
+		s.Increment = p.expression()
+		p.consume(token.RightParen, "Expect ')' after for clauses.")
+	}
+	s.RightParen = p.previous
+
+	s.Body = p.statement()
+	return s
+}
+
+func (p *Parser) ifStatement() ast.Stmt {
+	s := &ast.IfStmt{Keyword: p.previous}
+	p.consume(token.LeftParen, "Expect '(' after 'if'.")
+	s.Condition = p.expression()
+	s.RightParen = p.consume(token.RightParen, "Expect ')' after condition.")
+
+	s.Then = p.statement()
+	if p.match(token.Else) {
+		s.Else = p.statement()
+	}
+	return s
+}
+
+func (p *Parser) returnStatement() ast.Stmt {
+	s := &ast.ReturnStmt{Keyword: p.previous}
+	if !p.match(token.Semicolon) {
+		s.Value = p.expression()
+		p.consume(token.Semicolon, "Expect ';' after return value.")
+	}
+	s.Semicolon = p.previous
+	return s
+}
+
+func (p *Parser) whileStatement() ast.Stmt {
+	s := &ast.WhileStmt{Keyword: p.previous}
+	p.consume(token.LeftParen, "Expect '(' after 'while'.")
+	s.Condition = p.expression()
+	s.RightParen = p.consume(token.RightParen, "Expect ')' after condition.")
+	s.Body = p.statement()
+	return s
+}
+
+func (p *Parser) expressionStatement() ast.Stmt {
+	s := &ast.ExpressionStmt{Expression: p.expression()}
+	s.Semicolon = p.consume(token.Semicolon, "Expect ';' after expression.")
+	return s
+}
+
+func (p *Parser) synchronize() {
+	p.panicMode = false
+
+	for p.current.Type != token.Eof {
+		if p.previous.Type == token.Semicolon {
+			return
+		}
+		switch p.current.Type {
+		case token.Class, token.Fun, token.Var, token.For,
+			token.If, token.While, token.Print, token.Return:
+			return
+		default:
+			// Do nothing
+		}
+		p.advance()
+	}
+}
+
+func (p *Parser) funDeclaration() ast.Stmt {
+	s := &ast.FunStmt{Keyword: p.previous, Params: make([]token.Token, 0)}
+	s.Name = p.consume(token.Identifier, "Expect function name.")
+
+	p.consume(token.LeftParen, "Expect '(' after function name.")
+	if !p.check(token.RightParen) {
+		for {
+			if len(s.Params) == common.Uint8Max {
+				p.errorAt(p.current, diagnostic.CodeCompilerLimit, "Can't have more than 255 parameters.")
+			}
+			s.Params = append(s.Params, p.consume(token.Identifier, "Expect parameter name."))
+			if !p.match(token.Comma) {
+				break
+			}
+		}
+	}
+	p.consume(token.RightParen, "Expect ')' after parameters.")
+	p.consume(token.LeftBrace, "Expect '{' before function body.")
+	s.Body = p.block()
+	return s
+}
+
+func (p *Parser) varDeclaration() ast.Stmt {
+	s := &ast.VarStmt{Keyword: p.previous}
+	s.Name = p.consume(token.Identifier, "Expect variable name.")
+
+	if p.match(token.Equal) {
+		s.Initializer = p.expression()
+	}
+	s.Semicolon = p.consume(token.Semicolon, "Expect ';' after variable declaration.")
+	return s
+}
+
+// block parses the statements after a '{' that was just matched.
+func (p *Parser) block() *ast.BlockStmt {
+	s := &ast.BlockStmt{LeftBrace: p.previous, Statements: make([]ast.Stmt, 0)}
+	for !p.check(token.RightBrace) && !p.check(token.Eof) {
+		if statement := p.declaration(); statement != nil {
+			s.Statements = append(s.Statements, statement)
+		}
+	}
+	s.RightBrace = p.consume(token.RightBrace, "Expect '}' after block.")
+	return s
+}
+
+func (p *Parser) expression() ast.Expr {
+	return p.parsePrecedence(precAssignment)
+}
+
+func (p *Parser) parsePrecedence(prec precedence) ast.Expr {
+	p.advance()
+	canAssign := prec <= precAssignment
+
+	left := p.prefix(canAssign)
+	if left == nil {
+		p.error("Expect expression.")
+		return &ast.BadExpr{Token: p.previous}
+	}
+
+	for prec <= precedences[p.current.Type] {
+		p.advance()
+		left = p.infix(left)
+	}
+
+	if canAssign && p.match(token.Equal) {
+		p.errorCode(diagnostic.CodeInvalidAssignment, "Invalid assignment target.")
+	}
+	return left
+}
+
+// prefix parses the expression starting with the token just consumed, it
+// returns nil when no expression can start with it.
+func (p *Parser) prefix(canAssign bool) ast.Expr {
+	operator := p.previous
+	switch operator.Type {
+	case token.LeftParen:
+		e := &ast.Grouping{LeftParen: operator, Expression: p.expression()}
+		e.RightParen = p.consume(token.RightParen, "Expect ')' after expression.")
+		return e
+	case token.Minus, token.Bang:
+		return &ast.Unary{Operator: operator, Right: p.parsePrecedence(precUnary)}
+	case token.Identifier:
+		if canAssign && p.match(token.Equal) {
+			return &ast.Assign{Name: operator, Value: p.expression()}
+		}
+		return &ast.Variable{Name: operator}
+	case token.String, token.Number, token.True, token.False, token.Nil:
+		return &ast.Literal{Token: operator}
+	}
+	return nil
+}
+
+// infix parses the rest of a binary, logical or call expression whose
+// operator was just consumed.
+func (p *Parser) infix(left ast.Expr) ast.Expr {
+	operator := p.previous
+	switch operator.Type {
+	case token.LeftParen:
+		return p.call(left)
+	case token.And:
+		return &ast.Logical{Left: left, Operator: operator, Right: p.parsePrecedence(precAnd)}
+	case token.Or:
+		return &ast.Logical{Left: left, Operator: operator, Right: p.parsePrecedence(precOr)}
+	}
+	return &ast.Binary{Left: left, Operator: operator, Right: p.parsePrecedence(precedences[operator.Type] + 1)}
+}
+
+func (p *Parser) call(callee ast.Expr) ast.Expr {
+	e := &ast.Call{Callee: callee, LeftParen: p.previous, Arguments: make([]ast.Expr, 0)}
+	if !p.check(token.RightParen) {
+		for {
+			argument := p.expression()
+			if len(e.Arguments) == common.Uint8Max {
+				p.errorCode(diagnostic.CodeCompilerLimit, "Can't have more than 255 arguments.")
+			}
+			e.Arguments = append(e.Arguments, argument)
+			if !p.match(token.Comma) {
+				break
+			}
+		}
+	}
+	e.RightParen = p.consume(token.RightParen, "Expect ')' after arguments.")
+	return e
+}
+
+func (p *Parser) error(message string) {
+	p.errorAt(p.previous, diagnostic.CodeSyntax, message)
+}
+
+func (p *Parser) errorCode(code string, message string) {
+	p.errorAt(p.previous, code, message)
+}
+
+func (p *Parser) errorAt(t token.Token, code string, message string) {
+	if p.panicMode {
+		return
+	}
+	p.panicMode = true
+	p.diagnostics = append(p.diagnostics, diagnostic.AtToken(code, message, t, p.previous))
+}
+
+func (p *Parser) match(tt token.TokenType) bool {
+	if !p.check(tt) {
+		return false
+	}
+	p.advance()
+	return true
+}
+
+func (p *Parser) check(tt token.TokenType) bool {
+	return p.current.Type == tt
+}
+
+func (p *Parser) advance() {
+	p.previous = p.current
+
+	for {
+		p.current = p.lexer.ScanToken()
+		if p.current.Type != token.Error {
+			break
+		}
+		p.errorAt(p.current, diagnostic.CodeInvalidToken, string(p.current.Lexeme))
+	}
+}
+
+// consume returns the token it expected, or the token found instead after
+// reporting an error.
+func (p *Parser) consume(tt token.TokenType, message string) token.Token {
+	if p.current.Type == tt {
+		p.advance()
+		return p.previous
+	}
+
+	p.errorAt(p.current, diagnostic.CodeSyntax, message)
+	return p.current
+}
@@ -0,0 +1,358 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/VannRR/golox/internal/ast"
+	"github.com/VannRR/golox/internal/token"
+	"strings"
+	"testing"
+)
+
+func sprintFile(file *ast.File) string {
+	statements := make([]string, 0, len(file.Statements))
+	for _, statement := range file.Statements {
+		statements = append(statements, ast.Sprint(statement))
+	}
+	return strings.Join(statements, " ")
+}
+
+func Test_Parse(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{
+			name:     "precedence",
+			source:   "print 1 + 2 * 3 - -4 % 5;",
+			expected: "(print (- (+ 1 (* 2 3)) (% (- 4) 5)))",
+		},
+		{
+			name:     "comparison and equality",
+			source:   "a == b < c != !d >= e;",
+			expected: "(expr (!= (== a (< b c)) (>= (! d) e)))",
+		},
+		{
+			name:     "logical",
+			source:   "a or b and c or d;",
+			expected: "(expr (or a (or (and b c) d)))",
+		},
+		{
+			name:     "assignment",
+			source:   "a = b = 1 + 2;",
+			expected: "(expr (= a (= b (+ 1 2))))",
+		},
+		{
+			name:     "grouping and calls",
+			source:   "(f)(1, g(2))();",
+			expected: "(expr (call (call (group f) 1 (call g 2))))",
+		},
+		{
+			name:     "declarations",
+			source:   "var a; var b = \"s\"; fun f(x, y) { return x; } fun g() { return; }",
+			expected: "(var a) (var b \"s\") (fun f(x y) (block (return x))) (fun g() (block (return)))",
+		},
+		{
+			name:     "control flow",
+			source:   "if (a) print 1; else { print 2; } while (true) a = nil; if (b) {}",
+			expected: "(if a (print 1) (block (print 2))) (while true (expr (= a nil))) (if b (block))",
+		},
+		{
+			name:     "for",
+			source:   "for (var i = 0; i < 3; i = i + 1) print i; for (;;) {} for (i = 0; false;) {}",
+			expected: "(for (var i 0) (< i 3) (= i (+ i 1)) (print i)) (for nil nil nil (block)) (for (expr (= i 0)) false nil (block))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := []byte(tt.source)
+			file, diagnostics := Parse(&s)
+			if len(diagnostics) > 0 {
+				t.Fatalf("Parse() diagnostics = %v", diagnostics)
+			}
+			if got := sprintFile(file); got != tt.expected {
+				t.Errorf("Parse() = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_Parse_spans(t *testing.T) {
+	s := []byte("var total = 0;\nfor (var i = 0; i < 3;) {\n  total = total + add(i, 1);\n}")
+	file, diagnostics := Parse(&s)
+	if len(diagnostics) > 0 {
+		t.Fatalf("Parse() diagnostics = %v", diagnostics)
+	}
+
+	loop := file.Statements[1].(*ast.ForStmt)
+	assignment := loop.Body.(*ast.BlockStmt).Statements[0].(*ast.ExpressionStmt).Expression.(*ast.Assign)
+	call := assignment.Value.(*ast.Binary).Right.(*ast.Call)
+
+	tests := []struct {
+		name     string
+		node     ast.Node
+		expected string
+	}{
+		{name: "var", node: file.Statements[0], expected: "var total = 0;"},
+		{name: "for", node: loop, expected: string(s[15:])},
+		{name: "condition", node: loop.Condition, expected: "i < 3"},
+		{name: "assignment", node: assignment, expected: "total = total + add(i, 1)"},
+		{name: "call", node: call, expected: "add(i, 1)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span := tt.node.Span()
+			if got := string(s[span.Offset : span.Offset+span.Length]); got != tt.expected {
+				t.Errorf("Span() covers %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+
+	if loop.ConditionSemicolon.Type != token.Semicolon || loop.RightParen.Type != token.RightParen {
+		t.Errorf("ForStmt tokens = %v, %v", loop.ConditionSemicolon, loop.RightParen)
+	}
+	if file.Eof.Type != token.Eof || file.Eof.Offset != len(s) {
+		t.Errorf("File.Eof = %v, expected Eof at %d", file.Eof, len(s))
+	}
+}
+
+func Test_Parse_errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected []string
+		tree     string
+	}{
+		{
+			name:     "missing expression",
+			source:   "print ;\nprint 2;",
+			expected: []string{"1:7 E0001 Expect expression."},
+			tree:     "(print <bad>) (print 2)",
+		},
+		{
+			name:     "synchronizes after each error",
+			source:   "var = 1;\nprint 1\nvar b = 2;",
+			expected: []string{"1:5 E0001 Expect variable name.", "3:1 E0001 Expect ';' after value."},
+			tree:     "(var = 1) (print 1) (var b 2)",
+		},
+		{
+			name:     "invalid assignment",
+			source:   "a + b = c;",
+			expected: []string{"1:7 E0003 Invalid assignment target."},
+		},
+		{
+			name:     "invalid token",
+			source:   "print #;",
+			expected: []string{"1:7 E0002 Unrecognized character, 35 / \"#\""},
+		},
+		{
+			name:     "unclosed block",
+			source:   "{ print 1;",
+			expected: []string{"1:11 E0001 Expect '}' after block."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := []byte(tt.source)
+			file, diagnostics := Parse(&s)
+
+			got := make([]string, 0, len(diagnostics))
+			for _, d := range diagnostics {
+				got = append(got, fmt.Sprintf("%d:%d %s %s", d.Span.Line, d.Span.Column, d.Code, d.Message))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Errorf("Parse() diagnostics = %v, expected %v", got, tt.expected)
+			}
+			if tt.tree != "" && sprintFile(file) != tt.tree {
+				t.Errorf("Parse() = %s, expected %s", sprintFile(file), tt.tree)
+			}
+		})
+	}
+}
+
+func Test_Parse_comments(t *testing.T) {
+	s := []byte("// first\nprint 1; /* second */\n")
+	file, diagnostics := Parse(&s)
+	if len(diagnostics) > 0 {
+		t.Fatalf("Parse() diagnostics = %v", diagnostics)
+	}
+
+	comments := make([]string, 0, len(file.Comments))
+	for _, c := range file.Comments {
+		comments = append(comments, string(c.Lexeme))
+	}
+	if fmt.Sprint(comments) != fmt.Sprint([]string{"// first", "/* second */"}) {
+		t.Errorf("File.Comments = %q", comments)
+	}
+}
+
+func Test_ParseExpression(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+		errors   []string
+	}{
+		{name: "expression", source: "a = f(1) + 2", expected: "(= a (+ (call f 1) 2))"},
+		{name: "statement", source: "print 1", expected: "<bad>", errors: []string{"1:1 E0001 Expect expression."}},
+		{name: "trailing tokens", source: "1 2", expected: "1", errors: []string{"1:3 E0001 Expect end of expression."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := []byte(tt.source)
+			expression, diagnostics := ParseExpression(&s)
+
+			errors := make([]string, 0, len(diagnostics))
+			for _, d := range diagnostics {
+				errors = append(errors, fmt.Sprintf("%d:%d %s %s", d.Span.Line, d.Span.Column, d.Code, d.Message))
+			}
+			if fmt.Sprint(errors) != fmt.Sprint(tt.errors) {
+				t.Errorf("ParseExpression() diagnostics = %v, expected %v", errors, tt.errors)
+			}
+			if got := ast.Sprint(expression); got != tt.expected {
+				t.Errorf("ParseExpression() = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_newParser(t *testing.T) {
+	s := []byte("var foo = 1;")
+
+	p := newParser(&s)
+
+	if p.lexer == nil {
+		t.Fatal("Expected newParser to set up a lexer.")
+	}
+
+	expected := &Parser{
+		lexer:       p.lexer,
+		current:     token.Token{},
+		previous:    token.Token{},
+		panicMode:   false,
+		diagnostics: nil,
+	}
+
+	if fmt.Sprint(p) != fmt.Sprint(expected) {
+		t.Errorf("Expected newParser '%v', got '%v'.", expected, p)
+	}
+}
+
+func Test_precedences(t *testing.T) {
+	testCases := []struct {
+		tkn      token.TokenType
+		expected precedence
+	}{
+		{tkn: token.Plus, expected: precTerm},
+		{tkn: token.LeftParen, expected: precCall},
+		{tkn: token.Slash, expected: precFactor},
+	}
+
+	for _, tc := range testCases {
+		if p := precedences[tc.tkn]; p != tc.expected {
+			t.Errorf("Expected precedence '%v', got '%v'.", tc.expected, p)
+		}
+	}
+}
+
+func Test_block_fail(t *testing.T) {
+	s := []byte("{var foo = 1;")
+	p := newParser(&s)
+	p.advance()
+	p.match(token.LeftBrace)
+
+	p.block()
+
+	if !p.panicMode {
+		t.Error("Expected panic from block without '}'.")
+	}
+	if len(p.diagnostics) != 1 || p.diagnostics[0].Message != "Expect '}' after block." {
+		t.Errorf("Expected a missing '}' error, got %v", p.diagnostics)
+	}
+}
+
+func Test_parsePrecedence(t *testing.T) {
+	s := []byte("1 + 2")
+	p := newParser(&s)
+	p.advance()
+
+	e := p.parsePrecedence(precTerm)
+
+	if got := ast.Sprint(e); got != "(+ 1 2)" {
+		t.Errorf("Expected parsePrecedence to parse '(+ 1 2)', got '%v'.", got)
+	}
+	if len(p.diagnostics) > 0 {
+		t.Errorf("Expected no errors, got %v", p.diagnostics)
+	}
+}
+
+func Test_match(t *testing.T) {
+	s := []byte("123")
+	p := newParser(&s)
+
+	numberToken := p.lexer.ScanToken()
+
+	p.current = numberToken
+
+	if p.match(token.Number) != true {
+		t.Error("Expected token to match type Number")
+	}
+
+	p.current = numberToken
+
+	if p.match(token.Nil) != false {
+		t.Error("Expected token to not match type Nil")
+	}
+}
+
+func Test_advance(t *testing.T) {
+	input := "123"
+	s := []byte(input)
+	p := newParser(&s)
+
+	p.advance()
+
+	if string(p.previous.Lexeme) != "" {
+		t.Error("Expected previous token Lexeme to be ''/(blank).")
+	}
+
+	if string(p.current.Lexeme) != input {
+		t.Errorf("Expected current token Lexeme to be '%v'.", input)
+	}
+
+	p.advance()
+
+	if string(p.previous.Lexeme) != input {
+		t.Errorf("Expected previous token Lexeme to be '%v'.", input)
+	}
+}
+
+func Test_consume(t *testing.T) {
+	input := "123"
+	msg := "test consume error"
+	s := []byte(input)
+	p := newParser(&s)
+
+	p.current = p.lexer.ScanToken()
+
+	p.consume(token.Number, msg)
+
+	if string(p.previous.Lexeme) != input {
+		t.Errorf("Expected current token Lexeme to be '%v'.", input)
+	}
+
+	s = []byte(input)
+	p = newParser(&s)
+
+	p.current = p.lexer.ScanToken()
+
+	p.consume(token.Nil, msg)
+
+	if len(p.diagnostics) != 1 || p.diagnostics[0].Message != msg {
+		t.Error("Expected error to trigger for non matching token type.")
+	}
+}
@@ -0,0 +1,270 @@
+// Package repl implements golox's interactive prompt, which runs each input
+// as soon as it is complete and keeps the globals it defines for the next.
+package repl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/VannRR/golox/internal/chunk"
+	"github.com/VannRR/golox/internal/compiler"
+	"github.com/VannRR/golox/internal/debug"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/lexer"
+	"github.com/VannRR/golox/internal/lineedit"
+	"github.com/VannRR/golox/internal/token"
+	"github.com/VannRR/golox/internal/vm"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+const (
+	prompt             = "> "
+	continuationPrompt = "... "
+)
+
+const help = `Enter Lox statements to run them or an expression to print its value, an
+input continues on the next line while it has unclosed braces,
+parentheses, strings or comments.
+Commands:
+  :help           print this help
+  :reset          forget all globals
+  :load <file>    run a file, keeping the globals it defines
+  :disasm <code>  print the bytecode of an expression or statements
+  :globals        print the globals
+  :quit           exit, as does Ctrl-D
+Ctrl-C discards the input being typed or stops the running code.
+`
+
+type REPL struct {
+	vm          *vm.VM
+	editor      *lineedit.Editor
+	out         io.Writer
+	errOut      io.Writer
+	historyFile string
+}
+
+// New reads input from in, which is edited in place when it is a terminal.
+// Results and the script's output go to out, errors go to errOut.
+func New(v *vm.VM, in io.Reader, out io.Writer, errOut io.Writer) *REPL {
+	v.SetOutput(out, errOut)
+	return &REPL{
+		vm:     v,
+		editor: lineedit.NewEditor(in, out),
+		out:    out,
+		errOut: errOut,
+	}
+}
+
+// SetHistoryFile loads the history kept in path, if it exists, and saves the
+// history back to it when Run returns.
+func (r *REPL) SetHistoryFile(path string) error {
+	r.historyFile = path
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return r.editor.ReadHistory(f)
+}
+
+// Run reads and runs inputs until the input ends or :quit, then saves the
+// history. Input left incomplete at the end is still run.
+func (r *REPL) Run() error {
+	var buffer strings.Builder
+	for {
+		p := prompt
+		if buffer.Len() > 0 {
+			p = continuationPrompt
+		}
+
+		line, err := r.editor.ReadLine(p)
+		if err == lineedit.ErrInterrupted {
+			buffer.Reset()
+			continue
+		}
+		if err == io.EOF {
+			if buffer.Len() > 0 {
+				r.input([]byte(buffer.String()))
+			}
+			return r.saveHistory()
+		}
+		if err != nil {
+			return err
+		}
+		r.editor.AddHistory(line)
+
+		if buffer.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if quit := r.command(strings.TrimSpace(line)); quit {
+				return r.saveHistory()
+			}
+			continue
+		}
+
+		buffer.WriteString(line)
+		buffer.WriteByte('\n')
+		if source := buffer.String(); !Incomplete(source) {
+			buffer.Reset()
+			if strings.TrimSpace(source) != "" {
+				r.input([]byte(source))
+			}
+		}
+	}
+}
+
+func (r *REPL) saveHistory() error {
+	if r.historyFile == "" {
+		return nil
+	}
+	f, err := os.OpenFile(r.historyFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := r.editor.WriteHistory(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Incomplete reports whether source ends inside a string, a block comment or
+// unbalanced braces or parentheses, so more lines should be read before it is
+// compiled.
+func Incomplete(source string) bool {
+	b := []byte(source)
+	l := lexer.NewLexer(&b)
+	depth := 0
+	for {
+		t := l.ScanToken()
+		switch t.Type {
+		case token.LeftParen, token.LeftBrace:
+			depth++
+		case token.RightParen, token.RightBrace:
+			depth--
+		case token.Error:
+			if message := string(t.Lexeme); message == "Unterminated string." || message == "Unterminated block comment." {
+				return true
+			}
+		case token.Eof:
+			return depth > 0
+		}
+	}
+}
+
+// input runs a bare expression, with or without a semicolon after it, and
+// prints its value, anything else is run as statements.
+func (r *REPL) input(source []byte) {
+	expression := withoutFinalSemicolon(source)
+	program, diagnostics := vm.CompileExpressionDiagnostics("", &expression)
+	if len(diagnostics) > 0 {
+		r.run("", source)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if v, result := r.vm.RunExpression(ctx, program); result == vm.InterpretOk {
+		fmt.Fprintln(r.out, v.String())
+	}
+}
+
+// withoutFinalSemicolon returns source without its last token if that is a
+// semicolon.
+func withoutFinalSemicolon(source []byte) []byte {
+	l := lexer.NewLexer(&source)
+	last := token.Token{Type: token.Eof}
+	for t := l.ScanToken(); t.Type != token.Eof; t = l.ScanToken() {
+		last = t
+	}
+	if last.Type != token.Semicolon {
+		return source
+	}
+	return append(append([]byte{}, source[:last.Offset]...), source[last.Offset+1:]...)
+}
+
+// run compiles and runs source with the globals of the previous inputs.
+// Ctrl-C stops it with a runtime error instead of exiting the REPL.
+func (r *REPL) run(file string, source []byte) vm.InterpretResult {
+	program, diagnostics := vm.CompileFileDiagnostics(file, &source)
+	if len(diagnostics) > 0 {
+		r.render(file, source, diagnostics)
+		return vm.InterpretCompileError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return r.vm.RunKeepingGlobals(ctx, program)
+}
+
+func (r *REPL) render(file string, source []byte, diagnostics []diagnostic.Diagnostic) {
+	diagnostic.NewRenderer(source, file, diagnostic.IsTerminal(r.errOut)).RenderAll(r.errOut, diagnostics)
+}
+
+// command runs a line starting with a colon, it returns true on :quit.
+func (r *REPL) command(line string) bool {
+	name, argument, _ := strings.Cut(line, " ")
+	argument = strings.TrimSpace(argument)
+
+	switch name {
+	case ":help":
+		fmt.Fprint(r.out, help)
+	case ":reset":
+		r.vm.ResetGlobals()
+	case ":load":
+		r.load(argument)
+	case ":disasm":
+		r.disassemble(argument)
+	case ":globals":
+		for _, g := range r.vm.Globals() {
+			fmt.Fprintf(r.out, "%s = %s\n", g.Name, g.Value)
+		}
+	case ":quit":
+		return true
+	default:
+		fmt.Fprintf(r.errOut, "Unknown command %s, try :help.\n", name)
+	}
+	return false
+}
+
+func (r *REPL) load(path string) {
+	if path == "" {
+		fmt.Fprintln(r.errOut, "Usage: :load <file>")
+		return
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(r.errOut, "Could not read file \"%s\": %v\n", path, err)
+		return
+	}
+	r.run(path, source)
+}
+
+// disassemble compiles code as an expression, or failing that as
+// statements, and prints its bytecode followed by that of the functions it
+// declares.
+func (r *REPL) disassemble(code string) {
+	if code == "" {
+		fmt.Fprintln(r.errOut, "Usage: :disasm <code>")
+		return
+	}
+
+	printCode := debug.PrintCode
+	debug.PrintCode = false
+	defer func() { debug.PrintCode = printCode }()
+
+	source := []byte(code)
+	c := chunk.NewChunk()
+	if diagnostics := compiler.CompileExpression(&source, c, nil); len(diagnostics) > 0 {
+		c = chunk.NewChunk()
+		if diagnostics := compiler.CompileDiagnostics(&source, c); len(diagnostics) > 0 {
+			r.render("", source, diagnostics)
+			return
+		}
+	}
+	debug.DisassembleAllTo(r.out, c, "code")
+}
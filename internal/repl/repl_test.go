@@ -0,0 +1,183 @@
+package repl
+
+import (
+	"github.com/VannRR/golox/internal/debug"
+	"github.com/VannRR/golox/internal/vm"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runREPL feeds the lines to a new REPL and returns what it wrote to out and
+// to errOut.
+func runREPL(t *testing.T, lines ...string) (string, string) {
+	debug.PrintCode, debug.TraceExecution = false, false
+	var out, errOut strings.Builder
+	r := New(vm.NewVM(), strings.NewReader(strings.Join(lines, "\n")), &out, &errOut)
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	return out.String(), errOut.String()
+}
+
+func Test_Incomplete(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"print 1;", false},
+		{"", false},
+		{"fun f() {", true},
+		{"fun f() {\n  print 1;\n}", false},
+		{"print (1 +", true},
+		{"print \"abc", true},
+		{"print \"a{bc\";", false},
+		{"/* comment", true},
+		{"// comment {", false},
+		{"}", false},
+		{"print 1 $", false},
+	}
+	for _, tt := range tests {
+		if got := Incomplete(tt.source); got != tt.want {
+			t.Errorf("Incomplete(%q) = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func Test_REPL_Run(t *testing.T) {
+	out, errOut := runREPL(t,
+		"var a = 1;",
+		"fun add(x,",
+		"        y) {",
+		"  return x + y;",
+		"}",
+		"print add(a, 2);",
+		"print \"multi",
+		"line\";",
+	)
+	want := "> > ... ... ... > 3\n> ... multi\nline\n> \n"
+	if out != want || errOut != "" {
+		t.Errorf("Run() wrote %q and %q, want %q", out, errOut, want)
+	}
+}
+
+func Test_REPL_expressions(t *testing.T) {
+	tests := []struct {
+		name       string
+		lines      []string
+		want       string
+		wantErrOut string
+	}{
+		{"bare", []string{"1 + 2"}, "> 3\n> \n", ""},
+		{"semicolon", []string{"1 + 2;"}, "> 3\n> \n", ""},
+		{"semicolon and comment", []string{"1 + 2; // three"}, "> 3\n> \n", ""},
+		{"string", []string{"\"a\" + \"b\""}, "> ab\n> \n", ""},
+		{"global", []string{"var a = 2;", "a * 3"}, "> > 6\n> \n", ""},
+		{"assignment", []string{"var a;", "a = 4;", "a"}, "> > 4\n> 4\n> \n", ""},
+		{"call", []string{"fun f() { return \"r\"; }", "f()"}, "> > r\n> \n", ""},
+		{"multiple lines", []string{"(1 +", "2)"}, "> ... 3\n> \n", ""},
+		{"statement", []string{"print 5;"}, "> 5\n> \n", ""},
+		{"statements", []string{"1; 2;"}, "> > \n", ""},
+		{"runtime error", []string{"-nil"}, "> > \n", "Operand must be a number."},
+		{"compile error", []string{"1 +"}, "> > \n", "Expect expression."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, errOut := runREPL(t, tt.lines...)
+			if out != tt.want {
+				t.Errorf("Run() out = %q, want %q", out, tt.want)
+			}
+			if !strings.Contains(errOut, tt.wantErrOut) || (tt.wantErrOut == "" && errOut != "") {
+				t.Errorf("Run() errOut = %q, want it to contain %q", errOut, tt.wantErrOut)
+			}
+		})
+	}
+}
+
+func Test_REPL_errors(t *testing.T) {
+	out, errOut := runREPL(t, "print 1 +;", "print nope;", "print 2;")
+	if !strings.HasSuffix(out, "2\n> \n") {
+		t.Errorf("Run() kept going wrong, wrote %q", out)
+	}
+	if !strings.Contains(errOut, "Expect expression.") || !strings.Contains(errOut, "Undefined variable 'nope'.") {
+		t.Errorf("Run() errors = %q", errOut)
+	}
+}
+
+func Test_REPL_incompleteAtEnd(t *testing.T) {
+	out, errOut := runREPL(t, "print (1 +", "2")
+	if out != "> ... ... \n" || !strings.Contains(errOut, "Expect ')' after expression.") {
+		t.Errorf("Run() wrote %q and %q", out, errOut)
+	}
+}
+
+func Test_REPL_commands(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lib.lox")
+	if err := os.WriteFile(path, []byte("var loaded = \"yes\";\nprint \"loading\";\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		lines      []string
+		wantOut    []string
+		wantErrOut string
+	}{
+		{"help", []string{":help"}, []string{":disasm <code>"}, ""},
+		{"globals", []string{"var b = 2;", "var a = \"x\";", ":globals"}, []string{"a = x\nb = 2\n"}, ""},
+		{"reset", []string{"var a = 1;", ":reset", ":globals", "print a;"}, []string{"> > > > "}, "Undefined variable 'a'."},
+		{"load", []string{":load " + path, "print loaded;"}, []string{"loading\n", "yes\n"}, ""},
+		{"load missing", []string{":load " + filepath.Join(dir, "missing.lox")}, nil, "Could not read file"},
+		{"load usage", []string{":load"}, nil, "Usage: :load <file>"},
+		{"disasm expression", []string{":disasm 1 + 2"}, []string{"== code ==", "OpAdd", "OpReturn"}, ""},
+		{"disasm statements", []string{":disasm fun f() { return 1; } print f();"}, []string{"== code ==", "OpCall", "== f =="}, ""},
+		{"disasm error", []string{":disasm print;"}, nil, "Expect expression."},
+		{"quit", []string{":quit", "print 1;"}, []string{"> "}, ""},
+		{"unknown", []string{":nope"}, nil, "Unknown command :nope, try :help."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, errOut := runREPL(t, tt.lines...)
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out, want) {
+					t.Errorf("Run() out = %q, want it to contain %q", out, want)
+				}
+			}
+			if !strings.Contains(errOut, tt.wantErrOut) {
+				t.Errorf("Run() errOut = %q, want it to contain %q", errOut, tt.wantErrOut)
+			}
+		})
+	}
+}
+
+func Test_REPL_history(t *testing.T) {
+	debug.PrintCode, debug.TraceExecution = false, false
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("print 0;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	r := New(vm.NewVM(), strings.NewReader("print 1;\n\n:globals\n"), &out, &out)
+	if err := r.SetHistoryFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "print 0;\nprint 1;\n:globals\n"; string(history) != want {
+		t.Errorf("history file = %q, want %q", history, want)
+	}
+
+	r = New(vm.NewVM(), strings.NewReader(""), &out, &out)
+	if err := r.SetHistoryFile(filepath.Join(t.TempDir(), "new")); err != nil {
+		t.Errorf("SetHistoryFile() of a missing file error = %v", err)
+	}
+}
@@ -49,16 +49,63 @@ const (
 
 	Error
 	Eof
+
+	// Trivia, kept by the lexer but never returned from ScanToken.
+	Comment
 )
 
 type TokenType = uint8
 
+var Keywords = map[string]TokenType{
+	"and":    And,
+	"class":  Class,
+	"else":   Else,
+	"false":  False,
+	"for":    For,
+	"fun":    Fun,
+	"if":     If,
+	"nil":    Nil,
+	"or":     Or,
+	"print":  Print,
+	"return": Return,
+	"super":  Super,
+	"this":   This,
+	"true":   True,
+	"var":    Var,
+	"while":  While,
+}
+
+// Token positions are 1-based lines and byte columns, Offset is the 0-based
+// byte offset into the source and Length the number of source bytes the token
+// covers, which differs from len(Lexeme) for Error tokens.
 type Token struct {
 	Type   TokenType
 	Lexeme []byte
-	Line   uint16
+	Line   int
+	Column int
+	Offset int
+	Length int
 }
 
 func (t Token) Stringify() string {
-	return fmt.Sprintf("Type: %v, Lexeme: %s, Line: %d", t.Type, t.Lexeme, t.Line)
+	return fmt.Sprintf("Type: %v, Lexeme: %s, Line: %d, Column: %d", t.Type, t.Lexeme, t.Line, t.Column)
+}
+
+func (t Token) Span() Span {
+	return Span{Line: t.Line, Column: t.Column, Offset: t.Offset, Length: t.Length}
+}
+
+type Span struct {
+	Line   int
+	Column int
+	Offset int
+	Length int
+}
+
+// To returns a span from the start of s to the end of other.
+func (s Span) To(other Span) Span {
+	if end := other.Offset + other.Length; end > s.Offset+s.Length {
+		s.Length = end - s.Offset
+	}
+	return s
 }
@@ -0,0 +1,168 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/VannRR/golox/internal/chunk"
+	"github.com/VannRR/golox/internal/compiler"
+	"github.com/VannRR/golox/internal/token"
+	"github.com/VannRR/golox/internal/value"
+	"sort"
+)
+
+// DebugHook is called before every instruction the VM runs, the VM can be
+// inspected from inside the hook. Returning false stops the run with
+// InterpretCanceled, without reporting an error.
+type DebugHook func(vm *VM) bool
+
+// Frame is an active call as seen by a debugger. IP is the offset of the
+// next instruction the frame runs, Span is the instruction it is paused at,
+// which for the frames below the innermost is the call they wait on.
+type Frame struct {
+	Function string
+	Chunk    *chunk.Chunk
+	IP       int
+	Span     token.Span
+}
+
+// Variable is a named value shown by a debugger.
+type Variable struct {
+	Name  string
+	Value value.Value
+}
+
+// SetDebugHook installs a hook that runs before every instruction, nil
+// removes it.
+func (vm *VM) SetDebugHook(hook DebugHook) {
+	vm.hook = hook
+}
+
+// Depth returns how many calls are active, the top level of the script
+// counts as one.
+func (vm *VM) Depth() int {
+	return len(vm.frames)
+}
+
+// Location returns the chunk and offset of the next instruction to run.
+func (vm *VM) Location() (*chunk.Chunk, int) {
+	return vm.chunk, vm.ip
+}
+
+// Frames returns the active calls, innermost first.
+func (vm *VM) Frames() []Frame {
+	frames := make([]Frame, 0, len(vm.frames))
+	for i := len(vm.frames) - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		f := Frame{Chunk: frame.chunk, IP: frame.ip}
+		if i == len(vm.frames)-1 {
+			f.IP = vm.ip
+			f.Span = frame.chunk.GetSpan(vm.ip)
+		} else {
+			f.Span = frame.chunk.GetSpan(frame.ip - 1)
+		}
+		if frame.function != nil {
+			f.Function = frame.function.Name()
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// Locals returns the locals in scope in a frame, counted from zero for the
+// innermost, in slot order. A local is left out until its slot holds a value.
+func (vm *VM) Locals(frame int) []Variable {
+	i := len(vm.frames) - 1 - frame
+	if frame < 0 || i < 0 {
+		return nil
+	}
+
+	f := vm.frames[i]
+	ip, top := f.ip, vm.stackTop
+	if frame == 0 {
+		ip = vm.ip
+	} else {
+		top = vm.frames[i+1].slots
+	}
+
+	locals := make([]Variable, 0)
+	for _, local := range f.chunk.LocalsAt(ip) {
+		if f.slots+local.Slot < top {
+			locals = append(locals, Variable{Name: local.Name, Value: vm.stack[f.slots+local.Slot]})
+		}
+	}
+	return locals
+}
+
+// Stack returns the values on the stack, bottom first.
+func (vm *VM) Stack() []value.Value {
+	return append([]value.Value(nil), vm.stack[:vm.stackTop]...)
+}
+
+// Globals returns the defined globals sorted by name.
+func (vm *VM) Globals() []Variable {
+	globals := make([]Variable, 0, len(vm.globals))
+	for name, val := range vm.globals {
+		globals = append(globals, Variable{Name: name, Value: val})
+	}
+	sort.Slice(globals, func(i, j int) bool {
+		return globals[i].Name < globals[j].Name
+	})
+	return globals
+}
+
+// Evaluate compiles and runs a Lox expression as if it appeared in a frame,
+// counted from zero for the innermost, so it can read and assign that
+// frame's locals. It is meant to be called from a DebugHook, the paused run
+// carries on unchanged apart from what the expression assigns.
+func (vm *VM) Evaluate(frame int, expression string) (value.Value, error) {
+	i := len(vm.frames) - 1 - frame
+	if frame < 0 || i < 0 {
+		return nil, fmt.Errorf("no frame %d", frame)
+	}
+	if vm.evaluating {
+		return nil, errors.New("already evaluating an expression")
+	}
+
+	f := vm.frames[i]
+	names := make([]string, 0)
+	for _, local := range f.chunk.LocalsAt(vm.Frames()[frame].IP) {
+		for len(names) <= local.Slot {
+			names = append(names, "")
+		}
+		names[local.Slot] = local.Name
+	}
+
+	source := []byte(expression)
+	ch := chunk.NewChunk()
+	if diagnostics := compiler.CompileExpression(&source, ch, names); len(diagnostics) > 0 {
+		return nil, errors.New(diagnostics[0].Message)
+	}
+
+	savedChunk, savedIP, savedSlots := vm.chunk, vm.ip, vm.slots
+	savedFrames, savedTop, savedBase, savedErr := len(vm.frames), vm.stackTop, vm.baseFrame, vm.err
+
+	vm.frames[len(vm.frames)-1].ip = vm.ip
+	vm.frames = append(vm.frames, CallFrame{function: f.function, chunk: ch, slots: f.slots})
+	vm.baseFrame = len(vm.frames) - 1
+	vm.chunk, vm.ip, vm.slots = ch, 0, f.slots
+	vm.evaluating = true
+
+	var result value.Value
+	status := vm.run()
+	if status == InterpretOk {
+		result = vm.peek(0)
+	}
+	evalErr := vm.err
+
+	vm.evaluating = false
+	vm.frames = vm.frames[:savedFrames]
+	vm.stack = vm.stack[:savedTop]
+	vm.stackTop = savedTop
+	vm.baseFrame, vm.err = savedBase, savedErr
+	vm.chunk, vm.ip, vm.slots = savedChunk, savedIP, savedSlots
+
+	if status != InterpretOk {
+		return nil, errors.New(evalErr.Message)
+	}
+	return result, nil
+}
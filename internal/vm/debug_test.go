@@ -0,0 +1,160 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const debugSource = `var g = 1;
+fun add(a, b) {
+  var sum = a + b;
+  return sum;
+}
+{
+  var x = 10;
+  print add(x, 2);
+}`
+
+// pauseAt runs debugSource and calls inspect the first time the innermost
+// frame reaches line.
+func pauseAt(t *testing.T, line int, inspect func(vm *VM)) string {
+	source := []byte(debugSource)
+	program, ok := Compile(&source)
+	if !ok {
+		t.Fatalf("Expected source to compile")
+	}
+
+	vm := NewVM()
+	var stdout strings.Builder
+	vm.SetOutput(&stdout, &strings.Builder{})
+
+	paused := false
+	vm.SetDebugHook(func(vm *VM) bool {
+		if !paused && vm.Frames()[0].Span.Line == line {
+			paused = true
+			inspect(vm)
+		}
+		return true
+	})
+	if result := vm.Run(program); result != InterpretOk {
+		t.Fatalf("Run() = %d, expected InterpretOk", result)
+	}
+	if !paused {
+		t.Fatalf("Expected the run to reach line %d", line)
+	}
+	return stdout.String()
+}
+
+func sprintVariables(variables []Variable) string {
+	parts := make([]string, 0, len(variables))
+	for _, v := range variables {
+		parts = append(parts, fmt.Sprintf("%s=%s", v.Name, v.Value))
+	}
+	return strings.Join(parts, " ")
+}
+
+func Test_SetDebugHook_stop(t *testing.T) {
+	source := []byte("print 1;\nprint 2;")
+	vm := NewVM()
+	var stdout strings.Builder
+	vm.SetOutput(&stdout, &strings.Builder{})
+
+	vm.SetDebugHook(func(vm *VM) bool {
+		return vm.Frames()[0].Span.Line < 2
+	})
+	if result := vm.Interpret(&source); result != InterpretCanceled {
+		t.Errorf("Interpret() = %d, expected InterpretCanceled", result)
+	}
+	if stdout.String() != "1\n" {
+		t.Errorf("stdout = %q, expected only the first line to run", stdout.String())
+	}
+}
+
+func Test_Frames(t *testing.T) {
+	pauseAt(t, 4, func(vm *VM) {
+		frames := vm.Frames()
+		got := make([]string, 0, len(frames))
+		for _, f := range frames {
+			got = append(got, fmt.Sprintf("%s:%d:%d", f.Function, f.Span.Line, f.Span.Column))
+		}
+		if expected := "[add:4:10 :8:12]"; fmt.Sprint(got) != expected {
+			t.Errorf("Frames() = %v, expected %s", got, expected)
+		}
+		if vm.Depth() != 2 {
+			t.Errorf("Depth() = %d, expected 2", vm.Depth())
+		}
+	})
+}
+
+func Test_Locals(t *testing.T) {
+	pauseAt(t, 4, func(vm *VM) {
+		tests := []struct {
+			frame    int
+			expected string
+		}{
+			{frame: 0, expected: "a=10 b=2 sum=12"},
+			{frame: 1, expected: "x=10"},
+			{frame: 2, expected: ""},
+		}
+		for _, tt := range tests {
+			if got := sprintVariables(vm.Locals(tt.frame)); got != tt.expected {
+				t.Errorf("Locals(%d) = %q, expected %q", tt.frame, got, tt.expected)
+			}
+		}
+		if got := fmt.Sprint(vm.Stack()); got != "[10 <fn add> 10 2 12]" {
+			t.Errorf("Stack() = %s", got)
+		}
+		if got := sprintVariables(vm.Globals()); got != "add=<fn add> g=1" {
+			t.Errorf("Globals() = %q", got)
+		}
+	})
+}
+
+func Test_Locals_uninitialized(t *testing.T) {
+	pauseAt(t, 3, func(vm *VM) {
+		if got := sprintVariables(vm.Locals(0)); got != "a=10 b=2" {
+			t.Errorf("Locals(0) = %q, expected sum to be left out", got)
+		}
+	})
+}
+
+func Test_Evaluate(t *testing.T) {
+	stdout := pauseAt(t, 4, func(vm *VM) {
+		tests := []struct {
+			frame    int
+			source   string
+			expected string
+			err      string
+		}{
+			{frame: 0, source: "sum * 2 + g", expected: "25"},
+			{frame: 0, source: "add(a, b)", expected: "12"},
+			{frame: 1, source: "x = x + 1", expected: "11"},
+			{frame: 0, source: "sum = 100", expected: "100"},
+			{frame: 0, source: "x", err: "Undefined variable 'x'."},
+			{frame: 0, source: "1 +", err: "Expect expression."},
+			{frame: 0, source: "1; print 2", err: "Expect end of expression."},
+			{frame: 3, source: "1", err: "no frame 3"},
+		}
+		for _, tt := range tests {
+			got, err := vm.Evaluate(tt.frame, tt.source)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Evaluate(%q) error = %v, expected %s", tt.source, err, tt.err)
+				}
+				continue
+			}
+			if err != nil || got.String() != tt.expected {
+				t.Errorf("Evaluate(%q) = %v, %v, expected %s", tt.source, got, err, tt.expected)
+			}
+		}
+
+		if got := sprintVariables(vm.Locals(1)); got != "x=11" {
+			t.Errorf("Locals(1) = %q, expected the assignment to stick", got)
+		}
+	})
+
+	if stdout != "100\n" {
+		t.Errorf("stdout = %q, expected the script to return the assigned sum", stdout)
+	}
+}
@@ -0,0 +1,224 @@
+package vm
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/VannRR/golox/internal/object"
+	"github.com/VannRR/golox/internal/value"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// FileSystem is what the file natives read and write through. Reads go
+// through the fs.FS methods, so any fs.FS can be made into a FileSystem with
+// ReadOnlyFileSystem, and it decides which paths are valid.
+type FileSystem interface {
+	fs.FS
+	WriteFile(name string, data []byte) error
+	AppendFile(name string, data []byte) error
+	Remove(name string) error
+}
+
+// SetFileSystem sets the file system scripts can use, nil, the default,
+// denies them all file access.
+func (vm *VM) SetFileSystem(fsys FileSystem) {
+	vm.fs = fsys
+}
+
+func (vm *VM) fileSystem() FileSystem {
+	if vm.fs == nil {
+		return ReadOnlyFileSystem(noFiles{})
+	}
+	return vm.fs
+}
+
+// OSFileSystem gives scripts the same access to files as the program
+// running them, with paths in the operating system's own form.
+func OSFileSystem() FileSystem {
+	return osFileSystem{}
+}
+
+type osFileSystem struct{}
+
+func (osFileSystem) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (osFileSystem) WriteFile(name string, data []byte) error {
+	return os.WriteFile(name, data, 0o644)
+}
+
+func (osFileSystem) AppendFile(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// ReadOnlyFileSystem lets scripts read fsys, writing or deleting fails with
+// fs.ErrPermission.
+func ReadOnlyFileSystem(fsys fs.FS) FileSystem {
+	return readOnlyFileSystem{fsys}
+}
+
+type readOnlyFileSystem struct {
+	fs.FS
+}
+
+func (readOnlyFileSystem) WriteFile(name string, data []byte) error {
+	return &fs.PathError{Op: "write", Path: name, Err: fs.ErrPermission}
+}
+
+func (readOnlyFileSystem) AppendFile(name string, data []byte) error {
+	return &fs.PathError{Op: "write", Path: name, Err: fs.ErrPermission}
+}
+
+func (readOnlyFileSystem) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+}
+
+// noFiles is the file system of a VM without one.
+type noFiles struct{}
+
+func (noFiles) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+}
+
+func (vm *VM) defineFiles() {
+	vm.DefineNative("readFile", 1, func(args []value.Value) (value.Value, error) {
+		path, err := stringArg("readFile", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		data, err := vm.readFile("readFile", path)
+		if err != nil {
+			return nil, err
+		}
+		return object.ObjString(data), nil
+	})
+
+	vm.DefineNative("readLines", 1, func(args []value.Value) (value.Value, error) {
+		path, err := stringArg("readLines", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		data, err := vm.readFile("readLines", path)
+		if err != nil {
+			return nil, err
+		}
+		lines := make([]value.Value, 0)
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, len(data)+1)
+		for scanner.Scan() {
+			lines = append(lines, object.ObjString(scanner.Text()))
+		}
+		return object.NewArray(lines), nil
+	})
+
+	writers := map[string]func(FileSystem, string, []byte) error{
+		"writeFile":  FileSystem.WriteFile,
+		"appendFile": FileSystem.AppendFile,
+	}
+	for name, write := range writers {
+		vm.DefineNative(name, 2, func(args []value.Value) (value.Value, error) {
+			path, text, err := stringArgs2(name, args)
+			if err != nil {
+				return nil, err
+			}
+			if err := write(vm.fileSystem(), path, []byte(text)); err != nil {
+				return nil, fileError(name, err)
+			}
+			return value.NilVal{}, nil
+		})
+	}
+
+	vm.DefineNative("listDir", 1, func(args []value.Value) (value.Value, error) {
+		path, err := stringArg("listDir", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := fs.ReadDir(vm.fileSystem(), path)
+		if err != nil {
+			return nil, fileError("listDir", err)
+		}
+		names := make([]value.Value, len(entries))
+		for i, entry := range entries {
+			names[i] = object.ObjString(entry.Name())
+		}
+		return object.NewArray(names), nil
+	})
+
+	vm.DefineNative("fileExists", 1, func(args []value.Value) (value.Value, error) {
+		path, err := stringArg("fileExists", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		_, err = fs.Stat(vm.fileSystem(), path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return value.BoolVal(false), nil
+		}
+		if err != nil {
+			return nil, fileError("fileExists", err)
+		}
+		return value.BoolVal(true), nil
+	})
+
+	vm.DefineNative("deleteFile", 1, func(args []value.Value) (value.Value, error) {
+		path, err := stringArg("deleteFile", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := vm.fileSystem().Remove(path); err != nil {
+			return nil, fileError("deleteFile", err)
+		}
+		return value.NilVal{}, nil
+	})
+}
+
+// readFile reads a whole file once it knows it fits in the memory limit. The
+// size a file reports can be wrong or the file can grow, so reading stops
+// once it is past what fits.
+func (vm *VM) readFile(native string, path string) ([]byte, error) {
+	f, err := vm.fileSystem().Open(path)
+	if err != nil {
+		return nil, fileError(native, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fileError(native, err)
+	}
+	if err := vm.reserve(native, int(info.Size())); err != nil {
+		return nil, err
+	}
+
+	limit := maxResultBytes
+	if vm.maxBytes > 0 {
+		limit = min(limit, vm.maxBytes-vm.bytesAllocated)
+	}
+	var b bytes.Buffer
+	b.Grow(int(info.Size()))
+	if _, err := b.ReadFrom(io.LimitReader(f, int64(limit)+1)); err != nil {
+		return nil, fileError(native, err)
+	}
+	if err := vm.reserve(native, b.Len()); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func fileError(native string, err error) error {
+	return fmt.Errorf("%s() failed: %v.", native, err)
+}
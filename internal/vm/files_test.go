@@ -0,0 +1,164 @@
+package vm
+
+import (
+	"github.com/VannRR/golox/internal/diagnostic"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// mapFileSystem is a writable FileSystem kept in memory.
+type mapFileSystem struct {
+	fstest.MapFS
+}
+
+func (m mapFileSystem) WriteFile(name string, data []byte) error {
+	m.MapFS[name] = &fstest.MapFile{Data: data}
+	return nil
+}
+
+func (m mapFileSystem) AppendFile(name string, data []byte) error {
+	if f, ok := m.MapFS[name]; ok {
+		data = append(f.Data, data...)
+	}
+	return m.WriteFile(name, data)
+}
+
+func (m mapFileSystem) Remove(name string) error {
+	if _, ok := m.MapFS[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.MapFS, name)
+	return nil
+}
+
+func Test_defineFiles(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+		code   string
+	}{
+		{`print readFile("a.txt");`, "one\ntwo\n\n", ""},
+		{`print readLines("a.txt");`, "[one, two]\n", ""},
+		{`print length(readLines("crlf.txt"));`, "2\n", ""},
+		{`print get(readLines("crlf.txt"), 0) + "|";`, "x|\n", ""},
+		{`print readLines("empty.txt");`, "[]\n", ""},
+		{`writeFile("new.txt", "hi"); print readFile("new.txt");`, "hi\n", ""},
+		{`appendFile("a.txt", "three"); print readLines("a.txt");`, "[one, two, three]\n", ""},
+		{`appendFile("b.txt", "b"); print readFile("b.txt");`, "b\n", ""},
+		{`print listDir(".");`, "[a.txt, crlf.txt, dir, empty.txt]\n", ""},
+		{`print listDir("dir");`, "[c.txt]\n", ""},
+		{`print fileExists("a.txt") and fileExists("dir") and !fileExists("nope.txt");`, "true\n", ""},
+		{`deleteFile("a.txt"); print fileExists("a.txt");`, "false\n", ""},
+		{`readFile("nope.txt");`, "", diagnostic.CodeNative},
+		{`deleteFile("nope.txt");`, "", diagnostic.CodeNative},
+		{`listDir("nope");`, "", diagnostic.CodeNative},
+		{`readFile(1);`, "", diagnostic.CodeType},
+		{`writeFile("a.txt", nil);`, "", diagnostic.CodeType},
+	}
+	for _, tt := range tests {
+		vm := NewVM()
+		vm.SetFileSystem(mapFileSystem{fstest.MapFS{
+			"a.txt":     {Data: []byte("one\ntwo\n")},
+			"crlf.txt":  {Data: []byte("x\r\ny")},
+			"empty.txt": {Data: []byte{}},
+			"dir/c.txt": {Data: []byte("c")},
+		}})
+		got, code := runNatives(t, vm, tt.source)
+		if got != tt.want || code != tt.code {
+			t.Errorf("%q printed %q with error %q, expected %q with %q", tt.source, got, code, tt.want, tt.code)
+		}
+	}
+}
+
+func Test_SetFileSystem(t *testing.T) {
+	vm := NewVM()
+	for _, source := range []string{`readFile("a.txt");`, `writeFile("a.txt", "");`, `fileExists("a.txt");`} {
+		if _, code := runNatives(t, vm, source); code != diagnostic.CodeNative || !strings.Contains(vm.Err().Message, "permission denied") {
+			t.Errorf("Expected %q to be denied without a file system, got %q", source, vm.Err())
+		}
+	}
+
+	vm.SetFileSystem(ReadOnlyFileSystem(fstest.MapFS{"a.txt": {Data: []byte("a")}}))
+	if got, _ := runNatives(t, vm, `print readFile("a.txt");`); got != "a\n" {
+		t.Errorf("Expected a read only file system to be readable, got %q", got)
+	}
+	for _, source := range []string{`writeFile("a.txt", "");`, `appendFile("a.txt", "");`, `deleteFile("a.txt");`} {
+		if _, code := runNatives(t, vm, source); code != diagnostic.CodeNative {
+			t.Errorf("Expected %q to be denied on a read only file system, got %q", source, code)
+		}
+	}
+}
+
+func Test_OSFileSystem(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.txt")
+	vm := NewVM()
+	vm.SetFileSystem(OSFileSystem())
+	vm.SetArgs([]string{path, dir})
+
+	got, code := runNatives(t, vm, `
+writeFile(argv(0), "a");
+appendFile(argv(0), "b");
+print readFile(argv(0));
+print listDir(argv(1));
+deleteFile(argv(0));
+print fileExists(argv(0));`)
+	if want := "ab\n[report.txt]\nfalse\n"; got != want || code != "" {
+		t.Errorf("Expected %q, got %q with error %q", want, got, code)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected deleteFile to remove %s, got %v", path, err)
+	}
+}
+
+func Test_defineFiles_memoryLimit(t *testing.T) {
+	for _, source := range []string{`readFile("big.txt");`, `readLines("big.txt");`} {
+		vm := NewVM()
+		vm.SetMaxBytes(100)
+		vm.SetFileSystem(ReadOnlyFileSystem(fstest.MapFS{"big.txt": {Data: []byte(strings.Repeat("a\n", 100))}}))
+		if _, code := runNatives(t, vm, source); code != diagnostic.CodeMemoryLimit {
+			t.Errorf("Expected %q to go over the memory limit, got %q", source, code)
+		}
+	}
+}
+
+// endlessFileSystem holds files that report a size of zero but never end,
+// like /dev/zero.
+type endlessFileSystem struct{}
+
+func (endlessFileSystem) Open(name string) (fs.File, error) { return endlessFile{}, nil }
+
+type endlessFile struct{}
+
+func (endlessFile) Stat() (fs.FileInfo, error) { return endlessFileInfo{}, nil }
+func (endlessFile) Close() error               { return nil }
+
+func (endlessFile) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
+
+type endlessFileInfo struct{}
+
+func (endlessFileInfo) Name() string       { return "zero" }
+func (endlessFileInfo) Size() int64        { return 0 }
+func (endlessFileInfo) Mode() fs.FileMode  { return 0 }
+func (endlessFileInfo) ModTime() time.Time { return time.Time{} }
+func (endlessFileInfo) IsDir() bool        { return false }
+func (endlessFileInfo) Sys() any           { return nil }
+
+func Test_readFile_endless(t *testing.T) {
+	for _, source := range []string{`readFile("zero");`, `readLines("zero");`} {
+		vm := NewVM()
+		vm.SetMaxBytes(1000)
+		vm.SetFileSystem(ReadOnlyFileSystem(endlessFileSystem{}))
+		if _, code := runNatives(t, vm, source); code != diagnostic.CodeMemoryLimit {
+			t.Errorf("Expected %q to stop at the memory limit, got %q", source, code)
+		}
+	}
+}
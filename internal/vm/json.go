@@ -0,0 +1,224 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/VannRR/golox/internal/object"
+	"github.com/VannRR/golox/internal/value"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxJSONIndent is the most spaces jsonStringify() indents each level by.
+const maxJSONIndent = 10
+
+// defineJSON adds jsonParse() and jsonStringify(). JSON strings, numbers,
+// booleans and null are Lox strings, numbers, bools and nil, arrays are
+// arrays and objects are maps that keep their keys in order.
+func (vm *VM) defineJSON() {
+	vm.DefineNative("jsonParse", 1, func(args []value.Value) (value.Value, error) {
+		text, err := stringArg("jsonParse", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return parseJSON(text)
+	})
+
+	vm.DefineNative("jsonStringify", 2, func(args []value.Value) (value.Value, error) {
+		indent, err := integerArg("jsonStringify", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if indent < 0 || indent > maxJSONIndent {
+			return nil, fmt.Errorf("jsonStringify() expects an indent from 0 to %d, got %d.", maxJSONIndent, indent)
+		}
+		var b bytes.Buffer
+		if err := writeJSON(&b, args[0], strings.Repeat(" ", indent), "\n"); err != nil {
+			return nil, err
+		}
+		return object.ObjString(b.String()), nil
+	})
+}
+
+// parseJSON converts text to Lox values. Syntax errors are reported with the
+// line and column of the input they were found at.
+func parseJSON(text string) (value.Value, error) {
+	var raw json.RawMessage
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line, column := jsonPosition(text, syntaxErr)
+			return nil, fmt.Errorf("jsonParse() failed: %s at line %d, column %d.", strings.TrimPrefix(syntaxErr.Error(), "json: "), line, column)
+		}
+		return nil, fmt.Errorf("jsonParse() failed: %v.", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	return decodeJSON(decoder)
+}
+
+// jsonPosition returns the 1-based line and column, in runes, of a syntax
+// error. Its offset is just past the invalid byte, or the length of the input
+// when it ended too early.
+func jsonPosition(text string, err *json.SyntaxError) (int, int) {
+	offset := min(int(err.Offset), len(text))
+	if offset > 0 && !strings.Contains(err.Error(), "unexpected end") {
+		offset--
+	}
+	before := text[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+	return line, column
+}
+
+// decodeJSON reads the next value from input that is already known to be
+// valid JSON.
+func decodeJSON(decoder *json.Decoder) (value.Value, error) {
+	t, err := decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("jsonParse() failed: %v.", err)
+	}
+
+	switch t := t.(type) {
+	case nil:
+		return value.NilVal{}, nil
+	case bool:
+		return value.BoolVal(t), nil
+	case string:
+		return object.ObjString(t), nil
+	case json.Number:
+		n, err := strconv.ParseFloat(string(t), 64)
+		if err != nil {
+			return nil, fmt.Errorf("jsonParse() failed: number %s is out of range.", t)
+		}
+		return value.NumberVal(n), nil
+	case json.Delim:
+		if t == '[' {
+			elements := []value.Value{}
+			for decoder.More() {
+				e, err := decodeJSON(decoder)
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, e)
+			}
+			decoder.Token()
+			return object.NewArray(elements), nil
+		}
+
+		m := object.NewMap()
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, fmt.Errorf("jsonParse() failed: %v.", err)
+			}
+			v, err := decodeJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			m.Set(key.(string), v)
+		}
+		decoder.Token()
+		return m, nil
+	}
+	return nil, fmt.Errorf("jsonParse() failed: unexpected %v.", t)
+}
+
+// writeJSON writes v to b, putting each array element and map entry on its
+// own line indented by indent when indent isn't empty.
+func writeJSON(b *bytes.Buffer, v value.Value, indent string, newline string) error {
+	switch v := v.(type) {
+	case value.NilVal:
+		b.WriteString("null")
+	case value.BoolVal:
+		b.WriteString(strconv.FormatBool(bool(v)))
+	case value.NumberVal:
+		n := float64(v)
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return fmt.Errorf("jsonStringify() can't convert %s to JSON.", v)
+		}
+		b.WriteString(strconv.FormatFloat(n, 'f', -1, 64))
+	case object.ObjString:
+		writeJSONString(b, string(v))
+	case *object.ObjArray:
+		if len(v.Elements) == 0 {
+			b.WriteString("[]")
+			return nil
+		}
+		b.WriteByte('[')
+		for i, e := range v.Elements {
+			if err := checkJSONLength(b); err != nil {
+				return err
+			}
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeJSONIndent(b, indent, newline+indent)
+			if err := writeJSON(b, e, indent, newline+indent); err != nil {
+				return err
+			}
+		}
+		writeJSONIndent(b, indent, newline)
+		b.WriteByte(']')
+	case *object.ObjMap:
+		if v.Len() == 0 {
+			b.WriteString("{}")
+			return nil
+		}
+		b.WriteByte('{')
+		for i, k := range v.Keys() {
+			if err := checkJSONLength(b); err != nil {
+				return err
+			}
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeJSONIndent(b, indent, newline+indent)
+			writeJSONString(b, k)
+			b.WriteByte(':')
+			if indent != "" {
+				b.WriteByte(' ')
+			}
+			e, _ := v.Get(k)
+			if err := writeJSON(b, e, indent, newline+indent); err != nil {
+				return err
+			}
+		}
+		writeJSONIndent(b, indent, newline)
+		b.WriteByte('}')
+	default:
+		return &typeError{fmt.Sprintf("jsonStringify() can't convert %s to JSON.", typeName(v))}
+	}
+	return nil
+}
+
+// checkJSONLength stops writing arrays and maps past maxResultBytes, they can
+// hold the same array or map many times over and be far bigger as JSON.
+func checkJSONLength(b *bytes.Buffer) error {
+	if b.Len() > maxResultBytes {
+		return &memoryLimitError{fmt.Sprintf("Memory limit exceeded, jsonStringify() result would be over %d bytes.", maxResultBytes)}
+	}
+	return nil
+}
+
+// writeJSONIndent starts a new line, newline holds the indentation of the
+// current level after the line break.
+func writeJSONIndent(b *bytes.Buffer, indent string, newline string) {
+	if indent != "" {
+		b.WriteString(newline)
+	}
+}
+
+// writeJSONString writes s quoted, without escaping the HTML characters
+// json.Marshal would.
+func writeJSONString(b *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	b.Truncate(b.Len() - 1)
+}
@@ -0,0 +1,80 @@
+package vm
+
+import (
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/object"
+	"testing"
+)
+
+func Test_defineJSON(t *testing.T) {
+	const doc = `{"name": "lox", "tags": ["a", "<b>"], "version": 1.5, "ok": true, "none": null, "nested": {}}`
+
+	tests := []struct {
+		source string
+		want   string
+		code   string
+	}{
+		{"print jsonParse(doc);", "{name: lox, tags: [a, <b>], version: 1.5, ok: true, none: nil, nested: {}}\n", ""},
+		{`print get(jsonParse(doc), "version") + 1;`, "2.5\n", ""},
+		{`print get(get(jsonParse(doc), "tags"), 1);`, "<b>\n", ""},
+		{`print get(jsonParse(doc), "missing");`, "nil\n", ""},
+		{`print keys(jsonParse(doc));`, "[name, tags, version, ok, none, nested]\n", ""},
+		{`print length(jsonParse(doc));`, "6\n", ""},
+		{`print jsonParse(" 12 ") + 1;`, "13\n", ""},
+		{`print jsonParse("[3]") + 1;`, "", diagnostic.CodeType},
+		{"print jsonStringify(jsonParse(doc), 0);", `{"name":"lox","tags":["a","<b>"],"version":1.5,"ok":true,"none":null,"nested":{}}` + "\n", ""},
+		{`print jsonStringify(split("a,b", ","), 2);`, "[\n  \"a\",\n  \"b\"\n]\n", ""},
+		{"print jsonStringify(jsonParse(doc), 1) == pretty;", "true\n", ""},
+		{`print jsonStringify("tab	" + toString(nil), 0);`, "\"tab\\tnil\"\n", ""},
+		{"print jsonStringify(1000000, 0) + jsonStringify(0.25, 0);", "10000000.25\n", ""},
+		{`print jsonStringify(jsonParse("[]"), 4);`, "[]\n", ""},
+		{`var m = map(); var tags = array(); push(tags, "a"); set(m, "name", "lox"); set(m, "tags", tags); set(m, "n", 1); print jsonStringify(m, 0);`, `{"name":"lox","tags":["a"],"n":1}` + "\n", ""},
+		{"var a = array(); var b = array(); push(b, a); push(b, a); print jsonStringify(b, 0);", "[[],[]]\n", ""},
+		{"jsonParse(bad);", "", diagnostic.CodeNative},
+		{`jsonParse("[1,");`, "", diagnostic.CodeNative},
+		{`jsonParse("1e400");`, "", diagnostic.CodeNative},
+		{"jsonParse(1);", "", diagnostic.CodeType},
+		{"jsonStringify(nan, 0);", "", diagnostic.CodeNative},
+		{"jsonStringify(clock, 0);", "", diagnostic.CodeType},
+		{"jsonStringify(1, 11);", "", diagnostic.CodeNative},
+		{`keys(split("a", ","));`, "", diagnostic.CodeType},
+		{`get(jsonParse(doc), 0);`, "", diagnostic.CodeType},
+	}
+	for _, tt := range tests {
+		vm := NewVM()
+		vm.DefineConstant("doc", object.ObjString(doc))
+		vm.DefineConstant("pretty", object.ObjString("{\n \"name\": \"lox\",\n \"tags\": [\n  \"a\",\n  \"<b>\"\n ],\n \"version\": 1.5,\n \"ok\": true,\n \"none\": null,\n \"nested\": {}\n}"))
+		vm.DefineConstant("bad", object.ObjString("{\n  \"a\": 1,\n  \"é\": x\n}"))
+		got, code := runNatives(t, vm, tt.source)
+		if got != tt.want || code != tt.code {
+			t.Errorf("%q printed %q with error %q, expected %q with %q", tt.source, got, code, tt.want, tt.code)
+		}
+	}
+}
+
+func Test_defineJSON_memoryLimit(t *testing.T) {
+	vm := NewVM()
+	vm.SetMaxBytes(100)
+	vm.DefineConstant("doc", object.ObjString("[1, 2, 3, 4, 5, 6, 7, 8]"))
+	if _, code := runNatives(t, vm, "var a = jsonParse(doc);"); code != diagnostic.CodeMemoryLimit {
+		t.Errorf("Expected the parsed array to count against the memory limit, got %q", code)
+	}
+}
+
+func Test_parseJSON_position(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"{\n  \"a\": 1,\n  \"é\": x\n}", "jsonParse() failed: invalid character 'x' looking for beginning of value at line 3, column 8."},
+		{"[1,", "jsonParse() failed: unexpected end of JSON input at line 1, column 4."},
+		{"[1] 2", "jsonParse() failed: invalid character '2' after top-level value at line 1, column 5."},
+		{"", "jsonParse() failed: unexpected end of JSON input at line 1, column 1."},
+	}
+	for _, tt := range tests {
+		_, err := parseJSON(tt.text)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("parseJSON(%q) returned %v, expected %q", tt.text, err, tt.want)
+		}
+	}
+}
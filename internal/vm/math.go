@@ -0,0 +1,71 @@
+package vm
+
+import (
+	"github.com/VannRR/golox/internal/value"
+	"math"
+)
+
+var mathFunctions1 = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"asin":  math.Asin,
+	"acos":  math.Acos,
+	"atan":  math.Atan,
+	"exp":   math.Exp,
+	"log":   math.Log,
+	"log2":  math.Log2,
+	"log10": math.Log10,
+}
+
+var mathFunctions2 = map[string]func(float64, float64) float64{
+	"pow":   math.Pow,
+	"min":   math.Min,
+	"max":   math.Max,
+	"atan2": math.Atan2,
+}
+
+// defineMath defines the math natives, which take and return numbers like
+// the Go functions behind them, so sqrt(-1) is nan rather than an error.
+func (vm *VM) defineMath() {
+	for name, fn := range mathFunctions1 {
+		vm.DefineNative(name, 1, func(args []value.Value) (value.Value, error) {
+			x, err := numberArg(name, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return value.NumberVal(fn(x)), nil
+		})
+	}
+	for name, fn := range mathFunctions2 {
+		vm.DefineNative(name, 2, func(args []value.Value) (value.Value, error) {
+			x, err := numberArg(name, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			y, err := numberArg(name, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			return value.NumberVal(fn(x, y)), nil
+		})
+	}
+
+	vm.DefineNative("isNaN", 1, func(args []value.Value) (value.Value, error) {
+		x, err := numberArg("isNaN", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return value.BoolVal(math.IsNaN(x)), nil
+	})
+
+	vm.DefineConstant("pi", value.NumberVal(math.Pi))
+	vm.DefineConstant("e", value.NumberVal(math.E))
+	vm.DefineConstant("inf", value.NumberVal(math.Inf(1)))
+	vm.DefineConstant("nan", value.NumberVal(math.NaN()))
+}
@@ -0,0 +1,56 @@
+package vm
+
+import (
+	"github.com/VannRR/golox/internal/diagnostic"
+	"testing"
+)
+
+func Test_defineMath(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+		code   string
+	}{
+		{"print sqrt(16);", "4\n", ""},
+		{"print pow(2, 10);", "1024\n", ""},
+		{"print abs(-3.5);", "3.5\n", ""},
+		{"print floor(-1.5);", "-2\n", ""},
+		{"print ceil(1.2);", "2\n", ""},
+		{"print round(2.5);", "3\n", ""},
+		{"print round(-2.5);", "-3\n", ""},
+		{"print min(3, -1);", "-1\n", ""},
+		{"print max(3, -1);", "3\n", ""},
+		{"print sin(0) + cos(0) + tan(0);", "1\n", ""},
+		{"print asin(1) * 2 == pi;", "true\n", ""},
+		{"print acos(1) + atan(0) + atan2(0, 1);", "0\n", ""},
+		{"print exp(0) + log(e);", "2\n", ""},
+		{"print log2(8) + log10(1000);", "6\n", ""},
+		{"print pi;", "3.141592653589793\n", ""},
+		{"print e;", "2.718281828459045\n", ""},
+		{"print inf > 1000000 and inf == inf + 1;", "true\n", ""},
+		{"print -inf;", "-Inf\n", ""},
+		{"print nan == nan;", "false\n", ""},
+		{"print isNaN(nan);", "true\n", ""},
+		{"print isNaN(sqrt(-1));", "true\n", ""},
+		{"print isNaN(1);", "false\n", ""},
+		{"var pi = 3; print pi;", "3\n", ""},
+		{"sqrt(\"4\");", "", diagnostic.CodeType},
+		{"pow(2, nil);", "", diagnostic.CodeType},
+		{"isNaN(true);", "", diagnostic.CodeType},
+		{"min(1);", "", diagnostic.CodeArity},
+		{"pi = 3;", "", diagnostic.CodeUndefinedVariable},
+		{"pi();", "", diagnostic.CodeNotCallable},
+	}
+	for _, tt := range tests {
+		got, code := runNatives(t, NewVM(), tt.source)
+		if got != tt.want || code != tt.code {
+			t.Errorf("%q printed %q with error %q, expected %q with %q", tt.source, got, code, tt.want, tt.code)
+		}
+	}
+
+	vm := NewVM()
+	runNatives(t, vm, "pow(2, nil);")
+	if want := "pow() expects a number as argument 2, got nil."; vm.Err().Message != want {
+		t.Errorf("Expected the error %q, got %q", want, vm.Err().Message)
+	}
+}
@@ -0,0 +1,241 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/object"
+	"github.com/VannRR/golox/internal/value"
+	"math"
+)
+
+// DefineNative makes fn callable from scripts as name. Natives act like
+// globals defined before the script starts, a global the script defines with
+// the same name hides the native. fn must not keep its args slice.
+func (vm *VM) DefineNative(name string, arity int, fn object.NativeFn) {
+	vm.builtins[name] = object.NewNative(name, arity, fn)
+}
+
+// defineAccessor defines a native that only reads values out of its
+// arguments, its results aren't charged against the memory limit again.
+func (vm *VM) defineAccessor(name string, arity int, fn object.NativeFn) {
+	vm.builtins[name] = object.NewAccessor(name, arity, fn)
+}
+
+// DefineConstant makes v readable from scripts as name, like a native it can
+// be hidden but not assigned.
+func (vm *VM) DefineConstant(name string, v value.Value) {
+	vm.builtins[name] = v
+}
+
+// SetArgs sets the arguments scripts read from the args array, or with
+// argc() and argv(i). Every run gets an args array of its own, so a script
+// changing it doesn't change what the next run reads.
+func (vm *VM) SetArgs(args []string) {
+	vm.args = args
+}
+
+func argsArray(args []string) *object.ObjArray {
+	elements := make([]value.Value, len(args))
+	for i, arg := range args {
+		elements[i] = object.ObjString(arg)
+	}
+	return object.NewArray(elements)
+}
+
+func (vm *VM) defineArgs() {
+	vm.DefineConstant("args", argsArray(vm.args))
+	vm.DefineNative("argc", 0, func(args []value.Value) (value.Value, error) {
+		return value.NumberVal(len(vm.args)), nil
+	})
+	vm.DefineNative("argv", 1, func(args []value.Value) (value.Value, error) {
+		n, err := integerArg("argv", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || n >= len(vm.args) {
+			return nil, fmt.Errorf("argv() expects an index from 0 to argc() - 1, got %d.", n)
+		}
+		return object.ObjString(vm.args[n]), nil
+	})
+}
+
+func (vm *VM) callNative(native *object.ObjNative, argCount int) InterpretResult {
+	if argCount != native.Arity() {
+		vm.runtimeError(diagnostic.CodeArity, "Expected %d arguments but got %d.", native.Arity(), argCount)
+		return InterpretRuntimeError
+	}
+
+	result, err := native.Call(vm.stack[vm.stackTop-argCount : vm.stackTop])
+	if err != nil && vm.ctx != nil && vm.ctx.Err() != nil && errors.Is(err, vm.ctx.Err()) {
+		vm.runtimeError(diagnostic.CodeCanceled, "Execution canceled: %v.", err)
+		return InterpretCanceled
+	}
+	if err != nil {
+		var typeErr *typeError
+		var memoryErr *memoryLimitError
+		switch {
+		case errors.As(err, &typeErr):
+			vm.runtimeError(diagnostic.CodeType, "%s", err)
+		case errors.As(err, &memoryErr):
+			vm.runtimeError(diagnostic.CodeMemoryLimit, "%s", err)
+			return InterpretMemoryLimit
+		default:
+			vm.runtimeError(diagnostic.CodeNative, "%s", err)
+		}
+		return InterpretRuntimeError
+	}
+	if !native.IsAccessor() {
+		if allocResult := vm.allocate(resultSize(result)); allocResult != InterpretNoResult {
+			return allocResult
+		}
+	}
+
+	vm.stackTop -= argCount + 1
+	vm.stack = vm.stack[:vm.stackTop]
+	return vm.push(result)
+}
+
+// typeError is returned by natives given an argument of the wrong type, it
+// is reported with the same code as the operators' type errors.
+type typeError struct {
+	message string
+}
+
+func (e *typeError) Error() string { return e.message }
+
+// memoryLimitError is returned by natives whose result would go over the
+// memory limit, it is reported like the VM's own allocations.
+type memoryLimitError struct {
+	message string
+}
+
+func (e *memoryLimitError) Error() string { return e.message }
+
+// maxResultBytes bounds a single native result even without a memory limit,
+// so a huge count is a runtime error instead of crashing the host.
+const maxResultBytes = 1 << 30
+
+// reserve checks that a native may allocate size more bytes, natives call it
+// before building results too big to build first and charge afterwards.
+func (vm *VM) reserve(native string, size int) error {
+	if size < 0 || size > maxResultBytes {
+		return &memoryLimitError{fmt.Sprintf("Memory limit exceeded, %s() result would be over %d bytes.", native, maxResultBytes)}
+	}
+	if vm.maxBytes > 0 && size > vm.maxBytes-vm.bytesAllocated {
+		return &memoryLimitError{fmt.Sprintf("Memory limit exceeded, %s() needs %d bytes with %d of %d bytes in use.",
+			native, size, vm.bytesAllocated, vm.maxBytes)}
+	}
+	return nil
+}
+
+// charge reserves size bytes and counts them as allocated, for natives that
+// grow an array or map in place.
+func (vm *VM) charge(native string, size int) error {
+	if err := vm.reserve(native, size); err != nil {
+		return err
+	}
+	vm.bytesAllocated += size
+	return nil
+}
+
+// valueBytes is what a value takes up in an array or map besides what it
+// points to.
+const valueBytes = 16
+
+// resultSize is how many bytes of heap objects a native's result is charged
+// for, arrays and maps include their elements.
+func resultSize(v value.Value) int {
+	switch v.(type) {
+	case *object.ObjArray, *object.ObjMap:
+		return objectSize(v, make(map[value.Value]bool))
+	}
+	return objectSize(v, nil)
+}
+
+// objectSize counts an array or map held more than once only the first time
+// seen meets it.
+func objectSize(v value.Value, seen map[value.Value]bool) int {
+	switch v := v.(type) {
+	case object.ObjString:
+		return len(v)
+	case *object.ObjArray:
+		if seen[v] {
+			return 0
+		}
+		seen[v] = true
+		size := len(v.Elements) * valueBytes
+		for _, e := range v.Elements {
+			size += objectSize(e, seen)
+		}
+		return size
+	case *object.ObjMap:
+		if seen[v] {
+			return 0
+		}
+		seen[v] = true
+		size := 0
+		for _, k := range v.Keys() {
+			e, _ := v.Get(k)
+			size += len(k) + 2*valueBytes + objectSize(e, seen)
+		}
+		return size
+	}
+	return 0
+}
+
+func argumentTypeError(native string, args []value.Value, i int, expected string) error {
+	return &typeError{fmt.Sprintf("%s() expects %s as argument %d, got %s.", native, expected, i+1, typeName(args[i]))}
+}
+
+func typeName(v value.Value) string {
+	switch v.(type) {
+	case value.NilVal:
+		return "nil"
+	case value.BoolVal:
+		return "a bool"
+	case value.NumberVal:
+		return "a number"
+	case object.ObjString:
+		return "a string"
+	case *object.ObjFunction, *object.ObjNative:
+		return "a function"
+	case *object.ObjArray:
+		return "an array"
+	case *object.ObjMap:
+		return "a map"
+	}
+	return "a value"
+}
+
+func numberArg(native string, args []value.Value, i int) (float64, error) {
+	n, ok := args[i].(value.NumberVal)
+	if !ok {
+		return 0, argumentTypeError(native, args, i, "a number")
+	}
+	return float64(n), nil
+}
+
+// maxExactInteger is the largest number whose neighbours are all numbers
+// too, whole number arguments must be within it.
+const maxExactInteger = 1 << 53
+
+func integerArg(native string, args []value.Value, i int) (int, error) {
+	n, ok := args[i].(value.NumberVal)
+	if !ok || float64(n) != math.Trunc(float64(n)) || math.IsInf(float64(n), 0) {
+		return 0, argumentTypeError(native, args, i, "a whole number")
+	}
+	if math.Abs(float64(n)) > maxExactInteger {
+		return 0, fmt.Errorf("%s() expects a whole number from %d to %d as argument %d, got %s.",
+			native, -maxExactInteger, maxExactInteger, i+1, n)
+	}
+	return int(n), nil
+}
+
+func stringArg(native string, args []value.Value, i int) (string, error) {
+	s, ok := args[i].(object.ObjString)
+	if !ok {
+		return "", argumentTypeError(native, args, i, "a string")
+	}
+	return string(s), nil
+}
@@ -0,0 +1,121 @@
+package vm
+
+import (
+	"errors"
+	"github.com/VannRR/golox/internal/debug"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/object"
+	"github.com/VannRR/golox/internal/value"
+	"strings"
+	"testing"
+)
+
+// runNatives runs source on a VM with debug output off and returns what it
+// printed and the code of its runtime error, if any.
+func runNatives(t *testing.T, vm *VM, source string) (string, string) {
+	t.Helper()
+	debug.PrintCode, debug.TraceExecution = false, false
+	var stdout strings.Builder
+	vm.SetOutput(&stdout, &strings.Builder{})
+
+	s := []byte(source)
+	vm.Interpret(&s)
+	if vm.Err() != nil {
+		return stdout.String(), vm.Err().Code
+	}
+	return stdout.String(), ""
+}
+
+func Test_DefineNative(t *testing.T) {
+	vm := NewVM()
+	vm.DefineNative("add", 2, func(args []value.Value) (value.Value, error) {
+		return args[0].(value.NumberVal) + args[1].(value.NumberVal), nil
+	})
+	vm.DefineNative("fail", 0, func(args []value.Value) (value.Value, error) {
+		return nil, errors.New("It failed.")
+	})
+	vm.DefineNative("greet", 0, func(args []value.Value) (value.Value, error) {
+		return object.ObjString("hello"), nil
+	})
+
+	tests := []struct {
+		source string
+		want   string
+		code   string
+	}{
+		{"print add(1, 2);", "3\n", ""},
+		{"fun f() { return add(add(1, 2), 3); } print f();", "6\n", ""},
+		{"print add;", "<native fn add>\n", ""},
+		{"var g = greet; print g() + \"!\";", "hello!\n", ""},
+		{"var add = 1; print add;", "1\n", ""},
+		{"print add(1);", "", diagnostic.CodeArity},
+		{"fail();", "", diagnostic.CodeNative},
+		{"add = 1;", "", diagnostic.CodeUndefinedVariable},
+	}
+	for _, tt := range tests {
+		got, code := runNatives(t, vm, tt.source)
+		if got != tt.want || code != tt.code {
+			t.Errorf("%q printed %q with error %q, expected %q with %q", tt.source, got, code, tt.want, tt.code)
+		}
+	}
+
+	if _, code := runNatives(t, vm, "fail();"); vm.Err().Message != "It failed." || code != diagnostic.CodeNative {
+		t.Errorf("Expected the native's error as the message, got %q", vm.Err().Message)
+	}
+	if vm.stackTop != 0 {
+		t.Errorf("Expected native calls to leave the stack empty, has %d values", vm.stackTop)
+	}
+}
+
+func Test_SetArgs(t *testing.T) {
+	vm := NewVM()
+	if got, _ := runNatives(t, vm, "print argc(); print args;"); got != "0\n[]\n" {
+		t.Errorf("Expected no arguments by default, got %q", got)
+	}
+
+	vm.SetArgs([]string{"one", "two"})
+	tests := []struct {
+		source string
+		want   string
+		code   string
+	}{
+		{"print argc();", "2\n", ""},
+		{"print args;", "[one, two]\n", ""},
+		{"print length(args); print get(args, 1);", "2\ntwo\n", ""},
+		{"args = nil;", "", diagnostic.CodeUndefinedVariable},
+		{`push(args, "three"); print args; print argc();`, "[one, two, three]\n2\n", ""},
+		{`push(args, "three"); print args;`, "[one, two, three]\n", ""},
+		{"for (var i = 0; i < argc(); i = i + 1) print argv(i);", "one\ntwo\n", ""},
+		{"argv(2);", "", diagnostic.CodeNative},
+		{"argv(-1);", "", diagnostic.CodeNative},
+		{"argv(0.5);", "", diagnostic.CodeType},
+		{"argv(pow(10, 300));", "", diagnostic.CodeNative},
+		{"argv(\"0\");", "", diagnostic.CodeType},
+	}
+	for _, tt := range tests {
+		got, code := runNatives(t, vm, tt.source)
+		if got != tt.want || code != tt.code {
+			t.Errorf("%q printed %q with error %q, expected %q with %q", tt.source, got, code, tt.want, tt.code)
+		}
+	}
+}
+
+func Test_integerArg(t *testing.T) {
+	tests := []struct {
+		arg  value.Value
+		want int
+		err  string
+	}{
+		{value.NumberVal(-3), -3, ""},
+		{value.NumberVal(1 << 53), 1 << 53, ""},
+		{value.NumberVal(1<<53 + 2), 0, "f() expects a whole number from -9007199254740992 to 9007199254740992 as argument 1, got 9.007199254740994e+15."},
+		{value.NumberVal(-1e300), 0, "f() expects a whole number from -9007199254740992 to 9007199254740992 as argument 1, got -1e+300."},
+		{value.NumberVal(0.5), 0, "f() expects a whole number as argument 1, got a number."},
+	}
+	for _, tt := range tests {
+		got, err := integerArg("f", []value.Value{tt.arg}, 0)
+		if got != tt.want || (err == nil) != (tt.err == "") || (err != nil && err.Error() != tt.err) {
+			t.Errorf("integerArg(%v) returned %d, %v, expected %d, %q", tt.arg, got, err, tt.want, tt.err)
+		}
+	}
+}
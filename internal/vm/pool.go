@@ -0,0 +1,43 @@
+package vm
+
+import "sync"
+
+// Pool reuses VMs between goroutines. A VM returned by Get belongs to the
+// caller until it is handed back with Put.
+type Pool struct {
+	pool      sync.Pool
+	configure func(*VM)
+}
+
+// NewPool creates a pool whose VMs are passed to configure when they are
+// created and each time they are put back, so limits, natives and file
+// systems set there apply to every VM the pool hands out.
+func NewPool(configure func(*VM)) *Pool {
+	p := &Pool{configure: configure}
+	p.pool.New = func() any {
+		vm := NewVM()
+		p.setUp(vm)
+		return vm
+	}
+	return p
+}
+
+func (p *Pool) setUp(vm *VM) {
+	if p.configure != nil {
+		p.configure(vm)
+	}
+}
+
+func (p *Pool) Get() *VM {
+	return p.pool.Get().(*VM)
+}
+
+// Put resets the VM to how NewVM and configure left it, so the next caller of
+// Get can't observe anything from the previous run: its globals, output,
+// arguments, random state, clock, file system, debug hook, limits and natives
+// are all set up afresh.
+func (p *Pool) Put(vm *VM) {
+	vm.reset()
+	p.setUp(vm)
+	p.pool.Put(vm)
+}
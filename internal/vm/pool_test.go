@@ -0,0 +1,150 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/VannRR/golox/internal/debug"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"github.com/VannRR/golox/internal/value"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func Test_NewPool(t *testing.T) {
+	pool := NewPool(func(vm *VM) {
+		vm.SetMaxInstructions(10)
+	})
+
+	vm := pool.Get()
+
+	if vm.maxInstructions != 10 {
+		t.Errorf("Expected configure to set max instructions to 10, got %d", vm.maxInstructions)
+	}
+}
+
+func Test_Pool_Put(t *testing.T) {
+	pool := NewPool(nil)
+	vm := pool.Get()
+	var out bytes.Buffer
+	vm.SetOutput(&out, &out)
+	source := []byte("var a = 1; { var b = 2; }")
+	vm.Interpret(&source)
+	vm.push(value.NumberVal(1))
+
+	pool.Put(vm)
+
+	if vm.stackTop != 0 || len(vm.stack) != 0 {
+		t.Errorf("Expected empty stack after Put, got %v values", vm.stackTop)
+	}
+	if vm.globals != nil {
+		t.Errorf("Expected globals to be cleared after Put, got %v", vm.globals)
+	}
+	if vm.stdout != os.Stdout || vm.stderr != os.Stderr {
+		t.Errorf("Expected output to be restored after Put")
+	}
+}
+
+func Test_Pool_Put_resets(t *testing.T) {
+	seeded := NewVM()
+	seeded.SetSeed(1)
+	seededRandom, _ := runNatives(t, seeded, "print random();")
+
+	tests := []struct {
+		name   string
+		change func(vm *VM)
+		source string
+		want   string
+		code   string
+	}{
+		{"args", func(vm *VM) { vm.SetArgs([]string{"a", "b"}) }, "print argc(); print args;", "0\n[]\n", ""},
+		{"random state", func(vm *VM) { vm.SetSeed(1) }, "print random() != seeded;", "true\n", ""},
+		{"clock", func(vm *VM) { vm.SetClock(NewFakeClock(time.Unix(0, 0))) }, "print now() > 0;", "true\n", ""},
+		{"file system", func(vm *VM) {
+			vm.SetFileSystem(ReadOnlyFileSystem(fstest.MapFS{"a.txt": {Data: []byte("a")}}))
+		}, `print fileExists("a.txt");`, "", diagnostic.CodeNative},
+		{"debug hook", func(vm *VM) { vm.SetDebugHook(func(*VM) bool { return false }) }, "print 1;", "1\n", ""},
+		{"limits", func(vm *VM) { vm.SetMaxInstructions(1) }, "print 1 + 1;", "2\n", ""},
+		{"natives", func(vm *VM) { vm.DefineConstant("extra", value.NumberVal(1)) }, "print extra;", "", diagnostic.CodeUndefinedVariable},
+		{"memory limit", func(vm *VM) { vm.SetMaxBytes(2) }, `print "abc" + "def";`, "abcdef\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := NewPool(func(vm *VM) {
+				vm.DefineConstant("seeded", parseNumberOutput(t, seededRandom))
+			})
+			vm := pool.Get()
+			tt.change(vm)
+			pool.Put(vm)
+
+			if got, code := runNatives(t, vm, tt.source); got != tt.want || code != tt.code {
+				t.Errorf("%q printed %q with error %q after Put, expected %q with %q", tt.source, got, code, tt.want, tt.code)
+			}
+		})
+	}
+}
+
+// parseNumberOutput converts what print wrote for a number back to one.
+func parseNumberOutput(t *testing.T, output string) value.Value {
+	t.Helper()
+	n, err := strconv.ParseFloat(strings.TrimSpace(output), 64)
+	if err != nil {
+		t.Fatalf("Expected a number, got %q", output)
+	}
+	return value.NumberVal(n)
+}
+
+func Test_Pool_Put_configure(t *testing.T) {
+	pool := NewPool(func(vm *VM) {
+		vm.SetMaxInstructions(10)
+		vm.SetArgs([]string{"x"})
+	})
+	vm := pool.Get()
+	vm.SetMaxInstructions(1_000)
+	vm.SetArgs(nil)
+	pool.Put(vm)
+
+	if vm.maxInstructions != 10 || len(vm.args) != 1 {
+		t.Errorf("Expected configure to be applied again after Put, got %d instructions and args %v", vm.maxInstructions, vm.args)
+	}
+}
+
+func Test_Pool_concurrent(t *testing.T) {
+	printCode, trace := debug.PrintCode, debug.TraceExecution
+	debug.PrintCode, debug.TraceExecution = false, false
+	defer func() { debug.PrintCode, debug.TraceExecution = printCode, trace }()
+
+	source := []byte(`var x = 2; { var y = x * 21; print y; }`)
+	program, ok := Compile(&source)
+	if !ok {
+		t.Fatalf("Expected source to compile")
+	}
+
+	pool := NewPool(func(vm *VM) {
+		vm.SetMaxInstructions(1_000)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 8; j++ {
+				vm := pool.Get()
+				var out bytes.Buffer
+				vm.SetOutput(&out, &out)
+				if result := vm.Run(program); result != InterpretOk {
+					t.Errorf("Expected InterpretOk, got %d", result)
+				}
+				if out.String() != "42\n" {
+					t.Errorf("Expected '42\\n', got %q", out.String())
+				}
+				pool.Put(vm)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,95 @@
+package vm
+
+import (
+	"github.com/VannRR/golox/internal/chunk"
+	"github.com/VannRR/golox/internal/compiler"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"os"
+)
+
+// Program is a compiled script, it is never modified after compilation so it
+// can be run by many VMs concurrently.
+type Program struct {
+	chunk  *chunk.Chunk
+	source []byte
+	file   string
+}
+
+func Compile(source *[]byte) (*Program, bool) {
+	return CompileFile("", source)
+}
+
+// CompileFile is like Compile but names the file the source came from in
+// compile errors and in the tracebacks of runtime errors.
+func CompileFile(file string, source *[]byte) (*Program, bool) {
+	program, diagnostics := CompileFileDiagnostics(file, source)
+	if len(diagnostics) > 0 {
+		diagnostic.NewRenderer(*source, file, diagnostic.IsTerminal(os.Stderr)).RenderAll(os.Stderr, diagnostics)
+		return nil, false
+	}
+	return program, true
+}
+
+// CompileDiagnostics is like Compile but returns the compile errors instead
+// of printing them.
+func CompileDiagnostics(source *[]byte) (*Program, []diagnostic.Diagnostic) {
+	c := chunk.NewChunk()
+
+	if diagnostics := compiler.CompileDiagnostics(source, c); len(diagnostics) > 0 {
+		c.Free()
+		return nil, diagnostics
+	}
+
+	return &Program{chunk: c, source: *source}, nil
+}
+
+// CompileFileDiagnostics is like CompileFile but returns the compile errors
+// instead of printing them.
+func CompileFileDiagnostics(file string, source *[]byte) (*Program, []diagnostic.Diagnostic) {
+	program, diagnostics := CompileDiagnostics(source)
+	if len(diagnostics) > 0 {
+		return nil, diagnostics
+	}
+	program.file = file
+	return program, nil
+}
+
+// CompileExpressionDiagnostics compiles a single expression into a program
+// for RunExpression, returning the compile errors instead of printing them.
+func CompileExpressionDiagnostics(file string, source *[]byte) (*Program, []diagnostic.Diagnostic) {
+	c := chunk.NewChunk()
+
+	if diagnostics := compiler.CompileExpression(source, c, nil); len(diagnostics) > 0 {
+		c.Free()
+		return nil, diagnostics
+	}
+
+	return &Program{chunk: c, source: *source, file: file}, nil
+}
+
+// NewProgram wraps bytecode that didn't come from Compile, such as a chunk
+// built by hand, after checking that it can't crash the VM.
+func NewProgram(c *chunk.Chunk) (*Program, error) {
+	if err := c.Verify(); err != nil {
+		return nil, err
+	}
+	return &Program{chunk: c}, nil
+}
+
+// LoadProgram decodes and verifies a program written by Program.MarshalBinary.
+func LoadProgram(data []byte) (*Program, error) {
+	c := chunk.NewChunk()
+	if err := c.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return NewProgram(c)
+}
+
+// Chunk returns the program's top level bytecode, it must not be modified.
+func (p *Program) Chunk() *chunk.Chunk {
+	return p.chunk
+}
+
+func (p *Program) MarshalBinary() ([]byte, error) {
+	return p.chunk.MarshalBinary()
+}
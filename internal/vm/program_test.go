@@ -0,0 +1,133 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"github.com/VannRR/golox/internal/chunk"
+	"github.com/VannRR/golox/internal/debug"
+	"github.com/VannRR/golox/internal/opcode"
+	"github.com/VannRR/golox/internal/value"
+	"sync"
+	"testing"
+)
+
+func Test_Compile(t *testing.T) {
+	source := []byte("print 1 + 2;")
+
+	program, ok := Compile(&source)
+
+	if !ok || program == nil {
+		t.Fatalf("Expected source to compile")
+	}
+
+	source = []byte("print 1 +;")
+	program, ok = Compile(&source)
+
+	if ok || program != nil {
+		t.Errorf("Expected compile error to return no program")
+	}
+}
+
+func Test_LoadProgram(t *testing.T) {
+	source := []byte(`var s = "a"; s = s + "b"; print s;`)
+	program, ok := Compile(&source)
+	if !ok {
+		t.Fatalf("Expected source to compile")
+	}
+
+	data, err := program.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Expected no error marshaling program, got '%v'", err)
+	}
+
+	loaded, err := LoadProgram(data)
+	if err != nil {
+		t.Fatalf("Expected no error loading program, got '%v'", err)
+	}
+
+	var out bytes.Buffer
+	vm := NewVM()
+	vm.SetOutput(&out, nil)
+	if result := vm.Run(loaded); result != InterpretOk {
+		t.Errorf("Expected InterpretOk, got %d", result)
+	}
+	if out.String() != "ab\n" {
+		t.Errorf("Expected 'ab\\n', got %q", out.String())
+	}
+
+	if _, err := LoadProgram(data[:len(data)-1]); err == nil {
+		t.Errorf("Expected an error loading a truncated program")
+	}
+}
+
+func Test_NewProgram(t *testing.T) {
+	valid := &chunk.Chunk{
+		Code:      []byte{opcode.Constant, 0, opcode.Print, opcode.Return},
+		Constants: []value.Value{value.NumberVal(1)},
+	}
+	if _, err := NewProgram(valid); err != nil {
+		t.Errorf("Expected valid chunk to be accepted, got '%v'", err)
+	}
+
+	invalid := &chunk.Chunk{
+		Code:      []byte{opcode.Constant, 3, opcode.Print, opcode.Return},
+		Constants: []value.Value{value.NumberVal(1)},
+	}
+	program, err := NewProgram(invalid)
+	if err == nil || program != nil {
+		t.Errorf("Expected invalid chunk to be rejected")
+	}
+
+	data, err := invalid.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Expected no error marshaling chunk, got '%v'", err)
+	}
+	var verifyErr *chunk.VerifyError
+	if _, err := LoadProgram(data); !errors.As(err, &verifyErr) {
+		t.Errorf("Expected LoadProgram to return a VerifyError, got '%v'", err)
+	}
+}
+
+func Test_Run_concurrent(t *testing.T) {
+	printCode, trace := debug.PrintCode, debug.TraceExecution
+	debug.PrintCode, debug.TraceExecution = false, false
+	defer func() { debug.PrintCode, debug.TraceExecution = printCode, trace }()
+
+	source := []byte(`
+var total = 0;
+for (var i = 0; i < 100; i = i + 1) total = total + i;
+var s = "";
+{ var n = 0; while (n < 3) { s = s + "ab"; n = n + 1; } }
+print total;
+print s;
+`)
+	program, ok := Compile(&source)
+	if !ok {
+		t.Fatalf("Expected source to compile")
+	}
+
+	const runs = 32
+	outputs := make([]bytes.Buffer, runs)
+	results := make([]InterpretResult, runs)
+
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vm := NewVM()
+			vm.SetOutput(&outputs[i], nil)
+			results[i] = vm.Run(program)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < runs; i++ {
+		if results[i] != InterpretOk {
+			t.Errorf("Expected run %d to be InterpretOk, got %d", i, results[i])
+		}
+		if outputs[i].String() != "4950\nababab\n" {
+			t.Errorf("Expected run %d to print '4950\\nababab\\n', got %q", i, outputs[i].String())
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/VannRR/golox/internal/object"
+	"github.com/VannRR/golox/internal/value"
+	"math/rand/v2"
+)
+
+// randomStringLetters are the characters randomString() picks from.
+const randomStringLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// SetSeed makes the random natives produce the same numbers each time a
+// script runs with seed, VMs are seeded randomly until it is called.
+func (vm *VM) SetSeed(seed uint64) {
+	vm.random = rand.New(rand.NewPCG(seed, seed))
+}
+
+func (vm *VM) defineRandom() {
+	vm.random = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+
+	vm.DefineNative("random", 0, func(args []value.Value) (value.Value, error) {
+		return value.NumberVal(vm.random.Float64()), nil
+	})
+
+	// randomInt returns a whole number from lo to hi, both included.
+	vm.DefineNative("randomInt", 2, func(args []value.Value) (value.Value, error) {
+		lo, err := integerArg("randomInt", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := integerArg("randomInt", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if hi < lo {
+			return nil, fmt.Errorf("randomInt() upper bound %d is less than the lower bound %d.", hi, lo)
+		}
+		return value.NumberVal(int64(lo) + vm.random.Int64N(int64(hi-lo)+1)), nil
+	})
+
+	vm.DefineNative("randomNormal", 2, func(args []value.Value) (value.Value, error) {
+		mean, err := numberArg("randomNormal", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		stddev, err := numberArg("randomNormal", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if !(stddev >= 0) {
+			return nil, fmt.Errorf("randomNormal() standard deviation must not be negative, got %s.", value.NumberVal(stddev))
+		}
+		return value.NumberVal(mean + vm.random.NormFloat64()*stddev), nil
+	})
+
+	// randomString returns n letters and digits.
+	vm.DefineNative("randomString", 1, func(args []value.Value) (value.Value, error) {
+		n, err := integerArg("randomString", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("randomString() length must not be negative, got %d.", n)
+		}
+		// reserve bounds n even without a memory limit, so make can't panic.
+		if err := vm.reserve("randomString", n); err != nil {
+			return nil, err
+		}
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = randomStringLetters[vm.random.IntN(len(randomStringLetters))]
+		}
+		return object.ObjString(b), nil
+	})
+}
@@ -0,0 +1,67 @@
+package vm
+
+import (
+	"github.com/VannRR/golox/internal/diagnostic"
+	"testing"
+)
+
+func Test_defineRandom(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+		code   string
+	}{
+		{"var x = random(); print x >= 0 and x < 1;", "true\n", ""},
+		{"var ok = true; for (var i = 0; i < 100; i = i + 1) { var n = randomInt(-2, 2); ok = ok and n >= -2 and n <= 2 and n == floor(n); } print ok;", "true\n", ""},
+		{"print randomInt(7, 7);", "7\n", ""},
+		{"print randomNormal(3, 0);", "3\n", ""},
+		{"print length(randomString(16));", "16\n", ""},
+		{`print randomString(0) == "";`, "true\n", ""},
+		{"randomInt(2, 1);", "", diagnostic.CodeNative},
+		{"randomInt(0, 0.5);", "", diagnostic.CodeType},
+		{"randomInt(0, pow(2, 60));", "", diagnostic.CodeNative},
+		{"randomNormal(0, -1);", "", diagnostic.CodeNative},
+		{"randomNormal(0, nan);", "", diagnostic.CodeNative},
+		{"randomString(-1);", "", diagnostic.CodeNative},
+		{"randomString(9007199254740992);", "", diagnostic.CodeMemoryLimit},
+		{"randomString(4611686018427387904);", "", diagnostic.CodeNative},
+		{"randomInt(0, pow(10, 300));", "", diagnostic.CodeNative},
+		{"randomString(2000000000);", "", diagnostic.CodeMemoryLimit},
+		{`randomString("1");`, "", diagnostic.CodeType},
+	}
+	for _, tt := range tests {
+		got, code := runNatives(t, NewVM(), tt.source)
+		if got != tt.want || code != tt.code {
+			t.Errorf("%q printed %q with error %q, expected %q with %q", tt.source, got, code, tt.want, tt.code)
+		}
+	}
+}
+
+func Test_defineRandom_memoryLimit(t *testing.T) {
+	vm := NewVM()
+	vm.SetMaxBytes(100)
+	if _, code := runNatives(t, vm, "randomString(1000);"); code != diagnostic.CodeMemoryLimit {
+		t.Errorf("Expected randomString() past the memory limit to fail, got %q", code)
+	}
+}
+
+func Test_VM_SetSeed(t *testing.T) {
+	const source = "print random(); print randomInt(1, 1000000); print randomNormal(0, 1); print randomString(8);"
+
+	run := func(seed uint64) string {
+		vm := NewVM()
+		vm.SetSeed(seed)
+		got, code := runNatives(t, vm, source)
+		if code != "" {
+			t.Fatalf("Expected no error, but got %q", code)
+		}
+		return got
+	}
+
+	if first, second := run(42), run(42); first != second {
+		t.Errorf("Expected the same seed to print the same values, but got %q and %q", first, second)
+	}
+	if first, other := run(42), run(43); first == other {
+		t.Errorf("Expected different seeds to print different values, but both printed %q", first)
+	}
+}
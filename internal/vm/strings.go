@@ -0,0 +1,396 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/VannRR/golox/internal/object"
+	"github.com/VannRR/golox/internal/value"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// defineStrings defines the string natives and the ones that build and read
+// arrays and maps. Lengths and indexes of strings count runes, not bytes, so
+// they agree with what a reader sees in the string.
+func (vm *VM) defineStrings() {
+	vm.DefineNative("length", 1, func(args []value.Value) (value.Value, error) {
+		switch v := args[0].(type) {
+		case object.ObjString:
+			return value.NumberVal(utf8.RuneCountInString(string(v))), nil
+		case *object.ObjArray:
+			return value.NumberVal(len(v.Elements)), nil
+		case *object.ObjMap:
+			return value.NumberVal(v.Len()), nil
+		}
+		return nil, argumentTypeError("length", args, 0, "a string, an array or a map")
+	})
+
+	// get reads an array element by index or a map entry by key, a key that
+	// isn't set reads as nil.
+	vm.defineAccessor("get", 2, func(args []value.Value) (value.Value, error) {
+		if m, ok := args[0].(*object.ObjMap); ok {
+			key, err := stringArg("get", args, 1)
+			if err != nil {
+				return nil, err
+			}
+			if v, ok := m.Get(key); ok {
+				return v, nil
+			}
+			return value.NilVal{}, nil
+		}
+		a, ok := args[0].(*object.ObjArray)
+		if !ok {
+			return nil, argumentTypeError("get", args, 0, "an array or a map")
+		}
+		i, err := integerArg("get", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= len(a.Elements) {
+			return nil, fmt.Errorf("get() index %d is out of range for an array of length %d.", i, len(a.Elements))
+		}
+		return a.Elements[i], nil
+	})
+
+	vm.DefineNative("keys", 1, func(args []value.Value) (value.Value, error) {
+		m, ok := args[0].(*object.ObjMap)
+		if !ok {
+			return nil, argumentTypeError("keys", args, 0, "a map")
+		}
+		keys := make([]value.Value, m.Len())
+		for i, k := range m.Keys() {
+			keys[i] = object.ObjString(k)
+		}
+		return object.NewArray(keys), nil
+	})
+
+	vm.DefineNative("array", 0, func(args []value.Value) (value.Value, error) {
+		return object.NewArray(make([]value.Value, 0)), nil
+	})
+
+	vm.DefineNative("map", 0, func(args []value.Value) (value.Value, error) {
+		return object.NewMap(), nil
+	})
+
+	// push appends to an array and returns its new length.
+	vm.DefineNative("push", 2, func(args []value.Value) (value.Value, error) {
+		a, ok := args[0].(*object.ObjArray)
+		if !ok {
+			return nil, argumentTypeError("push", args, 0, "an array")
+		}
+		if err := checkNotInside("push", a, args[1]); err != nil {
+			return nil, err
+		}
+		if err := vm.charge("push", valueBytes); err != nil {
+			return nil, err
+		}
+		a.Elements = append(a.Elements, args[1])
+		return value.NumberVal(len(a.Elements)), nil
+	})
+
+	// set writes an array element by index or a map entry by key, the index
+	// has to be in range but a key is added when it isn't set.
+	vm.DefineNative("set", 3, func(args []value.Value) (value.Value, error) {
+		if m, ok := args[0].(*object.ObjMap); ok {
+			key, err := stringArg("set", args, 1)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkNotInside("set", m, args[2]); err != nil {
+				return nil, err
+			}
+			if _, ok := m.Get(key); !ok {
+				if err := vm.charge("set", len(key)+2*valueBytes); err != nil {
+					return nil, err
+				}
+			}
+			m.Set(key, args[2])
+			return value.NilVal{}, nil
+		}
+		a, ok := args[0].(*object.ObjArray)
+		if !ok {
+			return nil, argumentTypeError("set", args, 0, "an array or a map")
+		}
+		i, err := integerArg("set", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= len(a.Elements) {
+			return nil, fmt.Errorf("set() index %d is out of range for an array of length %d.", i, len(a.Elements))
+		}
+		if err := checkNotInside("set", a, args[2]); err != nil {
+			return nil, err
+		}
+		a.Elements[i] = args[2]
+		return value.NilVal{}, nil
+	})
+
+	// remove deletes a map entry and returns whether it was set.
+	vm.DefineNative("remove", 2, func(args []value.Value) (value.Value, error) {
+		m, ok := args[0].(*object.ObjMap)
+		if !ok {
+			return nil, argumentTypeError("remove", args, 0, "a map")
+		}
+		key, err := stringArg("remove", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return value.BoolVal(m.Delete(key)), nil
+	})
+
+	vm.DefineNative("substring", 3, func(args []value.Value) (value.Value, error) {
+		s, err := stringArg("substring", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		start, err := integerArg("substring", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		end, err := integerArg("substring", args, 2)
+		if err != nil {
+			return nil, err
+		}
+		runes := []rune(s)
+		if start < 0 || end < start || end > len(runes) {
+			return nil, fmt.Errorf("substring() range %d to %d is out of range for a string of length %d.", start, end, len(runes))
+		}
+		return object.ObjString(runes[start:end]), nil
+	})
+
+	vm.DefineNative("indexOf", 2, func(args []value.Value) (value.Value, error) {
+		s, sub, err := stringArgs2("indexOf", args)
+		if err != nil {
+			return nil, err
+		}
+		i := strings.Index(s, sub)
+		if i < 0 {
+			return value.NumberVal(-1), nil
+		}
+		return value.NumberVal(utf8.RuneCountInString(s[:i])), nil
+	})
+
+	predicates := map[string]func(string, string) bool{
+		"contains":   strings.Contains,
+		"startsWith": strings.HasPrefix,
+		"endsWith":   strings.HasSuffix,
+	}
+	for name, fn := range predicates {
+		vm.DefineNative(name, 2, func(args []value.Value) (value.Value, error) {
+			s, sub, err := stringArgs2(name, args)
+			if err != nil {
+				return nil, err
+			}
+			return value.BoolVal(fn(s, sub)), nil
+		})
+	}
+
+	vm.DefineNative("split", 2, func(args []value.Value) (value.Value, error) {
+		s, sep, err := stringArgs2("split", args)
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.Split(s, sep)
+		elements := make([]value.Value, len(parts))
+		for i, part := range parts {
+			elements[i] = object.ObjString(part)
+		}
+		return object.NewArray(elements), nil
+	})
+
+	vm.DefineNative("join", 2, func(args []value.Value) (value.Value, error) {
+		a, ok := args[0].(*object.ObjArray)
+		if !ok {
+			return nil, argumentTypeError("join", args, 0, "an array")
+		}
+		sep, err := stringArg("join", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		parts := make([]string, len(a.Elements))
+		size := max(len(a.Elements)-1, 0) * len(sep)
+		for i, e := range a.Elements {
+			s, ok := e.(object.ObjString)
+			if !ok {
+				return nil, &typeError{fmt.Sprintf("join() expects an array of strings, element %d is %s.", i, typeName(e))}
+			}
+			parts[i] = string(s)
+			size += len(s)
+		}
+		if err := vm.reserve("join", size); err != nil {
+			return nil, err
+		}
+		return object.ObjString(strings.Join(parts, sep)), nil
+	})
+
+	transforms := map[string]func(string) string{
+		"trim":  strings.TrimSpace,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+	for name, fn := range transforms {
+		vm.DefineNative(name, 1, func(args []value.Value) (value.Value, error) {
+			s, err := stringArg(name, args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return object.ObjString(fn(s)), nil
+		})
+	}
+
+	vm.DefineNative("replace", 3, func(args []value.Value) (value.Value, error) {
+		s, old, err := stringArgs2("replace", args)
+		if err != nil {
+			return nil, err
+		}
+		replacement, err := stringArg("replace", args, 2)
+		if err != nil {
+			return nil, err
+		}
+		size := len(s)
+		if n := strings.Count(s, old); len(replacement) > len(old) {
+			size += n * (len(replacement) - len(old))
+		}
+		if err := vm.reserve("replace", size); err != nil {
+			return nil, err
+		}
+		return object.ObjString(strings.ReplaceAll(s, old, replacement)), nil
+	})
+
+	vm.DefineNative("repeat", 2, func(args []value.Value) (value.Value, error) {
+		s, err := stringArg("repeat", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		n, err := integerArg("repeat", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("repeat() count must not be negative, got %d.", n)
+		}
+		// Checked by dividing, len(s)*n can overflow.
+		size := maxResultBytes + 1
+		if len(s) == 0 || n <= maxResultBytes/len(s) {
+			size = len(s) * n
+		}
+		if err := vm.reserve("repeat", size); err != nil {
+			return nil, err
+		}
+		return object.ObjString(strings.Repeat(s, n)), nil
+	})
+
+	vm.DefineNative("charCode", 2, func(args []value.Value) (value.Value, error) {
+		s, err := stringArg("charCode", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		i, err := integerArg("charCode", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		runes := []rune(s)
+		if i < 0 || i >= len(runes) {
+			return nil, fmt.Errorf("charCode() index %d is out of range for a string of length %d.", i, len(runes))
+		}
+		return value.NumberVal(runes[i]), nil
+	})
+
+	vm.DefineNative("fromCharCode", 1, func(args []value.Value) (value.Value, error) {
+		code, err := integerArg("fromCharCode", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if code < 0 || code > utf8.MaxRune || !utf8.ValidRune(rune(code)) {
+			return nil, fmt.Errorf("fromCharCode() expects a Unicode code point, got %d.", code)
+		}
+		return object.ObjString(rune(code)), nil
+	})
+
+	vm.DefineNative("parseNumber", 1, func(args []value.Value) (value.Value, error) {
+		s, err := stringArg("parseNumber", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return value.NilVal{}, nil
+		}
+		return value.NumberVal(n), nil
+	})
+
+	vm.DefineNative("formatNumber", 2, func(args []value.Value) (value.Value, error) {
+		n, err := numberArg("formatNumber", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		digits, err := integerArg("formatNumber", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if digits < 0 || digits > 100 {
+			return nil, fmt.Errorf("formatNumber() digits must be from 0 to 100, got %d.", digits)
+		}
+		return object.ObjString(strconv.FormatFloat(n, 'f', digits, 64)), nil
+	})
+
+	vm.DefineNative("toString", 1, func(args []value.Value) (value.Value, error) {
+		return object.ObjString(args[0].String()), nil
+	})
+}
+
+func stringArgs2(native string, args []value.Value) (string, string, error) {
+	a, err := stringArg(native, args, 0)
+	if err != nil {
+		return "", "", err
+	}
+	b, err := stringArg(native, args, 1)
+	if err != nil {
+		return "", "", err
+	}
+	return a, b, nil
+}
+
+// checkNotInside stops v from being put inside container when container is v
+// or is inside it, so arrays and maps never hold themselves.
+func checkNotInside(native string, container value.Value, v value.Value) error {
+	if holds(v, container, make(map[value.Value]bool)) {
+		return fmt.Errorf("%s() can't put %s inside itself.", native, typeName(container))
+	}
+	return nil
+}
+
+// holds reports whether v is target or holds it, seen keeps arrays and maps
+// held more than once from being searched again.
+func holds(v value.Value, target value.Value, seen map[value.Value]bool) bool {
+	switch v := v.(type) {
+	case *object.ObjArray:
+		if v == target {
+			return true
+		}
+		if seen[v] {
+			return false
+		}
+		seen[v] = true
+		for _, e := range v.Elements {
+			if holds(e, target, seen) {
+				return true
+			}
+		}
+	case *object.ObjMap:
+		if v == target {
+			return true
+		}
+		if seen[v] {
+			return false
+		}
+		seen[v] = true
+		for _, k := range v.Keys() {
+			e, _ := v.Get(k)
+			if holds(e, target, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
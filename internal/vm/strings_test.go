@@ -0,0 +1,110 @@
+package vm
+
+import (
+	"github.com/VannRR/golox/internal/diagnostic"
+	"testing"
+)
+
+func Test_defineStrings(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+		code   string
+	}{
+		{`print length("héllo");`, "5\n", ""},
+		{`print length(split("a,b", ","));`, "2\n", ""},
+		{`print substring("héllo", 1, 3);`, "él\n", ""},
+		{`print substring("abc", 3, 3) == "";`, "true\n", ""},
+		{`print indexOf("héllo", "l");`, "2\n", ""},
+		{`print indexOf("abc", "z");`, "-1\n", ""},
+		{`print contains("abc", "bc");`, "true\n", ""},
+		{`print startsWith("abc", "ab") and !startsWith("abc", "b");`, "true\n", ""},
+		{`print endsWith("abc", "bc");`, "true\n", ""},
+		{`print split("a,b,,c", ",");`, "[a, b, , c]\n", ""},
+		{`print split("hé", "");`, "[h, é]\n", ""},
+		{`print get(split("a b", " "), 1);`, "b\n", ""},
+		{`print join(split("a b c", " "), "-");`, "a-b-c\n", ""},
+		{`print "[" + trim("  a b  ") + "]";`, "[a b]\n", ""},
+		{`print upper("héllo") + lower("ABC");`, "HÉLLOabc\n", ""},
+		{`print replace("a-b-c", "-", "+");`, "a+b+c\n", ""},
+		{`print repeat("ab", 3);`, "ababab\n", ""},
+		{`print repeat("ab", 0) == "";`, "true\n", ""},
+		{`print charCode("aé", 1);`, "233\n", ""},
+		{`print fromCharCode(233) + fromCharCode(65);`, "éA\n", ""},
+		{`print parseNumber(" 3.5 ") + 1;`, "4.5\n", ""},
+		{`print parseNumber("1e3");`, "1000\n", ""},
+		{`print parseNumber("abc");`, "nil\n", ""},
+		{`print formatNumber(pi, 2);`, "3.14\n", ""},
+		{`print formatNumber(2, 0);`, "2\n", ""},
+		{`print toString(12) + toString(true) + toString(nil);`, "12truenil\n", ""},
+		{`length(1);`, "", diagnostic.CodeType},
+		{`substring("abc", 2, 1);`, "", diagnostic.CodeNative},
+		{`substring("abc", 0, 4);`, "", diagnostic.CodeNative},
+		{`substring("abc", 0.5, 1);`, "", diagnostic.CodeType},
+		{`get(split("a", ","), 1);`, "", diagnostic.CodeNative},
+		{`get("a", 0);`, "", diagnostic.CodeType},
+		{`contains("a", 1);`, "", diagnostic.CodeType},
+		{`join("a", ",");`, "", diagnostic.CodeType},
+		{`join(split("a", ","), 1);`, "", diagnostic.CodeType},
+		{"var a = array(); print push(a, 1); print push(a, nil); print a;", "1\n2\n[1, nil]\n", ""},
+		{`var a = array(); push(a, "x"); set(a, 0, "y"); print a;`, "[y]\n", ""},
+		{`var m = map(); set(m, "b", 1); set(m, "a", 2); set(m, "b", 3); print m;`, "{b: 3, a: 2}\n", ""},
+		{`var m = map(); set(m, "a", 1); print remove(m, "a"); print remove(m, "a"); print length(m);`, "true\nfalse\n0\n", ""},
+		{"var a = array(); var b = array(); push(b, a); push(a, 1); print b;", "[[1]]\n", ""},
+		{"var a = array(); var b = array(); push(b, a); push(b, a); print b;", "[[], []]\n", ""},
+		{"var a = array(); for (var i = 0; i < 60; i = i + 1) { var b = array(); push(b, a); push(b, a); a = b; } print length(get(a, 0));", "2\n", ""},
+		{"var a = array(); push(a, a);", "", diagnostic.CodeNative},
+		{"var a = array(); var b = array(); push(b, a); push(a, b);", "", diagnostic.CodeNative},
+		{`var m = map(); var a = array(); push(a, m); set(m, "a", a);`, "", diagnostic.CodeNative},
+		{"var a = array(); push(a, 1); set(a, 0, a);", "", diagnostic.CodeNative},
+		{"set(array(), 0, 1);", "", diagnostic.CodeNative},
+		{`set(array(), "0", 1);`, "", diagnostic.CodeType},
+		{`set(map(), 0, 1);`, "", diagnostic.CodeType},
+		{`push("a", 1);`, "", diagnostic.CodeType},
+		{`remove(array(), "a");`, "", diagnostic.CodeType},
+		{`repeat("a", -1);`, "", diagnostic.CodeNative},
+		{`repeat("ab", 9007199254740992);`, "", diagnostic.CodeMemoryLimit},
+		{`repeat("ab", pow(10, 300));`, "", diagnostic.CodeNative},
+		{`repeat("ab", -pow(10, 300));`, "", diagnostic.CodeNative},
+		{`repeat("a", 2000000000);`, "", diagnostic.CodeMemoryLimit},
+		{`print length(repeat("", 9007199254740992));`, "0\n", ""},
+		{`charCode("", 0);`, "", diagnostic.CodeNative},
+		{`fromCharCode(-1);`, "", diagnostic.CodeNative},
+		{`formatNumber(1, -1);`, "", diagnostic.CodeNative},
+		{`print split("a", ",") + split("b", ",");`, "", diagnostic.CodeType},
+	}
+	for _, tt := range tests {
+		got, code := runNatives(t, NewVM(), tt.source)
+		if got != tt.want || code != tt.code {
+			t.Errorf("%q printed %q with error %q, expected %q with %q", tt.source, got, code, tt.want, tt.code)
+		}
+	}
+}
+
+func Test_defineStrings_memoryLimit(t *testing.T) {
+	tests := []string{
+		`repeat("ab", 1000);`,
+		`var a = repeat("ab", 40); var b = a + a;`,
+		`var a = repeat("ab", 30); var b = split(a, "");`,
+		`var a = repeat("ab", 30); var b = join(split(a, "b"), a);`,
+		`var a = repeat("a", 30); var b = replace(a, "a", "bbb");`,
+		`var a = array(); while (true) push(a, 1);`,
+		`var m = map(); var i = 0; while (true) { set(m, toString(i), i); i = i + 1; }`,
+	}
+	for _, source := range tests {
+		vm := NewVM()
+		vm.SetMaxBytes(100)
+		if _, code := runNatives(t, vm, source); code != diagnostic.CodeMemoryLimit {
+			t.Errorf("Expected %q to go over the memory limit, got %q", source, code)
+		}
+	}
+}
+
+func Test_get_notCharged(t *testing.T) {
+	vm := NewVM()
+	vm.SetMaxBytes(1_000_000)
+	source := `var a = split(repeat("x", 1000), ","); var i = 0; while (i < 2000) { var s = get(a, 0); i = i + 1; } print i;`
+	if got, code := runNatives(t, vm, source); got != "2000\n" || code != "" {
+		t.Errorf("Expected reading an element 2000 times to stay under the memory limit, got %q with %q", got, code)
+	}
+}
@@ -0,0 +1,195 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"github.com/VannRR/golox/internal/object"
+	"github.com/VannRR/golox/internal/value"
+	"math"
+	"sync"
+	"time"
+)
+
+// Clock is where the time natives get the time and how sleep() waits. Dates
+// are formatted and parsed in the time zone of the times Now returns.
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for d, or returns ctx's error if it is done first.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// SetClock sets the clock scripts read, nil means the system clock.
+func (vm *VM) SetClock(clock Clock) {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	vm.clock = clock
+	vm.clockStart = clock.Now()
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FakeClock is a Clock that only moves when a script sleeps or Advance is
+// called, so tests of time dependent scripts are deterministic.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.Advance(d)
+	return nil
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// dateLayouts are names for common layouts, anything else is used as a Go
+// time layout.
+var dateLayouts = map[string]string{
+	"RFC3339":  time.RFC3339,
+	"DateTime": time.DateTime,
+	"DateOnly": time.DateOnly,
+	"TimeOnly": time.TimeOnly,
+}
+
+// maxTimestamp is the furthest from the epoch formatDate goes, the same
+// range as a JavaScript Date.
+const maxTimestamp = 8.64e15
+
+func dateLayout(layout string) string {
+	if named, ok := dateLayouts[layout]; ok {
+		return named
+	}
+	return layout
+}
+
+// defineTime defines the time natives. Timestamps are milliseconds since the
+// Unix epoch and durations are milliseconds, so they can be added together.
+func (vm *VM) defineTime() {
+	vm.DefineNative("clock", 0, func(args []value.Value) (value.Value, error) {
+		return value.NumberVal(vm.clock.Now().Sub(vm.clockStart).Seconds()), nil
+	})
+
+	vm.DefineNative("now", 0, func(args []value.Value) (value.Value, error) {
+		return value.NumberVal(float64(vm.clock.Now().UnixMicro()) / 1000), nil
+	})
+
+	vm.DefineNative("sleep", 1, func(args []value.Value) (value.Value, error) {
+		ms, err := numberArg("sleep", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if !(ms >= 0) {
+			return nil, fmt.Errorf("sleep() expects a duration that isn't negative, got %s.", args[0])
+		}
+		ctx := vm.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		d, err := milliseconds("sleep", ms)
+		if err != nil {
+			return nil, err
+		}
+		if err := vm.clock.Sleep(ctx, d); err != nil {
+			return nil, err
+		}
+		return value.NilVal{}, nil
+	})
+
+	vm.DefineNative("formatDate", 2, func(args []value.Value) (value.Value, error) {
+		ms, err := numberArg("formatDate", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		layout, err := stringArg("formatDate", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if !(math.Abs(ms) <= maxTimestamp) {
+			return nil, fmt.Errorf("formatDate() expects a timestamp within %g milliseconds of the epoch, got %s.", maxTimestamp, args[0])
+		}
+		t := time.UnixMicro(int64(ms * 1000)).In(vm.clock.Now().Location())
+		return object.ObjString(t.Format(dateLayout(layout))), nil
+	})
+
+	vm.DefineNative("parseDate", 2, func(args []value.Value) (value.Value, error) {
+		text, layout, err := stringArgs2("parseDate", args)
+		if err != nil {
+			return nil, err
+		}
+		t, err := time.ParseInLocation(dateLayout(layout), text, vm.clock.Now().Location())
+		if err != nil {
+			return value.NilVal{}, nil
+		}
+		return value.NumberVal(float64(t.UnixMicro()) / 1000), nil
+	})
+
+	vm.DefineNative("duration", 1, func(args []value.Value) (value.Value, error) {
+		text, err := stringArg("duration", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return value.NilVal{}, nil
+		}
+		return value.NumberVal(float64(d.Microseconds()) / 1000), nil
+	})
+
+	vm.DefineNative("formatDuration", 1, func(args []value.Value) (value.Value, error) {
+		ms, err := numberArg("formatDuration", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		d, err := milliseconds("formatDuration", ms)
+		if err != nil {
+			return nil, err
+		}
+		return object.ObjString(d.String()), nil
+	})
+}
+
+// milliseconds converts ms to a Duration, clamping it to the longest one. NaN
+// is no duration at all and is an error.
+func milliseconds(native string, ms float64) (time.Duration, error) {
+	if math.IsNaN(ms) {
+		return 0, fmt.Errorf("%s() expects a duration, got nan.", native)
+	}
+	if d := ms * float64(time.Millisecond); math.Abs(d) < math.MaxInt64 {
+		return time.Duration(d), nil
+	}
+	if ms < 0 {
+		return math.MinInt64, nil
+	}
+	return math.MaxInt64, nil
+}
@@ -0,0 +1,91 @@
+package vm
+
+import (
+	"context"
+	"github.com/VannRR/golox/internal/diagnostic"
+	"testing"
+	"time"
+)
+
+func Test_defineTime(t *testing.T) {
+	start := time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		source string
+		want   string
+		code   string
+	}{
+		{"print clock();", "0\n", ""},
+		{"sleep(1500); print clock();", "1.5\n", ""},
+		{"print formatNumber(now(), 0);", "1709649000000\n", ""},
+		{"var t = now(); sleep(250); print now() - t;", "250\n", ""},
+		{`print formatDate(now(), "RFC3339");`, "2024-03-05T14:30:00Z\n", ""},
+		{`print formatDate(now() + duration("36h"), "DateOnly");`, "2024-03-07\n", ""},
+		{`print formatDate(0, "2006/01/02 15:04");`, "1970/01/01 00:00\n", ""},
+		{`print parseDate("2024-03-05 14:30:00", "DateTime") == now();`, "true\n", ""},
+		{`print formatNumber(parseDate("5 Mar 2024", "2 Jan 2006"), 0);`, "1709596800000\n", ""},
+		{`print parseDate("not a date", "DateOnly");`, "nil\n", ""},
+		{`print duration("1m30s");`, "90000\n", ""},
+		{`print duration("1.5ms");`, "1.5\n", ""},
+		{`print duration("soon");`, "nil\n", ""},
+		{`print formatDuration(90000);`, "1m30s\n", ""},
+		{`print formatDuration(duration("2h") + 1);`, "2h0m0.001s\n", ""},
+		{"sleep(-1);", "", diagnostic.CodeNative},
+		{"sleep(nan);", "", diagnostic.CodeNative},
+		{`sleep("1");`, "", diagnostic.CodeType},
+		{`formatDate(now(), 1);`, "", diagnostic.CodeType},
+		{`formatDate(0/0, "RFC3339");`, "", diagnostic.CodeNative},
+		{`formatDate(inf, "RFC3339");`, "", diagnostic.CodeNative},
+		{`formatDate(-100000000000000000, "RFC3339");`, "", diagnostic.CodeNative},
+		{`print formatDate(-8640000000000000, "DateOnly");`, "-271821-04-20\n", ""},
+		{"formatDuration(nan);", "", diagnostic.CodeNative},
+		{"print formatDuration(inf);", "2562047h47m16.854775807s\n", ""},
+	}
+	for _, tt := range tests {
+		vm := NewVM()
+		vm.SetClock(NewFakeClock(start))
+		got, code := runNatives(t, vm, tt.source)
+		if got != tt.want || code != tt.code {
+			t.Errorf("%q printed %q with error %q, expected %q with %q", tt.source, got, code, tt.want, tt.code)
+		}
+	}
+}
+
+func Test_SetClock(t *testing.T) {
+	vm := NewVM()
+	clock := NewFakeClock(time.Unix(100, 0).UTC())
+	vm.SetClock(clock)
+	clock.Advance(2 * time.Second)
+	if got, _ := runNatives(t, vm, "print clock(); print now();"); got != "0\n102000\n" {
+		t.Errorf("Expected the fake clock's time, got %q", got)
+	}
+
+	clock.Advance(3 * time.Second)
+	if got, _ := runNatives(t, vm, "sleep(500); print clock();"); got != "0.5\n" {
+		t.Errorf("Expected clock() to count from the start of the run, got %q", got)
+	}
+
+	vm.SetClock(nil)
+	if got, _ := runNatives(t, vm, "print now() > 1700000000000;"); got != "true\n" {
+		t.Errorf("Expected SetClock(nil) to go back to the system clock, got %q", got)
+	}
+}
+
+func Test_sleep_canceled(t *testing.T) {
+	vm := NewVM()
+	runNatives(t, vm, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	s := []byte("sleep(60000);")
+	begin := time.Now()
+	if result := vm.InterpretContext(ctx, &s); result != InterpretCanceled {
+		t.Errorf("Expected a canceled sleep to return InterpretCanceled, got %d", result)
+	}
+	if vm.Err() == nil || vm.Err().Code != diagnostic.CodeCanceled {
+		t.Errorf("Expected a cancellation error, got %v", vm.Err())
+	}
+	if elapsed := time.Since(begin); elapsed > 5*time.Second {
+		t.Errorf("Expected sleep to stop when canceled, took %v", elapsed)
+	}
+}
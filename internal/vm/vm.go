@@ -1,15 +1,28 @@
+// Package vm executes compiled Lox bytecode.
+//
+// A VM holds mutable execution state and must only be used by one goroutine
+// at a time. A Program is immutable once compiled and can be shared by any
+// number of VMs running concurrently, and a Pool is safe for concurrent use.
+// The debug package's PrintCode and TraceExecution flags are read by every VM
+// and must not be changed while VMs are running.
 package vm
 
 import (
+	"context"
 	"fmt"
 	"github.com/VannRR/golox/internal/chunk"
 	"github.com/VannRR/golox/internal/common"
-	"github.com/VannRR/golox/internal/compiler"
 	"github.com/VannRR/golox/internal/debug"
+	"github.com/VannRR/golox/internal/diagnostic"
 	"github.com/VannRR/golox/internal/object"
 	"github.com/VannRR/golox/internal/opcode"
 	"github.com/VannRR/golox/internal/value"
+	"io"
+	"math"
+	"math/rand/v2"
 	"os"
+	"sort"
+	"time"
 )
 
 type InterpretResult = uint8
@@ -19,26 +32,176 @@ const (
 	InterpretCompileError
 	InterpretRuntimeError
 	InterpretNoResult
+	InterpretCanceled
+	InterpretInstructionLimit
+	InterpretStackOverflow
+	InterpretMemoryLimit
 )
 
-type VM struct {
-	stack    []value.Value
+const cancelCheckInterval = 1024
+
+const defaultMaxCallDepth = 1024
+
+// CallFrame is a function call in progress. The running frame's ip lives in
+// VM.ip, the ip stored here is only up to date for the frames below it.
+type CallFrame struct {
+	function *object.ObjFunction
 	chunk    *chunk.Chunk
 	ip       int
-	stackTop int
-	globals  map[string]value.Value
+	slots    int
+}
+
+type VM struct {
+	stack            []value.Value
+	chunk            *chunk.Chunk
+	ip               int
+	slots            int
+	stackTop         int
+	frames           []CallFrame
+	maxCallDepth     int
+	globals          map[string]value.Value
+	builtins         map[string]value.Value
+	args             []string
+	fs               FileSystem
+	clock            Clock
+	clockStart       time.Time
+	random           *rand.Rand
+	ctx              context.Context
+	instructionCount int
+	maxInstructions  int
+	maxStackDepth    int
+	bytesAllocated   int
+	maxBytes         int
+	stdout           io.Writer
+	stderr           io.Writer
+	source           []byte
+	file             string
+	err              *RuntimeError
+	hook             DebugHook
+	baseFrame        int
+	evaluating       bool
+}
+
+// RuntimeError describes why the most recent run stopped early, Trace lists
+// the calls that were active with the innermost first.
+type RuntimeError struct {
+	diagnostic.Diagnostic
+	Trace []TraceFrame
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Span.Line, e.Span.Column, e.Message)
+}
+
+// TraceFrame is one call in a RuntimeError's traceback, Function is empty for
+// the top level of the script.
+type TraceFrame struct {
+	Function string
+	File     string
+	Line     int
+	Column   int
+}
+
+func (f TraceFrame) String() string {
+	location := "line"
+	if f.File != "" {
+		location = f.File + " line"
+	}
+	function := "script"
+	if f.Function != "" {
+		function = f.Function + "()"
+	}
+	return fmt.Sprintf("[%s %d:%d] in %s", location, f.Line, f.Column, function)
 }
 
 func NewVM() *VM {
-	return &VM{
-		stack: make([]value.Value, 0),
+	vm := &VM{
+		stack:         make([]value.Value, 0),
+		frames:        make([]CallFrame, 0),
+		maxStackDepth: common.Uint24Max,
+		maxCallDepth:  defaultMaxCallDepth,
+		stdout:        os.Stdout,
+		stderr:        os.Stderr,
 	}
+	vm.defineBuiltins()
+	return vm
+}
+
+// defineBuiltins defines the natives and constants every VM starts with,
+// forgetting any others.
+func (vm *VM) defineBuiltins() {
+	vm.builtins = make(map[string]value.Value)
+	vm.defineArgs()
+	vm.defineMath()
+	vm.defineStrings()
+	vm.defineFiles()
+	vm.defineTime()
+	vm.defineJSON()
+	vm.defineRandom()
+	vm.SetClock(nil)
+}
+
+// SetOutput redirects what the script prints to stdout and runtime errors to
+// stderr, a nil writer leaves that output unchanged.
+func (vm *VM) SetOutput(stdout io.Writer, stderr io.Writer) {
+	if stdout != nil {
+		vm.stdout = stdout
+	}
+	if stderr != nil {
+		vm.stderr = stderr
+	}
+}
+
+// SetMaxInstructions limits how many instructions a single call to Interpret
+// may execute, zero means no limit.
+func (vm *VM) SetMaxInstructions(max int) {
+	vm.maxInstructions = max
+}
+
+// SetMaxStackDepth limits how many values the VM stack may hold, it can't be
+// raised above the default of common.Uint24Max.
+func (vm *VM) SetMaxStackDepth(max int) {
+	if max <= 0 || max > common.Uint24Max {
+		max = common.Uint24Max
+	}
+	vm.maxStackDepth = max
+}
+
+// SetMaxCallDepth limits how many function calls may be active at once,
+// zero or less restores the default of defaultMaxCallDepth.
+func (vm *VM) SetMaxCallDepth(max int) {
+	if max <= 0 {
+		max = defaultMaxCallDepth
+	}
+	vm.maxCallDepth = max
+}
+
+// SetMaxBytes limits how many bytes of heap objects a single call to
+// Interpret may allocate, zero means no limit.
+func (vm *VM) SetMaxBytes(max int) {
+	vm.maxBytes = max
+}
+
+// BytesAllocated reports how many bytes of heap objects the current or most
+// recent call to Interpret has allocated.
+func (vm *VM) BytesAllocated() int {
+	return vm.bytesAllocated
+}
+
+func (vm *VM) allocate(size int) InterpretResult {
+	if vm.maxBytes > 0 && vm.bytesAllocated+size > vm.maxBytes {
+		vm.runtimeError(diagnostic.CodeMemoryLimit, "Memory limit exceeded, tried to allocate %d bytes with %d of %d bytes in use.",
+			size, vm.bytesAllocated, vm.maxBytes)
+		return InterpretMemoryLimit
+	}
+	vm.bytesAllocated += size
+	return InterpretNoResult
 }
 
 func (vm *VM) push(value value.Value) InterpretResult {
-	if vm.stackTop >= common.Uint24Max {
-		vm.runtimeError("Stack overflow, tried to push with %v values on stack.", common.Uint24Max)
-		return InterpretRuntimeError
+	if vm.stackTop >= vm.maxStackDepth {
+		vm.runtimeError(diagnostic.CodeStackOverflow, "Stack overflow, tried to push with %v values on stack.", vm.stackTop)
+		return InterpretStackOverflow
 	}
 
 	vm.stack = append(vm.stack, value)
@@ -48,7 +211,7 @@ func (vm *VM) push(value value.Value) InterpretResult {
 
 func (vm *VM) pop() (value.Value, InterpretResult) {
 	if vm.stackTop < 1 {
-		vm.runtimeError("Stack underflow, tried to pop with no values on stack.")
+		vm.runtimeError(diagnostic.CodeInvalidProgram, "Stack underflow, tried to pop with no values on stack.")
 		return value.NilVal{}, InterpretRuntimeError
 	}
 	vm.stackTop--
@@ -62,25 +225,156 @@ func (vm *VM) peek(distance int) value.Value {
 }
 
 func (vm *VM) Interpret(source *[]byte) InterpretResult {
-	c := chunk.NewChunk()
+	return vm.InterpretContext(context.Background(), source)
+}
 
-	if !compiler.Compile(source, c) {
-		c.Free()
+// InterpretContext is like Interpret but stops with InterpretCanceled once
+// ctx is done, the context is checked every cancelCheckInterval instructions.
+func (vm *VM) InterpretContext(ctx context.Context, source *[]byte) InterpretResult {
+	program, ok := Compile(source)
+	if !ok {
 		return InterpretCompileError
 	}
 
-	vm.chunk = c
-	vm.ip = 0
+	result := vm.RunContext(ctx, program)
+
+	program.chunk.Free()
+	return result
+}
+
+// Check compiles and runs source, returning the compile errors or the runtime
+// error it produced as diagnostics instead of printing them.
+func (vm *VM) Check(ctx context.Context, source *[]byte) []diagnostic.Diagnostic {
+	program, diagnostics := CompileDiagnostics(source)
+	if len(diagnostics) > 0 {
+		return diagnostics
+	}
+	defer program.chunk.Free()
+
+	stderr := vm.stderr
+	vm.stderr = io.Discard
+	vm.RunContext(ctx, program)
+	vm.stderr = stderr
+
+	if vm.err != nil {
+		return []diagnostic.Diagnostic{vm.err.Diagnostic}
+	}
+	return nil
+}
+
+func (vm *VM) Run(program *Program) InterpretResult {
+	return vm.RunContext(context.Background(), program)
+}
+
+// RunContext executes an already compiled program, the program is only read
+// so other VMs may run it at the same time.
+func (vm *VM) RunContext(ctx context.Context, program *Program) InterpretResult {
 	vm.globals = make(map[string]value.Value)
+	return vm.runProgram(ctx, program)
+}
+
+// RunKeepingGlobals is like RunContext but starts with the globals the
+// previous runs left behind, so a REPL can run each input as a program of
+// its own.
+func (vm *VM) RunKeepingGlobals(ctx context.Context, program *Program) InterpretResult {
+	if vm.globals == nil {
+		vm.globals = make(map[string]value.Value)
+	}
+	return vm.runProgram(ctx, program)
+}
+
+// RunExpression is like RunKeepingGlobals for a program compiled by
+// CompileExpressionDiagnostics, it returns the expression's value.
+func (vm *VM) RunExpression(ctx context.Context, program *Program) (value.Value, InterpretResult) {
+	result := vm.RunKeepingGlobals(ctx, program)
+	if result != InterpretOk || vm.stackTop == 0 {
+		return nil, result
+	}
+	v := vm.peek(0)
+	vm.resetStack()
+	return v, result
+}
+
+// ResetGlobals forgets the globals kept for RunKeepingGlobals.
+func (vm *VM) ResetGlobals() {
+	vm.globals = nil
+}
+
+func (vm *VM) runProgram(ctx context.Context, program *Program) InterpretResult {
+	vm.chunk = program.chunk
+	vm.source = program.source
+	vm.file = program.file
+	vm.ip = 0
+	vm.slots = 0
+	vm.frames = append(vm.frames[:0], CallFrame{chunk: program.chunk})
+	vm.ctx = ctx
+	vm.instructionCount = 0
+	vm.bytesAllocated = 0
+	vm.err = nil
+	vm.baseFrame = 0
+	vm.clockStart = vm.clock.Now()
+	vm.DefineConstant("args", argsArray(vm.args))
 
 	result := vm.run()
 
-	c.Free()
+	vm.ctx = nil
+	vm.chunk = nil
+	vm.source = nil
+	vm.frames = vm.frames[:0]
 	return result
 }
 
+// Err returns the error that stopped the most recent run, or nil if it
+// finished normally.
+func (vm *VM) Err() *RuntimeError {
+	return vm.err
+}
+
+// reset puts the VM back in the state NewVM leaves it in, keeping only the
+// memory of its stack.
+func (vm *VM) reset() {
+	vm.err = nil
+	vm.stack = vm.stack[:0]
+	vm.stackTop = 0
+	vm.chunk = nil
+	vm.ip = 0
+	vm.slots = 0
+	vm.frames = vm.frames[:0]
+	vm.baseFrame = 0
+	vm.globals = nil
+	vm.args = nil
+	vm.fs = nil
+	vm.hook = nil
+	vm.source = nil
+	vm.file = ""
+	vm.bytesAllocated = 0
+	vm.maxInstructions = 0
+	vm.maxBytes = 0
+	vm.maxStackDepth = common.Uint24Max
+	vm.maxCallDepth = defaultMaxCallDepth
+	vm.stdout = os.Stdout
+	vm.stderr = os.Stderr
+	vm.defineBuiltins()
+}
+
 func (vm *VM) run() InterpretResult {
 	for {
+		if vm.ctx != nil && vm.instructionCount%cancelCheckInterval == 0 {
+			if err := vm.ctx.Err(); err != nil {
+				vm.runtimeErrorBefore(diagnostic.CodeCanceled, "Execution canceled: %v.", err)
+				return InterpretCanceled
+			}
+		}
+		vm.instructionCount++
+		if vm.maxInstructions > 0 && vm.instructionCount > vm.maxInstructions {
+			vm.runtimeErrorBefore(diagnostic.CodeInstructionLimit, "Instruction limit of %d exceeded.", vm.maxInstructions)
+			return InterpretInstructionLimit
+		}
+		if vm.hook != nil && !vm.evaluating && !vm.hook(vm) {
+			vm.resetStack()
+			return InterpretCanceled
+		}
+
 		if debug.TraceExecution {
 			fmt.Printf("          ")
 			for slot := 0; slot < vm.stackTop; slot++ {
@@ -118,23 +412,26 @@ func (vm *VM) run() InterpretResult {
 				return popResult
 			}
 		case opcode.GetLocal, opcode.GetLocalLong:
-			slot := vm.readIndex(instruction)
+			slot := vm.slots + vm.readIndex(instruction)
 			pushResult := vm.push(vm.stack[slot])
 			if pushResult != InterpretNoResult {
 				return pushResult
 			}
 		case opcode.SetLocal, opcode.SetLocalLong:
-			slot := vm.readIndex(instruction)
-			vm.stack[slot] = vm.peek(slot)
+			slot := vm.slots + vm.readIndex(instruction)
+			vm.stack[slot] = vm.peek(0)
 		case opcode.GetGlobal, opcode.GetGlobalLong:
 			name := vm.readConstant(instruction).String()
 			val, exists := vm.globals[name]
+			if !exists {
+				val, exists = vm.builtins[name]
+			}
 			_, popResult := vm.pop()
 			if popResult != InterpretNoResult {
 				return popResult
 			}
 			if !exists {
-				vm.runtimeError("Undefined variable '%s'.", name)
+				vm.undefinedVariableError(name)
 				return InterpretRuntimeError
 			}
 			pushResult := vm.push(val)
@@ -147,6 +444,10 @@ func (vm *VM) run() InterpretResult {
 			if popResult != InterpretNoResult {
 				return popResult
 			}
+			_, popResult = vm.pop()
+			if popResult != InterpretNoResult {
+				return popResult
+			}
 			vm.globals[name] = val
 		case opcode.SetGlobal, opcode.SetGlobalLong:
 			name := vm.readConstant(instruction).String()
@@ -156,9 +457,10 @@ func (vm *VM) run() InterpretResult {
 				if popResult != InterpretNoResult {
 					return popResult
 				}
+				vm.stack[vm.stackTop-1] = val
 				vm.globals[name] = val
 			} else {
-				vm.runtimeError("Undefined variable '%s'.", name)
+				vm.undefinedVariableError(name)
 				return InterpretRuntimeError
 			}
 		case opcode.Equal:
@@ -209,7 +511,7 @@ func (vm *VM) run() InterpretResult {
 			}
 		case opcode.Negate:
 			if val := vm.peek(0); !val.IsNumber() {
-				vm.runtimeError("Operand must be a number.")
+				vm.runtimeError(diagnostic.CodeType, "Operand must be a number.")
 				return InterpretRuntimeError
 			} else {
 				val, popResult := vm.pop()
@@ -226,7 +528,7 @@ func (vm *VM) run() InterpretResult {
 			if popResult != InterpretNoResult {
 				return popResult
 			}
-			fmt.Printf("%s\n", val)
+			fmt.Fprintf(vm.stdout, "%s\n", val)
 		case opcode.Jump:
 			offset := vm.readShort()
 			vm.ip += offset
@@ -238,8 +540,66 @@ func (vm *VM) run() InterpretResult {
 		case opcode.Loop:
 			offset := vm.readShort()
 			vm.ip -= offset
+		case opcode.IncrementLocal:
+			slot := vm.slots + int(vm.readByte())
+			constant := vm.chunk.Constants[vm.readByte()]
+			if a, ok := vm.stack[slot].(value.NumberVal); ok && constant.IsNumber() {
+				vm.stack[slot] = a + constant.(value.NumberVal)
+				break
+			}
+			if pushResult := vm.push(vm.stack[slot]); pushResult != InterpretNoResult {
+				return pushResult
+			}
+			if pushResult := vm.push(constant); pushResult != InterpretNoResult {
+				return pushResult
+			}
+			if result := vm.add(); result != InterpretNoResult {
+				return result
+			}
+			val, popResult := vm.pop()
+			if popResult != InterpretNoResult {
+				return popResult
+			}
+			vm.stack[slot] = val
+		case opcode.LessLocalJumpIfFalse:
+			slot := vm.slots + int(vm.readByte())
+			constant := vm.chunk.Constants[vm.readByte()]
+			offset := vm.readShort()
+			a, ok := vm.stack[slot].(value.NumberVal)
+			if !ok || !constant.IsNumber() {
+				vm.runtimeError(diagnostic.CodeType, "Operands must be numbers.")
+				return InterpretRuntimeError
+			}
+			isLess := a < constant.(value.NumberVal)
+			if pushResult := vm.push(value.BoolVal(isLess)); pushResult != InterpretNoResult {
+				return pushResult
+			}
+			if !isLess {
+				vm.ip += offset
+			}
+		case opcode.Call:
+			argCount := int(vm.readByte())
+			if result := vm.callValue(vm.peek(argCount), argCount); result != InterpretNoResult {
+				return result
+			}
 		case opcode.Return:
-			return InterpretOk
+			if len(vm.frames) <= vm.baseFrame+1 {
+				return InterpretOk
+			}
+			result, popResult := vm.pop()
+			if popResult != InterpretNoResult {
+				return popResult
+			}
+			frame := vm.frames[len(vm.frames)-1]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.stack = vm.stack[:frame.slots]
+			vm.stackTop = frame.slots
+
+			caller := vm.frames[len(vm.frames)-1]
+			vm.chunk, vm.ip, vm.slots = caller.chunk, caller.ip, caller.slots
+			if pushResult := vm.push(result); pushResult != InterpretNoResult {
+				return pushResult
+			}
 		default:
 			err := fmt.Sprintf("Unknown instruction %v", instruction)
 			panic(err)
@@ -247,12 +607,47 @@ func (vm *VM) run() InterpretResult {
 	}
 }
 
+func (vm *VM) callValue(callee value.Value, argCount int) InterpretResult {
+	if function, ok := callee.(*object.ObjFunction); ok {
+		return vm.call(function, argCount)
+	}
+	if native, ok := callee.(*object.ObjNative); ok {
+		return vm.callNative(native, argCount)
+	}
+	vm.runtimeError(diagnostic.CodeNotCallable, "Can only call functions.")
+	return InterpretRuntimeError
+}
+
+func (vm *VM) call(function *object.ObjFunction, argCount int) InterpretResult {
+	if argCount != function.Arity() {
+		vm.runtimeError(diagnostic.CodeArity, "Expected %d arguments but got %d.", function.Arity(), argCount)
+		return InterpretRuntimeError
+	}
+	if len(vm.frames) >= vm.maxCallDepth {
+		vm.runtimeError(diagnostic.CodeStackOverflow, "Stack overflow, more than %d calls are active.", vm.maxCallDepth)
+		return InterpretStackOverflow
+	}
+
+	vm.frames[len(vm.frames)-1].ip = vm.ip
+	vm.frames = append(vm.frames, CallFrame{
+		function: function,
+		chunk:    function.Chunk(),
+		slots:    vm.stackTop - argCount - 1,
+	})
+	vm.chunk, vm.ip, vm.slots = function.Chunk(), 0, vm.stackTop-argCount-1
+	return InterpretNoResult
+}
+
 func (vm *VM) add() InterpretResult {
 	a := vm.peek(1)
 	b := vm.peek(0)
 
 	if !a.IsType(b) {
-		vm.runtimeError("Operands must be of the same type.")
+		vm.runtimeError(diagnostic.CodeType, "Operands must be of the same type.")
+		return InterpretRuntimeError
+	}
+	if !a.IsNumber() && !a.IsString() {
+		vm.runtimeError(diagnostic.CodeType, "Operands must be two numbers or two strings.")
 		return InterpretRuntimeError
 	}
 
@@ -267,7 +662,11 @@ func (vm *VM) add() InterpretResult {
 
 	switch a.(type) {
 	case object.ObjString:
-		pushResult := vm.push(object.ObjString(valA.(object.ObjString) + valB.(object.ObjString)))
+		strA, strB := valA.(object.ObjString), valB.(object.ObjString)
+		if allocateResult := vm.allocate(len(strA) + len(strB)); allocateResult != InterpretNoResult {
+			return allocateResult
+		}
+		pushResult := vm.push(object.ObjString(strA + strB))
 		if pushResult != InterpretNoResult {
 			return pushResult
 		}
@@ -283,7 +682,7 @@ func (vm *VM) add() InterpretResult {
 
 func (vm *VM) binaryOP(operator byte) InterpretResult {
 	if !vm.peek(0).IsNumber() || !vm.peek(1).IsNumber() {
-		vm.runtimeError("Operands must be numbers.")
+		vm.runtimeError(diagnostic.CodeType, "Operands must be numbers.")
 		return InterpretRuntimeError
 	}
 
@@ -333,7 +732,13 @@ func (vm *VM) binaryOP(operator byte) InterpretResult {
 			return pushResult
 		}
 	case opcode.Modulo:
-		pushResult := vm.push(value.NumberVal(float64(int(valA.(value.NumberVal)) % int(valB.(value.NumberVal)))))
+		// Like dividing by zero, the remainder of dividing by zero is a
+		// number, NaN, not an error.
+		remainder := math.NaN()
+		if divisor := int(valB.(value.NumberVal)); divisor != 0 {
+			remainder = float64(int(valA.(value.NumberVal)) % divisor)
+		}
+		pushResult := vm.push(value.NumberVal(remainder))
 		if pushResult != InterpretNoResult {
 			return pushResult
 		}
@@ -377,12 +782,106 @@ func (vm *VM) readIndex(op byte) int {
 	}
 }
 
-func (vm *VM) runtimeError(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, format, args...)
-	fmt.Fprintf(os.Stderr, "[line %d] in script\n", vm.chunk.GetLine(vm.ip-1))
+func (vm *VM) runtimeError(code string, format string, args ...interface{}) {
+	vm.reportRuntimeError(code, fmt.Sprintf(format, args...), nil)
+}
+
+// runtimeErrorBefore reports an error that stops the instruction at vm.ip
+// before it runs, at that instruction rather than the one before it.
+func (vm *VM) runtimeErrorBefore(code string, format string, args ...interface{}) {
+	vm.reportRuntimeErrorAt(vm.ip, code, fmt.Sprintf(format, args...), nil)
+}
+
+func (vm *VM) undefinedVariableError(name string) {
+	names := make([]string, 0, len(vm.globals)+len(vm.builtins))
+	for global := range vm.globals {
+		names = append(names, global)
+	}
+	for builtin := range vm.builtins {
+		names = append(names, builtin)
+	}
+	sort.Strings(names)
+
+	var hints []string
+	if suggestion, ok := diagnostic.Suggest(name, names); ok {
+		hints = append(hints, fmt.Sprintf("did you mean `%s`?", suggestion))
+	}
+	vm.reportRuntimeError(diagnostic.CodeUndefinedVariable, fmt.Sprintf("Undefined variable '%s'.", name), hints)
+}
+
+func (vm *VM) reportRuntimeError(code string, message string, hints []string) {
+	vm.reportRuntimeErrorAt(vm.ip-1, code, message, hints)
+}
+
+// reportRuntimeErrorAt reports an error at the instruction at offset in the
+// innermost frame.
+func (vm *VM) reportRuntimeErrorAt(offset int, code string, message string, hints []string) {
+	span := vm.chunk.GetSpan(offset)
+	d := diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  message,
+		Span:     span,
+		Hints:    hints,
+	}
+	vm.err = &RuntimeError{Diagnostic: d, Trace: vm.trace(offset)}
+	if vm.evaluating {
+		return
+	}
+	diagnostic.NewRenderer(vm.source, vm.file, diagnostic.IsTerminal(vm.stderr)).Render(vm.stderr, d)
+	printTrace(vm.stderr, vm.err.Trace)
 	vm.resetStack()
 }
 
+// trace describes the active calls, innermost first, each at the instruction
+// it was running or the call it is waiting on. offset is the instruction of
+// the innermost call.
+func (vm *VM) trace(offset int) []TraceFrame {
+	if len(vm.frames) == 0 {
+		span := vm.chunk.GetSpan(offset)
+		return []TraceFrame{{File: vm.file, Line: span.Line, Column: span.Column}}
+	}
+
+	trace := make([]TraceFrame, 0, len(vm.frames))
+	for i := len(vm.frames) - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		ip := frame.ip - 1
+		if i == len(vm.frames)-1 {
+			ip = offset
+		}
+
+		span := frame.chunk.GetSpan(ip)
+		tf := TraceFrame{File: vm.file, Line: span.Line, Column: span.Column}
+		if frame.function != nil {
+			tf.Function = frame.function.Name()
+		}
+		trace = append(trace, tf)
+	}
+	return trace
+}
+
+// printTrace prints a traceback, collapsing long runs of the same frame such
+// as those left by runaway recursion.
+func printTrace(w io.Writer, trace []TraceFrame) {
+	const shownRepeats = 3
+
+	for i := 0; i < len(trace); {
+		run := 1
+		for i+run < len(trace) && trace[i+run] == trace[i] {
+			run++
+		}
+
+		for j := 0; j < min(run, shownRepeats); j++ {
+			fmt.Fprintln(w, trace[i])
+		}
+		if run > shownRepeats {
+			fmt.Fprintf(w, "[previous line repeated %d more times]\n", run-shownRepeats)
+		}
+		i += run
+	}
+}
+
 func (vm *VM) resetStack() {
+	vm.stack = vm.stack[:0]
 	vm.stackTop = 0
 }
@@ -1,11 +1,19 @@
 package vm
 
 import (
+	"context"
+	"fmt"
 	"github.com/VannRR/golox/internal/chunk"
+	"github.com/VannRR/golox/internal/common"
+	"github.com/VannRR/golox/internal/compiler"
+	"github.com/VannRR/golox/internal/debug"
+	"github.com/VannRR/golox/internal/diagnostic"
 	"github.com/VannRR/golox/internal/object"
 	"github.com/VannRR/golox/internal/opcode"
 	"github.com/VannRR/golox/internal/value"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_NewVM(t *testing.T) {
@@ -42,11 +50,92 @@ func Test_push_overflow(t *testing.T) {
 
 	pushResult := vm.push(val)
 
-	if pushResult != InterpretRuntimeError {
+	if pushResult != InterpretStackOverflow {
 		t.Errorf("Expected overflow runtime error with push")
 	}
 }
 
+func Test_SetMaxStackDepth(t *testing.T) {
+	vm := NewVM()
+	vm.SetMaxStackDepth(3)
+	source := []byte("1 + (2 + (3 + 4));")
+
+	result := vm.Interpret(&source)
+
+	if result != InterpretStackOverflow {
+		t.Errorf("Expected InterpretStackOverflow, got %d", result)
+	}
+
+	vm.SetMaxStackDepth(0)
+	if vm.maxStackDepth != common.Uint24Max {
+		t.Errorf("Expected max stack depth to reset to %d, got %d", common.Uint24Max, vm.maxStackDepth)
+	}
+}
+
+func Test_SetMaxInstructions(t *testing.T) {
+	vm := NewVM()
+	vm.SetMaxInstructions(50)
+	source := []byte("while (true) {}")
+
+	result := vm.Interpret(&source)
+
+	if result != InterpretInstructionLimit {
+		t.Errorf("Expected InterpretInstructionLimit, got %d", result)
+	}
+	if vm.instructionCount != 51 {
+		t.Errorf("Expected 51 instructions to be counted, got %d", vm.instructionCount)
+	}
+	if span := vm.Err().Span; span.Line != 1 || span.Length == 0 {
+		t.Errorf("Expected the error at the instruction that didn't run, got %v", span)
+	}
+
+	source = []byte("print 1;")
+	result = vm.Interpret(&source)
+
+	if result != InterpretOk {
+		t.Errorf("Expected the instruction count to reset between runs, got %d", result)
+	}
+}
+
+func Test_InterpretContext_canceled(t *testing.T) {
+	vm := NewVM()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	source := []byte("while (true) {}")
+
+	result := vm.InterpretContext(ctx, &source)
+
+	if result != InterpretCanceled {
+		t.Errorf("Expected InterpretCanceled, got %d", result)
+	}
+	if vm.instructionCount != 0 {
+		t.Errorf("Expected no instructions to run, got %d", vm.instructionCount)
+	}
+	if span := vm.Err().Span; span.Line != 1 || span.Column != 8 {
+		t.Errorf("Expected the error at the instruction that didn't run, line 1 column 8, got %v", span)
+	}
+	if trace := vm.Err().Trace; len(trace) != 1 || trace[0].Line != 1 || trace[0].Column != 8 {
+		t.Errorf("Expected the trace at line 1 column 8, got %v", trace)
+	}
+}
+
+func Test_InterpretContext_timeout(t *testing.T) {
+	trace := debug.TraceExecution
+	debug.TraceExecution = false
+	defer func() { debug.TraceExecution = trace }()
+
+	vm := NewVM()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	source := []byte("while (true) {}")
+
+	result := vm.InterpretContext(ctx, &source)
+
+	if result != InterpretCanceled {
+		t.Errorf("Expected InterpretCanceled, got %d", result)
+	}
+}
+
 func Test_pop(t *testing.T) {
 	vm := NewVM()
 	val := value.NumberVal(42)
@@ -105,6 +194,166 @@ func Test_Interpret(t *testing.T) {
 	}
 }
 
+func Test_runtimeError_hint(t *testing.T) {
+	vm := NewVM()
+	var stdout, stderr strings.Builder
+	vm.SetOutput(&stdout, &stderr)
+
+	source := []byte("var count = 1;\nprint cuont;")
+	result := vm.Interpret(&source)
+
+	if result != InterpretRuntimeError {
+		t.Fatalf("Expected InterpretRuntimeError, got %d", result)
+	}
+
+	expected := []string{
+		"error[R0002]: Undefined variable 'cuont'.",
+		"2 | print cuont;",
+		"  |       ^^^^^",
+		"= help: did you mean `count`?",
+		"[line 2:7] in script",
+	}
+	for _, e := range expected {
+		if !strings.Contains(stderr.String(), e) {
+			t.Errorf("Expected stderr to contain %q, got:\n%s", e, stderr.String())
+		}
+	}
+}
+
+func Test_Check(t *testing.T) {
+	tests := []struct {
+		source string
+		codes  []string
+	}{
+		{"print 1;", nil},
+		{"print 1", []string{diagnostic.CodeSyntax}},
+		{"1 = 2; var a = ;", []string{diagnostic.CodeInvalidAssignment, diagnostic.CodeSyntax}},
+		{"print -\"a\";", []string{diagnostic.CodeType}},
+		{"print missing;", []string{diagnostic.CodeUndefinedVariable}},
+	}
+
+	for _, tt := range tests {
+		vm := NewVM()
+		var stdout, stderr strings.Builder
+		vm.SetOutput(&stdout, &stderr)
+
+		source := []byte(tt.source)
+		diagnostics := vm.Check(context.Background(), &source)
+
+		codes := make([]string, 0)
+		for _, d := range diagnostics {
+			codes = append(codes, d.Code)
+		}
+		if fmt.Sprint(codes) != fmt.Sprint(tt.codes) {
+			t.Errorf("Expected codes %v for %q, got %v", tt.codes, tt.source, codes)
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("Expected Check not to print errors for %q, got %q", tt.source, stderr.String())
+		}
+	}
+}
+
+func Test_Err(t *testing.T) {
+	vm := NewVM()
+	vm.SetOutput(&strings.Builder{}, &strings.Builder{})
+
+	source := []byte("print 1;\nprint 1 + nil;")
+	vm.Interpret(&source)
+
+	err := vm.Err()
+	if err == nil {
+		t.Fatalf("Expected a runtime error")
+	}
+	if err.Code != diagnostic.CodeType || err.Error() != "2:9: Operands must be of the same type." {
+		t.Errorf("Unexpected runtime error %s %q", err.Code, err.Error())
+	}
+
+	source = []byte("print 1;")
+	vm.Interpret(&source)
+	if vm.Err() != nil {
+		t.Errorf("Expected a successful run to clear the error, got %v", vm.Err())
+	}
+}
+
+func Test_RuntimeError_Trace(t *testing.T) {
+	source := []byte(`fun inner(x) {
+  return x + nil;
+}
+fun outer() {
+  return inner(1);
+}
+outer();`)
+	program, ok := CompileFile("trace.lox", &source)
+	if !ok {
+		t.Fatalf("Expected source to compile")
+	}
+
+	vm := NewVM()
+	var stderr strings.Builder
+	vm.SetOutput(&strings.Builder{}, &stderr)
+
+	if result := vm.Run(program); result != InterpretRuntimeError {
+		t.Fatalf("Expected InterpretRuntimeError, got %d", result)
+	}
+
+	expected := []TraceFrame{
+		{Function: "inner", File: "trace.lox", Line: 2, Column: 12},
+		{Function: "outer", File: "trace.lox", Line: 5, Column: 15},
+		{Function: "", File: "trace.lox", Line: 7, Column: 6},
+	}
+	if fmt.Sprint(vm.Err().Trace) != fmt.Sprint(expected) {
+		t.Errorf("Expected trace %v, got %v", expected, vm.Err().Trace)
+	}
+
+	lines := "[trace.lox line 2:12] in inner()\n" +
+		"[trace.lox line 5:15] in outer()\n" +
+		"[trace.lox line 7:6] in script\n"
+	if !strings.HasSuffix(stderr.String(), lines) {
+		t.Errorf("Expected stderr to end with\n%s\ngot\n%s", lines, stderr.String())
+	}
+}
+
+func Test_printTrace_repeated(t *testing.T) {
+	frame := TraceFrame{Function: "f", Line: 1, Column: 10}
+	trace := []TraceFrame{frame, frame, frame, frame, frame, {Line: 2, Column: 1}}
+
+	var out strings.Builder
+	printTrace(&out, trace)
+
+	expected := "[line 1:10] in f()\n" +
+		"[line 1:10] in f()\n" +
+		"[line 1:10] in f()\n" +
+		"[previous line repeated 2 more times]\n" +
+		"[line 2:1] in script\n"
+	if out.String() != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func Test_SetMaxCallDepth(t *testing.T) {
+	vm := NewVM()
+	vm.SetOutput(&strings.Builder{}, &strings.Builder{})
+	vm.SetMaxCallDepth(5)
+
+	source := []byte("fun f(n) { if (n > 0) f(n - 1); } f(3);")
+	if result := vm.Interpret(&source); result != InterpretOk {
+		t.Errorf("Expected 4 nested calls to fit, got %d", result)
+	}
+
+	source = []byte("fun f(n) { if (n > 0) f(n - 1); } f(4);")
+	if result := vm.Interpret(&source); result != InterpretStackOverflow {
+		t.Errorf("Expected InterpretStackOverflow, got %d", result)
+	}
+	if len(vm.Err().Trace) != 5 {
+		t.Errorf("Expected 5 frames in the trace, got %d", len(vm.Err().Trace))
+	}
+
+	vm.SetMaxCallDepth(0)
+	if vm.maxCallDepth != defaultMaxCallDepth {
+		t.Errorf("Expected the default call depth, got %d", vm.maxCallDepth)
+	}
+}
+
 func Test_run(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -218,6 +467,31 @@ func Test_run(t *testing.T) {
 			source:   "var i = 0; while (i < 3) i = i + 1; print i;",
 			expected: InterpretOk,
 		},
+		{
+			name:     "locals after globals",
+			source:   "var a = 1; { var b = 2; var c = b; c = a; }",
+			expected: InterpretOk,
+		},
+		{
+			name:     "increment local",
+			source:   "{ var i = 0; i = i + 1; }",
+			expected: InterpretOk,
+		},
+		{
+			name:     "increment local string",
+			source:   `{ var s = "a"; s = s + "b"; }`,
+			expected: InterpretOk,
+		},
+		{
+			name:     "increment local type mismatch",
+			source:   `{ var s = "a"; s = s + 1; }`,
+			expected: InterpretRuntimeError,
+		},
+		{
+			name:     "less local jump if false non-number",
+			source:   `{ var s = "a"; while (s < 1) s = s + "a"; }`,
+			expected: InterpretRuntimeError,
+		},
 		{
 			name:     "operands must be two numbers or two strings",
 			source:   "123 + true;",
@@ -228,6 +502,36 @@ func Test_run(t *testing.T) {
 			source:   `"cow" - 123;`,
 			expected: InterpretRuntimeError,
 		},
+		{
+			name:     "call function",
+			source:   "fun add(a, b) { return a + b; } if (add(1, 2) != 3) 1 + nil;",
+			expected: InterpretOk,
+		},
+		{
+			name:     "recursive function",
+			source:   "fun fib(n) { if (n < 2) return n; return fib(n - 2) + fib(n - 1); } if (fib(15) != 610) 1 + nil;",
+			expected: InterpretOk,
+		},
+		{
+			name:     "local function and implicit nil return",
+			source:   "{ fun f(x) { var y = x; y = y + 1; } if (f(1) != nil) 1 + nil; }",
+			expected: InterpretOk,
+		},
+		{
+			name:     "call non-function",
+			source:   `"cow"();`,
+			expected: InterpretRuntimeError,
+		},
+		{
+			name:     "wrong argument count",
+			source:   "fun f(a) {} f(1, 2);",
+			expected: InterpretRuntimeError,
+		},
+		{
+			name:     "unbounded recursion",
+			source:   "fun f() { f(); } f();",
+			expected: InterpretStackOverflow,
+		},
 	}
 
 	for _, tt := range tests {
@@ -242,6 +546,24 @@ func Test_run(t *testing.T) {
 	}
 }
 
+func Test_run_assignment(t *testing.T) {
+	source := []byte("var a = 1; var b = a = 2; var c; { var x = 1; var y = 3; x = y; c = x; }")
+	vm := NewVM()
+	if result := vm.Interpret(&source); result != InterpretOk {
+		t.Fatalf("Expected InterpretOk, got %d", result)
+	}
+
+	expected := map[string]value.Value{"a": value.NumberVal(2), "b": value.NumberVal(2), "c": value.NumberVal(3)}
+	for name, want := range expected {
+		if got := vm.globals[name]; got != want {
+			t.Errorf("Expected %s to be %v, got %v", name, want, got)
+		}
+	}
+	if vm.stackTop != 0 {
+		t.Errorf("Expected an empty stack after the script, got %d values", vm.stackTop)
+	}
+}
+
 func Test_readByte(t *testing.T) {
 	vm := &VM{
 		ip: 0,
@@ -383,6 +705,40 @@ func Test_add_strings(t *testing.T) {
 	}
 }
 
+func Test_add_strings_allocates(t *testing.T) {
+	vm := NewVM()
+	vm.push(object.ObjString("foo"))
+	vm.push(object.ObjString("ba"))
+
+	vm.add()
+
+	if vm.BytesAllocated() != 5 {
+		t.Errorf("Expected 5 bytes allocated, got %v", vm.BytesAllocated())
+	}
+}
+
+func Test_SetMaxBytes(t *testing.T) {
+	trace := debug.TraceExecution
+	debug.TraceExecution = false
+	defer func() { debug.TraceExecution = trace }()
+
+	vm := NewVM()
+	vm.SetMaxBytes(1_000)
+	source := []byte(`var s = "ab"; while (true) s = s + s;`)
+
+	result := vm.Interpret(&source)
+
+	if result != InterpretMemoryLimit {
+		t.Errorf("Expected InterpretMemoryLimit, got %d", result)
+	}
+	if vm.BytesAllocated() > 1_000 {
+		t.Errorf("Expected at most 1000 bytes allocated, got %d", vm.BytesAllocated())
+	}
+	if vm.BytesAllocated() != 508 {
+		t.Errorf("Expected 508 bytes allocated before the limit, got %d", vm.BytesAllocated())
+	}
+}
+
 func Test_add_error(t *testing.T) {
 	vm := NewVM()
 	a := "foo"
@@ -395,6 +751,15 @@ func Test_add_error(t *testing.T) {
 	if result != InterpretRuntimeError {
 		t.Errorf("Expected InterpretRuntimeError, got %v", result)
 	}
+
+	vm = NewVM()
+	vm.SetOutput(&strings.Builder{}, &strings.Builder{})
+	vm.push(value.BoolVal(true))
+	vm.push(value.BoolVal(true))
+
+	if result := vm.add(); result != InterpretRuntimeError || vm.Err().Message != "Operands must be two numbers or two strings." {
+		t.Errorf("Expected adding bools to be a type error, got %v", result)
+	}
 }
 
 func Test_binaryOP(t *testing.T) {
@@ -435,3 +800,168 @@ func checkBinaryOp(t *testing.T, a int, b int, operation byte, expected value.Va
 		t.Errorf("Expected (%v %v %v) == %v, got %v", a, opcode.Name[operation], b, expected, actual)
 	}
 }
+
+func Test_binaryOP_moduloByZero(t *testing.T) {
+	for _, source := range []string{"print 1 % 0;", "print 5 % 0.5;", "var z = 0; print -3 % z;"} {
+		if got, code := runNatives(t, NewVM(), source); got != "NaN\n" || code != "" {
+			t.Errorf("Expected %q to print NaN, got %q with %q", source, got, code)
+		}
+	}
+}
+
+func Test_superinstructions(t *testing.T) {
+	vm := NewVM()
+	source := []byte("{ var i = 0; var j = 10; while (i < 5) { i = i + 1; j = j + 2; } i = i - j; }")
+	vm.chunk = chunk.NewChunk()
+	if !compiler.Compile(&source, vm.chunk) {
+		t.Fatalf("Expected source to compile")
+	}
+	vm.globals = make(map[string]value.Value)
+
+	lastPop := len(vm.chunk.Code) - 3
+	vm.chunk.Code[lastPop] = opcode.Return
+
+	if result := vm.run(); result != InterpretOk {
+		t.Fatalf("Expected InterpretOk, got %v", result)
+	}
+
+	if vm.stack[0] != value.NumberVal(-15) {
+		t.Errorf("Expected i to be -15, got %v", vm.stack[0])
+	}
+	if vm.stack[1] != value.NumberVal(20) {
+		t.Errorf("Expected j to be 20, got %v", vm.stack[1])
+	}
+}
+
+const benchmarkLoopCount = 10_000
+
+func Benchmark_run_loop(b *testing.B) {
+	c := &chunk.Chunk{
+		Code: []byte{
+			opcode.Constant, 0,
+			opcode.GetLocal, 0,
+			opcode.Constant, 1,
+			opcode.Less,
+			opcode.JumpIfFalse, 0, 12,
+			opcode.Pop,
+			opcode.GetLocal, 0,
+			opcode.Constant, 2,
+			opcode.Add,
+			opcode.SetLocal, 0,
+			opcode.Pop,
+			opcode.Loop, 0, 20,
+			opcode.Pop,
+			opcode.Pop,
+			opcode.Return,
+		},
+		Constants: []value.Value{
+			value.NumberVal(0),
+			value.NumberVal(benchmarkLoopCount),
+			value.NumberVal(1),
+		},
+	}
+
+	benchmarkChunk(b, c)
+}
+
+func Benchmark_run_loopSuperinstructions(b *testing.B) {
+	printCode := debug.PrintCode
+	debug.PrintCode = false
+	defer func() { debug.PrintCode = printCode }()
+
+	source := []byte(fmt.Sprintf("{ var i = 0; while (i < %d) { i = i + 1; } }", benchmarkLoopCount))
+	c := chunk.NewChunk()
+	if !compiler.Compile(&source, c) {
+		b.Fatalf("Expected source to compile")
+	}
+
+	benchmarkChunk(b, c)
+}
+
+func benchmarkChunk(b *testing.B, c *chunk.Chunk) {
+	b.Helper()
+	trace := debug.TraceExecution
+	debug.TraceExecution = false
+	defer func() { debug.TraceExecution = trace }()
+
+	for i := 0; i < b.N; i++ {
+		vm := NewVM()
+		vm.chunk = c
+		vm.globals = make(map[string]value.Value)
+		if result := vm.run(); result != InterpretOk {
+			b.Fatalf("Expected InterpretOk, got %v", result)
+		}
+	}
+}
+
+func Test_RunKeepingGlobals(t *testing.T) {
+	vm := NewVM()
+	var stdout strings.Builder
+	vm.SetOutput(&stdout, &strings.Builder{})
+
+	run := func(source string) InterpretResult {
+		s := []byte(source)
+		program, ok := Compile(&s)
+		if !ok {
+			t.Fatalf("Expected %q to compile", source)
+		}
+		return vm.RunKeepingGlobals(context.Background(), program)
+	}
+
+	run("var a = 1;")
+	run("fun twice(x) { return x * 2; }")
+	if result := run("print twice(a);"); result != InterpretOk {
+		t.Errorf("Expected the globals of earlier runs to be defined, got %d", result)
+	}
+
+	vm.ResetGlobals()
+	if result := run("print a;"); result != InterpretRuntimeError {
+		t.Errorf("Expected ResetGlobals to forget a, got %d", result)
+	}
+	if stdout.String() != "2\n" {
+		t.Errorf("stdout = %q, expected 2", stdout.String())
+	}
+}
+
+func Test_RunExpression(t *testing.T) {
+	vm := NewVM()
+	vm.SetOutput(&strings.Builder{}, &strings.Builder{})
+
+	s := []byte("var a = 20;")
+	program, ok := Compile(&s)
+	if !ok {
+		t.Fatal("Expected the declaration to compile")
+	}
+	vm.RunKeepingGlobals(context.Background(), program)
+
+	tests := []struct {
+		source string
+		want   string
+		result InterpretResult
+	}{
+		{"a + 1", "21", InterpretOk},
+		{"\"a\" + \"b\"", "ab", InterpretOk},
+		{"a = 5", "5", InterpretOk},
+		{"a", "5", InterpretOk},
+		{"-nope", "", InterpretRuntimeError},
+	}
+	for _, tt := range tests {
+		s := []byte(tt.source)
+		program, diagnostics := CompileExpressionDiagnostics("", &s)
+		if len(diagnostics) > 0 {
+			t.Fatalf("CompileExpressionDiagnostics(%q) = %v", tt.source, diagnostics)
+		}
+		got, result := vm.RunExpression(context.Background(), program)
+		if result != tt.result || (got != nil && got.String() != tt.want) || (got == nil && tt.want != "") {
+			t.Errorf("RunExpression(%q) = %v, %d, expected %s, %d", tt.source, got, result, tt.want, tt.result)
+		}
+	}
+	if vm.stackTop != 0 {
+		t.Errorf("Expected RunExpression to leave the stack empty, has %d values", vm.stackTop)
+	}
+
+	s = []byte("print 1;")
+	if _, diagnostics := CompileExpressionDiagnostics("", &s); len(diagnostics) == 0 {
+		t.Errorf("Expected a statement not to compile as an expression")
+	}
+}